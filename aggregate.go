@@ -0,0 +1,157 @@
+package maxminddb
+
+import "net"
+
+// AggregatedNetworks iterates over the networks of a database like Networks,
+// except that sibling networks with equal data are merged into the network
+// containing them. It is created by Reader.AggregatedNetworks.
+type AggregatedNetworks struct {
+	networks *Networks
+	equal    func(a, b uintptr) bool
+	// pending holds the networks not returned yet in ascending order. The
+	// first ready of them can no longer be merged.
+	pending []aggregatedNode
+	ready   int
+	current aggregatedNode
+	err     error
+}
+
+type aggregatedNode struct {
+	node   netNode
+	offset uintptr
+}
+
+// AggregatedNetworks returns an iterator over the networks of the database
+// in which each pair of sibling networks, the two halves of their parent
+// network, whose data is equal according to equal are merged into the parent.
+// Merging cascades, so 1.0.0.0/10, 1.64.0.0/10, and 1.128.0.0/9 with equal
+// data are returned as 1.0.0.0/8. The equal function is passed the offsets
+// of the data of the networks in the data section, which may be passed to
+// Decode. If equal is nil, networks are merged if they point to the same
+// data.
+//
+// Only siblings are merged, so that every network returned is a valid CIDR
+// network. Adjacent networks with equal data that are not siblings, such as
+// 1.0.0.0/8 and 2.0.0.0/8, are returned separately.
+func (r *Reader) AggregatedNetworks(equal func(a, b uintptr) bool, options ...NetworksOption) *AggregatedNetworks {
+	if equal == nil {
+		equal = func(a, b uintptr) bool { return a == b }
+	}
+	return &AggregatedNetworks{
+		networks: r.Networks(options...),
+		equal:    equal,
+	}
+}
+
+// Next prepares the next network for reading with the Network method. It
+// returns true if there is another network to be processed and false if there
+// are no more networks or if there is an error.
+func (a *AggregatedNetworks) Next() bool {
+	if a.err != nil {
+		return false
+	}
+	for a.ready == 0 {
+		if !a.networks.Next() {
+			if a.networks.Err() != nil {
+				return false
+			}
+			a.ready = len(a.pending)
+			if a.ready == 0 {
+				return false
+			}
+			break
+		}
+		node := a.networks.lastNode
+		offset, err := a.networks.reader.resolveDataPointer(node.pointer)
+		if err != nil {
+			a.err = err
+			return false
+		}
+		a.push(aggregatedNode{node: node, offset: offset})
+	}
+	a.current = a.pending[0]
+	a.pending = a.pending[1:]
+	a.ready--
+	return true
+}
+
+// push adds next to the pending networks, merging it with the networks
+// before it where possible.
+func (a *AggregatedNetworks) push(next aggregatedNode) {
+	for len(a.pending) > 0 {
+		last := a.pending[len(a.pending)-1]
+		if !isLeftSibling(last.node, next.node) || !a.equal(last.offset, next.offset) {
+			break
+		}
+		a.pending = a.pending[:len(a.pending)-1]
+		next = aggregatedNode{
+			node: netNode{
+				ip:      last.node.ip,
+				bit:     last.node.bit - 1,
+				pointer: last.node.pointer,
+			},
+			offset: last.offset,
+		}
+	}
+	a.pending = append(a.pending, next)
+
+	// A network can only be merged later on if the network after it may
+	// still grow into its sibling. If it cannot, neither can any of the
+	// networks before it, as they can only be merged with it.
+	if n := len(a.pending); n > 1 && !mayGrowIntoSibling(a.pending[n-2].node, next.node) {
+		a.ready = n - 1
+	}
+}
+
+// isLeftSibling returns true if left is the left half and right the right
+// half of the same network.
+func isLeftSibling(left, right netNode) bool {
+	if left.bit == 0 || left.bit != right.bit {
+		return false
+	}
+	return siblingIP(left) == right.ip && left.ip != right.ip
+}
+
+// mayGrowIntoSibling returns true if right, which follows left, might be
+// merged with its own siblings into the right sibling of left.
+func mayGrowIntoSibling(left, right netNode) bool {
+	if left.bit == 0 || right.bit <= left.bit {
+		return false
+	}
+	sibling := siblingIP(left)
+	return sibling != left.ip && sibling == right.ip
+}
+
+// siblingIP returns the IP of node with the last bit of its prefix set. For
+// a left half, this is the IP of the right half.
+func siblingIP(node netNode) [net.IPv6len]byte {
+	ip := node.ip
+	bit := node.bit - 1
+	ip[bit>>3] |= 1 << (7 - (bit % 8))
+	return ip
+}
+
+// Network returns the current network or an error if there is a problem
+// decoding its data. It takes a pointer to a result value to decode the
+// network's data into. For a merged network, the data is that of its first
+// part.
+func (a *AggregatedNetworks) Network(result interface{}) (*net.IPNet, error) {
+	if err := a.networks.reader.retrieveData(a.current.node.pointer, result); err != nil {
+		return nil, err
+	}
+	return a.networks.nodeNetwork(a.current.node), nil
+}
+
+// Offset returns the offset of the data of the current network in the data
+// section. It may be passed to Decode.
+func (a *AggregatedNetworks) Offset() uintptr {
+	return a.current.offset
+}
+
+// Err returns an error, if any, that was encountered during iteration.
+func (a *AggregatedNetworks) Err() error {
+	if a.err != nil {
+		return a.err
+	}
+	return a.networks.Err()
+}
@@ -0,0 +1,99 @@
+package maxminddb
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAggregatedNetworks(t *testing.T) {
+	// All the networks point to the same data.
+	reader, err := FromBytes(testDatabase(testTree(
+		"1.0.0.0/9",
+		"1.128.0.0/9",
+		"2.0.0.0/8",
+		"3.0.0.0/8",
+		"4.0.0.0/8",
+		"6.0.0.0/8",
+		"10.0.0.0/10",
+		"10.64.0.0/10",
+		"10.128.0.0/9",
+		"12.0.0.0/9",
+		"12.128.0.0/10",
+		"128.0.0.0/1",
+	), encodeTestValue("x"), nil))
+	require.Nil(t, err)
+
+	var networks []string
+	n := reader.AggregatedNetworks(nil)
+	for n.Next() {
+		var record string
+		network, err := n.Network(&record)
+		require.Nil(t, err)
+		assert.Equal(t, "x", record)
+		assert.Equal(t, uintptr(0), n.Offset())
+		networks = append(networks, network.String())
+	}
+	require.Nil(t, n.Err())
+	assert.Equal(
+		t,
+		[]string{
+			// 1.0.0.0/8 and 2.0.0.0/7 are adjacent but not siblings.
+			"1.0.0.0/8",
+			"2.0.0.0/7",
+			"4.0.0.0/8",
+			"6.0.0.0/8",
+			"10.0.0.0/8",
+			// 12.192.0.0/10 is missing.
+			"12.0.0.0/9",
+			"12.128.0.0/10",
+			"128.0.0.0/1",
+		},
+		networks,
+	)
+}
+
+func TestAggregatedNetworksEqual(t *testing.T) {
+	reader := testDiffDatabase(t, map[string]string{
+		"1.0.0.0/9":   "a",
+		"1.128.0.0/9": "a",
+		"2.0.0.0/8":   "a",
+		"3.0.0.0/8":   "b",
+		"4.0.0.0/9":   "c",
+		"4.128.0.0/9": "c",
+	})
+
+	collect := func(n *AggregatedNetworks) []string {
+		var networks []string
+		for n.Next() {
+			var record struct {
+				V string `maxminddb:"v"`
+			}
+			network, err := n.Network(&record)
+			require.Nil(t, err)
+			networks = append(networks, network.String()+" "+record.V)
+		}
+		require.Nil(t, n.Err())
+		return networks
+	}
+
+	// Each network has its own record, so nothing is merged by default.
+	assert.Equal(
+		t,
+		[]string{"1.0.0.0/9 a", "1.128.0.0/9 a", "2.0.0.0/8 a", "3.0.0.0/8 b", "4.0.0.0/9 c", "4.128.0.0/9 c"},
+		collect(reader.AggregatedNetworks(nil)),
+	)
+
+	decodedEqual := func(a, b uintptr) bool {
+		var recordA, recordB interface{}
+		require.Nil(t, reader.Decode(a, &recordA))
+		require.Nil(t, reader.Decode(b, &recordB))
+		return assert.ObjectsAreEqual(recordA, recordB)
+	}
+	assert.Equal(
+		t,
+		[]string{"1.0.0.0/8 a", "2.0.0.0/8 a", "3.0.0.0/8 b", "4.0.0.0/8 c"},
+		collect(reader.AggregatedNetworks(decodedEqual)),
+	)
+}
@@ -0,0 +1,124 @@
+package maxminddb
+
+import (
+	"container/list"
+	"errors"
+	"reflect"
+	"sync"
+)
+
+// WithDecodeCache returns a ReaderOption that enables an in-memory LRU cache
+// of up to size decoded records. The cache is keyed by the data section
+// offset of the record and the type of the result, so a record is decoded
+// once per result type rather than on every lookup. This is useful when
+// lookups are concentrated on a small number of popular records, e.g., the
+// records for large cities.
+//
+// The cache is used by the Lookup methods and by Networks.Network. As a
+// cached result is copied into the result value, cached records share any
+// maps, slices, and pointers they contain with every result they are copied
+// into. Callers must therefore treat results as read-only when the cache is
+// enabled, as modifying one changes the results of later lookups, including
+// those made by other goroutines. Additionally, the result value is replaced
+// rather than decoded into, meaning that fields not present in the record are
+// reset.
+//
+// A size of zero or less disables the cache.
+func WithDecodeCache(size int) ReaderOption {
+	return func(r *Reader) {
+		if size <= 0 {
+			r.cache = nil
+			return
+		}
+		r.cache = newDecodeCache(size)
+	}
+}
+
+type decodeCacheKey struct {
+	offset     uintptr
+	resultType reflect.Type
+}
+
+type decodeCacheEntry struct {
+	key   decodeCacheKey
+	value reflect.Value
+}
+
+// decodeCache is an LRU cache of decoded records. It is safe for concurrent
+// use.
+type decodeCache struct {
+	mu      sync.Mutex
+	size    int
+	entries map[decodeCacheKey]*list.Element
+	lru     *list.List // Most recently used entries are at the front.
+}
+
+func newDecodeCache(size int) *decodeCache {
+	return &decodeCache{
+		size:    size,
+		entries: make(map[decodeCacheKey]*list.Element, size),
+		lru:     list.New(),
+	}
+}
+
+func (c *decodeCache) get(key decodeCacheKey) (reflect.Value, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, ok := c.entries[key]
+	if !ok {
+		return reflect.Value{}, false
+	}
+	c.lru.MoveToFront(e)
+	return e.Value.(*decodeCacheEntry).value, true
+}
+
+func (c *decodeCache) add(key decodeCacheKey, value reflect.Value) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if e, ok := c.entries[key]; ok {
+		e.Value.(*decodeCacheEntry).value = value
+		c.lru.MoveToFront(e)
+		return
+	}
+	c.entries[key] = c.lru.PushFront(&decodeCacheEntry{key, value})
+	if c.lru.Len() > c.size {
+		oldest := c.lru.Back()
+		c.lru.Remove(oldest)
+		delete(c.entries, oldest.Value.(*decodeCacheEntry).key)
+	}
+}
+
+func (c *decodeCache) len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.lru.Len()
+}
+
+// decodeCached decodes the record at offset into result, using the cache if
+// there is a decoded record of the same type at that offset.
+func (r *Reader) decodeCached(offset uintptr, result interface{}) error {
+	rv := reflect.ValueOf(result)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return errors.New("result param must be a pointer")
+	}
+
+	key := decodeCacheKey{offset, rv.Type().Elem()}
+	if value, ok := r.cache.get(key); ok {
+		rv.Elem().Set(value)
+		return nil
+	}
+
+	d, dataOffset, err := r.dataDecoder(&r.decoder, uint(offset))
+	if err != nil {
+		return err
+	}
+	value := reflect.New(key.resultType)
+	if err := d.decodeRecord(dataOffset, value); err != nil {
+		return err
+	}
+	r.cache.add(key, value.Elem())
+	rv.Elem().Set(value.Elem())
+	return nil
+}
@@ -0,0 +1,140 @@
+package maxminddb
+
+import (
+	"math/rand"
+	"net"
+	"reflect"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDecodeCache(t *testing.T) {
+	reader, err := Open(
+		"test-data/test-data/GeoIP2-City-Test.mmdb",
+		WithDecodeCache(2),
+	)
+	require.Nil(t, err)
+
+	type country struct {
+		Country struct {
+			IsoCode string `maxminddb:"iso_code"`
+		} `maxminddb:"country"`
+	}
+
+	ip := net.ParseIP("81.2.69.142")
+	for i := 0; i < 2; i++ {
+		var result country
+		require.Nil(t, reader.Lookup(ip, &result))
+		assert.Equal(t, "GB", result.Country.IsoCode)
+		assert.Equal(t, 1, reader.cache.len())
+	}
+
+	var uncached country
+	noCache, err := Open("test-data/test-data/GeoIP2-City-Test.mmdb")
+	require.Nil(t, err)
+	require.Nil(t, noCache.Lookup(ip, &uncached))
+	assert.Nil(t, noCache.cache)
+	assert.Nil(t, noCache.Close())
+
+	// Each result type is cached separately.
+	var record map[string]interface{}
+	require.Nil(t, reader.Lookup(ip, &record))
+	assert.Equal(t, "GB", record["country"].(map[string]interface{})["iso_code"])
+	assert.Equal(t, 2, reader.cache.len())
+
+	// The least recently used record is evicted.
+	var other country
+	require.Nil(t, reader.Lookup(net.ParseIP("89.160.20.112"), &other))
+	assert.Equal(t, "SE", other.Country.IsoCode)
+	assert.Equal(t, 2, reader.cache.len())
+
+	offset, err := reader.LookupOffset(ip)
+	require.Nil(t, err)
+	_, ok := reader.cache.get(decodeCacheKey{offset, reflect.TypeOf(country{})})
+	assert.False(t, ok)
+	_, ok = reader.cache.get(decodeCacheKey{offset, reflect.TypeOf(map[string]interface{}{})})
+	assert.True(t, ok)
+
+	assert.Nil(t, reader.Close())
+}
+
+func TestDecodeCacheDisabled(t *testing.T) {
+	reader, err := Open(
+		"test-data/test-data/GeoIP2-City-Test.mmdb",
+		WithDecodeCache(0),
+	)
+	require.Nil(t, err)
+	assert.Nil(t, reader.cache)
+	assert.Nil(t, reader.Close())
+}
+
+func TestDecodeCacheErrors(t *testing.T) {
+	reader, err := Open(
+		"test-data/test-data/GeoIP2-City-Test.mmdb",
+		WithDecodeCache(10),
+	)
+	require.Nil(t, err)
+
+	var result struct {
+		Country string `maxminddb:"country"`
+	}
+	err = reader.Lookup(net.ParseIP("81.2.69.142"), &result)
+	assert.IsType(t, UnmarshalTypeError{}, err)
+	assert.Equal(t, 0, reader.cache.len())
+
+	var notPointer interface{}
+	err = reader.Lookup(net.ParseIP("81.2.69.142"), notPointer)
+	assert.EqualError(t, err, "result param must be a pointer")
+
+	assert.Nil(t, reader.Close())
+}
+
+func BenchmarkCityLookupSkewed(b *testing.B) {
+	benchmarkCityLookupSkewed(b)
+}
+
+func BenchmarkCityLookupSkewedWithCache(b *testing.B) {
+	benchmarkCityLookupSkewed(b, WithDecodeCache(1000))
+}
+
+// benchmarkCityLookupSkewed looks up IP addresses drawn from a Zipf
+// distribution so that a small number of addresses account for most of the
+// lookups, as is the case for real-world traffic.
+func benchmarkCityLookupSkewed(b *testing.B, options ...ReaderOption) {
+	db, err := Open("GeoLite2-City.mmdb", options...)
+	require.Nil(b, err)
+
+	type City struct {
+		City struct {
+			GeoNameID uint              `maxminddb:"geoname_id"`
+			Names     map[string]string `maxminddb:"names"`
+		} `maxminddb:"city"`
+		Country struct {
+			IsoCode string `maxminddb:"iso_code"`
+		} `maxminddb:"country"`
+		Location struct {
+			Latitude  float64 `maxminddb:"latitude"`
+			Longitude float64 `maxminddb:"longitude"`
+			TimeZone  string  `maxminddb:"time_zone"`
+		} `maxminddb:"location"`
+	}
+
+	r := rand.New(rand.NewSource(0))
+	ips := make([]net.IP, 10000)
+	for i := range ips {
+		ips[i] = make(net.IP, 4)
+		randomIPv4Address(b, r, ips[i])
+	}
+	zipf := rand.NewZipf(r, 1.1, 1, uint64(len(ips)-1))
+
+	var result City
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		err = db.Lookup(ips[zipf.Uint64()], &result)
+		assert.Nil(b, err)
+	}
+	b.StopTimer()
+	assert.Nil(b, db.Close(), "error on close")
+}
@@ -0,0 +1,43 @@
+package maxminddb
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+)
+
+// OpenWithChecksum is like Open, except that it also computes the SHA-256
+// digest of the database file and returns an error if it does not match
+// expectedSHA256. This detects truncated downloads and modified files before
+// any lookup is made.
+//
+// The digest is computed over the whole file once, after it has been opened.
+// When the file is memory mapped, this reads every page of the mapping, so
+// the file is in the page cache afterwards but opening it takes as long as
+// reading it from disk.
+func OpenWithChecksum(file string, expectedSHA256 []byte, options ...ReaderOption) (*Reader, error) {
+	if len(expectedSHA256) != sha256.Size {
+		return nil, fmt.Errorf(
+			"expected SHA-256 digest passed to OpenWithChecksum must be %d bytes, got %d",
+			sha256.Size,
+			len(expectedSHA256),
+		)
+	}
+	reader, err := Open(file, options...)
+	if err != nil {
+		return nil, err
+	}
+	actual := sha256.Sum256(reader.buffer)
+	if !bytes.Equal(actual[:], expectedSHA256) {
+		if err := reader.Close(); err != nil {
+			return nil, err
+		}
+		return nil, fmt.Errorf(
+			"maxminddb: SHA-256 digest of %s is %x, expected %x",
+			file,
+			actual,
+			expectedSHA256,
+		)
+	}
+	return reader, nil
+}
@@ -0,0 +1,43 @@
+package maxminddb
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOpenWithChecksum(t *testing.T) {
+	fileName := "test-data/test-data/MaxMind-DB-test-ipv4-24.mmdb"
+	contents, err := ioutil.ReadFile(fileName)
+	require.Nil(t, err)
+	digest := sha256.Sum256(contents)
+
+	reader, err := OpenWithChecksum(fileName, digest[:])
+	require.Nil(t, err)
+	var result map[string]string
+	require.Nil(t, reader.Lookup(net.ParseIP("1.1.1.1"), &result))
+	assert.Equal(t, "1.1.1.1", result["ip"])
+	assert.Nil(t, reader.Close())
+
+	wrong := digest
+	wrong[0] ^= 0xff
+	reader, err = OpenWithChecksum(fileName, wrong[:])
+	assert.Nil(t, reader)
+	assert.EqualError(
+		t,
+		err,
+		fmt.Sprintf("maxminddb: SHA-256 digest of %s is %x, expected %x", fileName, digest, wrong),
+	)
+
+	reader, err = OpenWithChecksum(fileName, digest[:16])
+	assert.Nil(t, reader)
+	assert.EqualError(t, err, "expected SHA-256 digest passed to OpenWithChecksum must be 32 bytes, got 16")
+
+	_, err = OpenWithChecksum("file-does-not-exist.mmdb", digest[:])
+	assert.Regexp(t, "open file-does-not-exist.mmdb.*", err)
+}
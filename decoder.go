@@ -1,15 +1,48 @@
 package maxminddb
 
 import (
+	"encoding"
 	"encoding/binary"
+	"errors"
+	"fmt"
 	"math"
 	"math/big"
+	"net"
 	"reflect"
+	"strconv"
+	"strings"
 	"sync"
+	"time"
+	"unicode/utf8"
 )
 
 type decoder struct {
-	buffer []byte
+	buffer          []byte
+	strictDecoding  bool
+	strictArrays    bool
+	maxPointerDepth int // 0 means defaultMaxPointerDepth
+	// strings interns decoded strings. It is only set for the decoder of a
+	// LookupDecoder, as it is not safe for concurrent use.
+	strings map[string]string
+	// fields holds the keys set by WithFields. Other keys of a record are
+	// skipped when it is decoded into a struct. It is nil if all keys are
+	// decoded.
+	fields map[string]bool
+	// resolveType is set by WithTypeResolver. keyPath then holds the keys
+	// leading to the value being decoded. As it changes while decoding,
+	// each decoding uses a copy of the decoder; see Reader.dataDecoder.
+	resolveType func(keyPath []string) reflect.Type
+	keyPath     []string
+	// validateUTF8 is set by WithUTF8Validation.
+	validateUTF8 bool
+	// copiedRecord is set for the decoder of a record copied out of the
+	// data section of a Reader created by FromReaderAt. Offsets in its
+	// buffer are not data section offsets.
+	copiedRecord bool
+	// reader is the Reader whose data section is in buffer, or nil for
+	// decoders of other buffers. LazyArray uses it to detect that the
+	// buffer is gone because the Reader was closed.
+	reader *Reader
 }
 
 type dataType int
@@ -33,40 +66,297 @@ const (
 	_Float32
 )
 
+func (t dataType) String() string {
+	switch t {
+	case _Extended:
+		return "extended"
+	case _Pointer:
+		return "pointer"
+	case _String:
+		return "utf8_string"
+	case _Float64:
+		return "double"
+	case _Bytes:
+		return "bytes"
+	case _Uint16:
+		return "uint16"
+	case _Uint32:
+		return "uint32"
+	case _Map:
+		return "map"
+	case _Int32:
+		return "int32"
+	case _Uint64:
+		return "uint64"
+	case _Uint128:
+		return "uint128"
+	case _Slice:
+		return "array"
+	case _Container:
+		return "container"
+	case _Marker:
+		return "end_marker"
+	case _Bool:
+		return "boolean"
+	case _Float32:
+		return "float"
+	default:
+		return fmt.Sprintf("unknown type %d", int(t))
+	}
+}
+
 const (
 	// This is the value used in libmaxminddb
 	maximumDataStructureDepth = 512
+
+	// defaultMaxPointerDepth is the number of pointers that may be followed
+	// in a row before the data is considered corrupt. Databases written by
+	// MaxMind never point to a pointer.
+	defaultMaxPointerDepth = 32
 )
 
 func (d *decoder) decode(offset uint, result reflect.Value, depth int) (uint, error) {
 	if depth > maximumDataStructureDepth {
 		return 0, newInvalidDatabaseError("exceeded maximum data structure depth; database is likely corrupt")
 	}
+	if u, ok := unmarshaler(result); ok {
+		return d.decodeUnmarshaler(offset, u, depth+1)
+	}
+	if d.resolveType != nil {
+		if newOffset, ok, err := d.decodeResolved(offset, result, depth); ok {
+			return newOffset, err
+		}
+	}
 	typeNum, size, newOffset, err := d.decodeCtrlData(offset)
 	if err != nil {
 		return 0, err
 	}
 
 	if typeNum != _Pointer && result.Kind() == reflect.Uintptr {
+		if d.copiedRecord {
+			return 0, errors.New("maxminddb: decoding into a uintptr is not supported for a Reader created by FromReaderAt")
+		}
 		result.Set(reflect.ValueOf(uintptr(offset)))
 		return d.nextValueOffset(offset, 1)
 	}
+	if typeNum != _Pointer && isRawResult(result.Type()) {
+		return d.unmarshalRaw(offset, result, depth+1)
+	}
+	if typeNum != _Pointer && typeNum != _Container && isLazyArray(result.Type()) {
+		return d.unmarshalLazyArray(typeNum, size, newOffset, result)
+	}
 	return d.decodeFromType(typeNum, size, newOffset, result, depth+1)
 }
 
+// decodeResolved decodes the value at offset into a new value of the type
+// resolveType returns for the current key path if result is, or points to,
+// an empty interface. It returns false if it did not decode the value, i.e.,
+// if result is not an empty interface or resolveType returned nil.
+func (d *decoder) decodeResolved(offset uint, result reflect.Value, depth int) (uint, bool, error) {
+	for result.Kind() == reflect.Ptr && !result.IsNil() {
+		result = result.Elem()
+	}
+	if result.Kind() != reflect.Interface || result.NumMethod() != 0 || !result.CanSet() {
+		return 0, false, nil
+	}
+	t := d.resolveType(d.keyPath)
+	if t == nil {
+		return 0, false, nil
+	}
+	value := reflect.New(t)
+	newOffset, err := d.decode(offset, value, depth+1)
+	if err != nil {
+		return 0, true, err
+	}
+	result.Set(value.Elem())
+	return newOffset, true, nil
+}
+
+// pushKey adds key to the key path if the decoder has a type resolver.
+func (d *decoder) pushKey(key []byte) {
+	if d.resolveType != nil {
+		d.keyPath = append(d.keyPath, string(key))
+	}
+}
+
+// popKey removes the last key pushed by pushKey.
+func (d *decoder) popKey() {
+	if d.resolveType != nil {
+		d.keyPath = d.keyPath[:len(d.keyPath)-1]
+	}
+}
+
+// decodeRecord decodes the record at offset, i.e., the data of a network,
+// into result. It is like decode, except that if the decoder has fields and
+// the record is a map decoded into a struct, the keys of the map that are
+// not in fields are skipped, and that if result points to a non-empty map,
+// the entries the record does not have are deleted from it.
+func (d *decoder) decodeRecord(offset uint, result reflect.Value) error {
+	if d.fields != nil {
+		decoded, err := d.decodeRecordFields(offset, result)
+		if decoded || err != nil {
+			return err
+		}
+	}
+	var m reflect.Value
+	if result.Kind() == reflect.Ptr && !result.IsNil() {
+		if e := result.Elem(); e.Kind() == reflect.Map && e.Len() > 0 {
+			if _, ok := unmarshaler(e); !ok {
+				m = e
+			}
+		}
+	}
+	if _, err := d.decode(offset, result, 0); err != nil || !m.IsValid() {
+		return err
+	}
+	typeNum, size, mapOffset, err := d.recordCtrlData(offset)
+	if err != nil || typeNum != _Map {
+		return err
+	}
+	return d.deleteStaleKeys(m, mapOffset, size)
+}
+
+// recordCtrlData is like decodeCtrlData, except that it follows a pointer
+// and looks into a container at offset, returning the type and size of the
+// value of the record itself.
+func (d *decoder) recordCtrlData(offset uint) (dataType, uint, uint, error) {
+	typeNum, size, newOffset, err := d.decodeCtrlData(offset)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	if typeNum == _Pointer {
+		pointer, _, err := d.followPointer(size, newOffset)
+		if err != nil {
+			return 0, 0, 0, err
+		}
+		typeNum, size, newOffset, err = d.decodeCtrlData(pointer)
+		if err != nil {
+			return 0, 0, 0, err
+		}
+	}
+	if typeNum == _Container {
+		return d.decodeCtrlData(newOffset)
+	}
+	return typeNum, size, newOffset, nil
+}
+
+// decodeRecordFields decodes the fields of the record at offset into result
+// if the record is a map and result a struct. It returns false if it did not
+// decode the record.
+func (d *decoder) decodeRecordFields(offset uint, result reflect.Value) (bool, error) {
+	if _, ok := unmarshaler(result); ok {
+		return false, nil
+	}
+	typeNum, size, newOffset, err := d.recordCtrlData(offset)
+	if err != nil {
+		return false, err
+	}
+	if typeNum != _Map {
+		return false, nil
+	}
+
+	result = d.indirect(result)
+	if result.Kind() != reflect.Struct {
+		return false, nil
+	}
+	if _, ok := unmarshaler(result); ok {
+		return false, nil
+	}
+	_, err = d.decodeStruct(size, newOffset, result, 1, d.strictDecoding, d.fields)
+	return true, err
+}
+
+// decodePath decodes the value found by following path from the value at
+// offset into result. Each path element is either a string map key or an int
+// array index. If the path does not exist in the data, result is left
+// unchanged and no error is returned.
+func (d *decoder) decodePath(offset uint, path []interface{}, result reflect.Value) error {
+PATH:
+	for i, element := range path {
+		typeNum, size, newOffset, err := d.decodeCtrlData(offset)
+		if err != nil {
+			return err
+		}
+		if typeNum == _Pointer {
+			pointer, _, err := d.followPointer(size, newOffset)
+			if err != nil {
+				return err
+			}
+			typeNum, size, newOffset, err = d.decodeCtrlData(pointer)
+			if err != nil {
+				return err
+			}
+		}
+		if typeNum == _Container {
+			typeNum, size, newOffset, err = d.decodeCtrlData(newOffset)
+			if err != nil {
+				return err
+			}
+		}
+		offset = newOffset
+
+		switch element := element.(type) {
+		case string:
+			if typeNum != _Map {
+				return fmt.Errorf("maxminddb: cannot look up key %q at path element %d: value is of type %s, not map", element, i, typeNum)
+			}
+			for j := uint(0); j < size; j++ {
+				var key []byte
+				key, offset, err = d.decodeKey(offset)
+				if err != nil {
+					return err
+				}
+				if string(key) == element {
+					continue PATH
+				}
+				offset, err = d.nextValueOffset(offset, 1)
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		case int:
+			if typeNum != _Slice {
+				return fmt.Errorf("maxminddb: cannot look up index %d at path element %d: value is of type %s, not array", element, i, typeNum)
+			}
+			if element < 0 || uint(element) >= size {
+				return nil
+			}
+			offset, err = d.nextValueOffset(offset, uint(element))
+			if err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("maxminddb: invalid path element %d (%v): must be a string or an int, not %T", i, element, element)
+		}
+	}
+
+	_, err := d.decode(offset, result, len(path))
+	return err
+}
+
 func (d *decoder) decodeCtrlData(offset uint) (dataType, uint, uint, error) {
 	newOffset := offset + 1
 	if offset >= uint(len(d.buffer)) {
-		return 0, 0, 0, newOffsetError()
+		return 0, 0, 0, newOffsetError(newOffset, uint(len(d.buffer)))
 	}
 	ctrlByte := d.buffer[offset]
 
 	typeNum := dataType(ctrlByte >> 5)
 	if typeNum == _Extended {
 		if newOffset >= uint(len(d.buffer)) {
-			return 0, 0, 0, newOffsetError()
+			return 0, 0, 0, newOffsetError(newOffset+1, uint(len(d.buffer)))
+		}
+		// The type is converted before adding 7 so that large values do
+		// not wrap around to one of the basic types.
+		typeNum = dataType(d.buffer[newOffset]) + 7
+		if typeNum < _Int32 || typeNum > _Float32 {
+			return 0, 0, 0, newInvalidDatabaseError(
+				"the MaxMind DB file's data section contains bad data (unknown extended type %d at offset %d)",
+				int(typeNum),
+				offset,
+			)
 		}
-		typeNum = dataType(d.buffer[newOffset] + 7)
 		newOffset++
 	}
 
@@ -89,7 +379,7 @@ func (d *decoder) sizeFromCtrlByte(ctrlByte byte, offset uint, typeNum dataType)
 	bytesToRead = size - 28
 	newOffset := offset + bytesToRead
 	if newOffset > uint(len(d.buffer)) {
-		return 0, 0, newOffsetError()
+		return 0, 0, newOffsetError(newOffset, uint(len(d.buffer)))
 	}
 	if size == 29 {
 		return 29 + uint(d.buffer[offset]), offset + 1, nil
@@ -129,7 +419,7 @@ func (d *decoder) decodeFromType(
 
 	// For the remaining types, size is the byte size
 	if offset+size > uint(len(d.buffer)) {
-		return 0, newOffsetError()
+		return 0, newOffsetError(offset+size, uint(len(d.buffer)))
 	}
 	switch dtype {
 	case _Bytes:
@@ -150,11 +440,33 @@ func (d *decoder) decodeFromType(
 		return d.unmarshalUint(size, offset, result, 64)
 	case _Uint128:
 		return d.unmarshalUint128(size, offset, result)
+	case _Container:
+		return d.unmarshalContainer(size, offset, result, depth)
 	default:
 		return 0, newInvalidDatabaseError("unknown type: %d", dtype)
 	}
 }
 
+// unmarshalContainer decodes the value wrapped in a data cache container.
+// The size of a container is the number of bytes of its contents, which is
+// the first value that is decoded.
+func (d *decoder) unmarshalContainer(size uint, offset uint, result reflect.Value, depth int) (uint, error) {
+	end := offset + size
+	newOffset, err := d.decode(offset, result, depth)
+	if err != nil {
+		return 0, err
+	}
+	if newOffset > end {
+		return 0, newInvalidDatabaseError(
+			"the MaxMind DB file's data section contains bad data (container of %v bytes at offset %v holds a value of %v bytes)",
+			size,
+			offset,
+			newOffset-offset,
+		)
+	}
+	return end, nil
+}
+
 func (d *decoder) unmarshalBool(size uint, offset uint, result reflect.Value) (uint, error) {
 	if size > 1 {
 		return 0, newInvalidDatabaseError("the MaxMind DB file's data section contains bad data (bool size of %v)", size)
@@ -204,7 +516,12 @@ func (d *decoder) indirect(result reflect.Value) reflect.Value {
 	return result
 }
 
-var sliceType = reflect.TypeOf([]byte{})
+var (
+	sliceType             = reflect.TypeOf([]byte{})
+	ipType                = reflect.TypeOf(net.IP{})
+	stringType            = reflect.TypeOf("")
+	binaryUnmarshalerType = reflect.TypeOf((*encoding.BinaryUnmarshaler)(nil)).Elem()
+)
 
 func (d *decoder) unmarshalBytes(size uint, offset uint, result reflect.Value) (uint, error) {
 	value, newOffset, err := d.decodeBytes(size, offset)
@@ -217,6 +534,20 @@ func (d *decoder) unmarshalBytes(size uint, offset uint, result reflect.Value) (
 			result.SetBytes(value)
 			return newOffset, nil
 		}
+		// A net.IP only receives values that have the length of an IP
+		// address.
+		if result.Type() == ipType && (size == net.IPv4len || size == net.IPv6len) {
+			result.SetBytes(value)
+			return newOffset, nil
+		}
+	case reflect.Array:
+		// A byte array only receives values of its length.
+		if result.Type().Elem().Kind() == reflect.Uint8 && result.Len() == len(value) {
+			for i, b := range value {
+				result.Index(i).SetUint(uint64(b))
+			}
+			return newOffset, nil
+		}
 	case reflect.Interface:
 		if result.NumMethod() == 0 {
 			result.Set(reflect.ValueOf(value))
@@ -291,13 +622,13 @@ func (d *decoder) unmarshalInt32(size uint, offset uint, result reflect.Value) (
 		}
 	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
 		n := uint64(value)
-		if !result.OverflowUint(n) {
+		if value >= 0 && !result.OverflowUint(n) {
 			result.SetUint(n)
 			return newOffset, nil
 		}
 	case reflect.Interface:
 		if result.NumMethod() == 0 {
-			result.Set(reflect.ValueOf(value))
+			result.Set(reflect.ValueOf(int32(value)))
 			return newOffset, nil
 		}
 	}
@@ -315,8 +646,18 @@ func (d *decoder) unmarshalMap(
 	default:
 		return 0, newUnmarshalTypeError("map", result.Type())
 	case reflect.Struct:
-		return d.decodeStruct(size, offset, result, depth)
+		return d.decodeStruct(size, offset, result, depth, d.strictDecoding, nil)
 	case reflect.Map:
+		// Map keys are strings in the database, so map types with keys of
+		// other kinds than strings and integers, which are parsed from
+		// the strings, cannot be decoded into.
+		switch result.Type().Key().Kind() {
+		case reflect.String,
+			reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+			reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		default:
+			return 0, newUnmarshalTypeError("map", result.Type())
+		}
 		return d.decodeMap(size, offset, result, depth)
 	case reflect.Interface:
 		if result.NumMethod() == 0 {
@@ -330,7 +671,7 @@ func (d *decoder) unmarshalMap(
 }
 
 func (d *decoder) unmarshalPointer(size uint, offset uint, result reflect.Value, depth int) (uint, error) {
-	pointer, newOffset, err := d.decodePointer(size, offset)
+	pointer, newOffset, err := d.followPointer(size, offset)
 	if err != nil {
 		return 0, err
 	}
@@ -347,6 +688,11 @@ func (d *decoder) unmarshalSlice(
 	switch result.Kind() {
 	case reflect.Slice:
 		return d.decodeSlice(size, offset, result, depth)
+	case reflect.Array:
+		if d.strictArrays && size != uint(result.Len()) {
+			return 0, newUnmarshalTypeError(fmt.Sprintf("array of %d elements", size), result.Type())
+		}
+		return d.decodeArray(size, offset, result, depth)
 	case reflect.Interface:
 		if result.NumMethod() == 0 {
 			a := []interface{}{}
@@ -391,8 +737,9 @@ func (d *decoder) unmarshalUint(size uint, offset uint, result reflect.Value, ui
 
 	switch result.Kind() {
 	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		// Values above math.MaxInt64 would wrap around to negative ones.
 		n := int64(value)
-		if !result.OverflowInt(n) {
+		if value <= math.MaxInt64 && !result.OverflowInt(n) {
 			result.SetInt(n)
 			return newOffset, nil
 		}
@@ -403,7 +750,16 @@ func (d *decoder) unmarshalUint(size uint, offset uint, result reflect.Value, ui
 		}
 	case reflect.Interface:
 		if result.NumMethod() == 0 {
-			result.Set(reflect.ValueOf(value))
+			// Keep the width of the database type so that the value can
+			// be told apart from, and re-encoded as, the original.
+			switch uintType {
+			case 16:
+				result.Set(reflect.ValueOf(uint16(value)))
+			case 32:
+				result.Set(reflect.ValueOf(uint32(value)))
+			default:
+				result.Set(reflect.ValueOf(value))
+			}
 			return newOffset, nil
 		}
 	}
@@ -427,6 +783,20 @@ func (d *decoder) unmarshalUint128(size uint, offset uint, result reflect.Value)
 			result.Set(reflect.ValueOf(*value))
 			return newOffset, nil
 		}
+	case reflect.Array:
+		// A [16]byte receives the big-endian representation of the value.
+		if result.Type().Elem().Kind() == reflect.Uint8 && result.Len() == 16 {
+			raw := d.buffer[offset:newOffset]
+			start := 16 - len(raw)
+			for i := 0; i < 16; i++ {
+				var b byte
+				if i >= start {
+					b = raw[i-start]
+				}
+				result.Index(i).SetUint(uint64(b))
+			}
+			return newOffset, nil
+		}
 	case reflect.Interface:
 		if result.NumMethod() == 0 {
 			result.Set(reflect.ValueOf(value))
@@ -459,6 +829,10 @@ func (d *decoder) decodeFloat32(size uint, offset uint) (float32, uint, error) {
 	return math.Float32frombits(bits), newOffset, nil
 }
 
+// decodeInt decodes an int32 of size bytes. As in the MaxMind DB
+// specification and the other readers, a value shorter than four bytes is
+// padded with zeros rather than sign extended, e.g., a single 0xff byte is
+// 255. A negative value therefore always takes four bytes.
 func (d *decoder) decodeInt(size uint, offset uint) (int, uint, error) {
 	newOffset := offset + size
 	var val int32
@@ -477,7 +851,10 @@ func (d *decoder) decodeMap(
 	if result.IsNil() {
 		result.Set(reflect.MakeMap(result.Type()))
 	}
-
+	// SetMapIndex copies the value, so one is enough for all the entries.
+	value := reflect.New(result.Type().Elem())
+	zero := reflect.Zero(result.Type().Elem())
+	keyType := result.Type().Key()
 	for i := uint(0); i < size; i++ {
 		var key []byte
 		var err error
@@ -487,16 +864,75 @@ func (d *decoder) decodeMap(
 			return 0, err
 		}
 
-		value := reflect.New(result.Type().Elem())
+		keyValue, err := d.mapKey(key, keyType)
+		if err != nil {
+			return 0, err
+		}
+		value.Elem().Set(zero)
+		d.pushKey(key)
 		offset, err = d.decode(offset, value, depth)
+		d.popKey()
 		if err != nil {
 			return 0, err
 		}
-		result.SetMapIndex(reflect.ValueOf(string(key)), value.Elem())
+		result.SetMapIndex(keyValue, value.Elem())
 	}
 	return offset, nil
 }
 
+// mapKey returns key as a key of type keyType. Keys of a named string type,
+// e.g., map[LangCode]string, need a conversion, and keys of an integer type,
+// e.g., map[int]string, are parsed as decimal numbers.
+func (d *decoder) mapKey(key []byte, keyType reflect.Type) (reflect.Value, error) {
+	switch keyType.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(string(key), 10, keyType.Bits())
+		if err != nil {
+			return reflect.Value{}, newUnmarshalTypeError(string(key), keyType)
+		}
+		return reflect.ValueOf(n).Convert(keyType), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(string(key), 10, keyType.Bits())
+		if err != nil {
+			return reflect.Value{}, newUnmarshalTypeError(string(key), keyType)
+		}
+		return reflect.ValueOf(n).Convert(keyType), nil
+	}
+	keyValue := reflect.ValueOf(d.intern(key))
+	if keyType != stringType {
+		keyValue = keyValue.Convert(keyType)
+	}
+	return keyValue, nil
+}
+
+// deleteStaleKeys deletes the keys of m which are not among the keys of the
+// size entries of the map at offset.
+func (d *decoder) deleteStaleKeys(m reflect.Value, offset uint, size uint) error {
+	keyType := m.Type().Key()
+	keys := make(map[interface{}]bool, size)
+	for i := uint(0); i < size; i++ {
+		key, valueOffset, err := d.decodeKey(offset)
+		if err != nil {
+			return err
+		}
+		keyValue, err := d.mapKey(key, keyType)
+		if err != nil {
+			return err
+		}
+		keys[keyValue.Interface()] = true
+		offset, err = d.nextValueOffset(valueOffset, 1)
+		if err != nil {
+			return err
+		}
+	}
+	for _, key := range m.MapKeys() {
+		if !keys[key.Interface()] {
+			m.SetMapIndex(key, reflect.Value{})
+		}
+	}
+	return nil
+}
+
 func (d *decoder) decodePointer(
 	size uint,
 	offset uint,
@@ -504,7 +940,7 @@ func (d *decoder) decodePointer(
 	pointerSize := ((size >> 3) & 0x3) + 1
 	newOffset := offset + pointerSize
 	if newOffset > uint(len(d.buffer)) {
-		return 0, 0, newOffsetError()
+		return 0, 0, newOffsetError(newOffset, uint(len(d.buffer)))
 	}
 	pointerBytes := d.buffer[offset:newOffset]
 	var prefix uint
@@ -532,6 +968,43 @@ func (d *decoder) decodePointer(
 	return pointer, newOffset, nil
 }
 
+// followPointer decodes the pointer whose data starts at offset and, if it
+// points to another pointer, follows the chain until it reaches a value that
+// is not a pointer. It returns the offset of that value along with the offset
+// following the original pointer. An InvalidDatabaseError is returned if the
+// chain is longer than the maximum pointer depth, e.g., because it points
+// back to itself.
+func (d *decoder) followPointer(size uint, offset uint) (uint, uint, error) {
+	pointer, newOffset, err := d.decodePointer(size, offset)
+	if err != nil {
+		return 0, 0, err
+	}
+	maxDepth := d.maxPointerDepth
+	if maxDepth == 0 {
+		maxDepth = defaultMaxPointerDepth
+	}
+	for depth := 1; ; depth++ {
+		typeNum, size, dataOffset, err := d.decodeCtrlData(pointer)
+		if err != nil {
+			return 0, 0, err
+		}
+		if typeNum != _Pointer {
+			return pointer, newOffset, nil
+		}
+		if depth >= maxDepth {
+			return 0, 0, newInvalidDatabaseError(
+				"exceeded maximum pointer depth of %d at offset %d; database is likely corrupt",
+				maxDepth,
+				offset,
+			)
+		}
+		pointer, _, err = d.decodePointer(size, dataOffset)
+		if err != nil {
+			return 0, 0, err
+		}
+	}
+}
+
 func (d *decoder) decodeSlice(
 	size uint,
 	offset uint,
@@ -549,72 +1022,340 @@ func (d *decoder) decodeSlice(
 	return offset, nil
 }
 
+func (d *decoder) decodeArray(
+	size uint,
+	offset uint,
+	result reflect.Value,
+	depth int,
+) (uint, error) {
+	// Elements of the Go array past the end of the database array are set to
+	// their zero value and database elements that do not fit are skipped.
+	for i := 0; i < result.Len(); i++ {
+		if i >= int(size) {
+			result.Index(i).Set(reflect.Zero(result.Type().Elem()))
+			continue
+		}
+		var err error
+		offset, err = d.decode(offset, result.Index(i), depth)
+		if err != nil {
+			return 0, err
+		}
+	}
+	if size > uint(result.Len()) {
+		return d.nextValueOffset(offset, size-uint(result.Len()))
+	}
+	return offset, nil
+}
+
 func (d *decoder) decodeString(size uint, offset uint) (string, uint, error) {
 	newOffset := offset + size
-	return string(d.buffer[offset:newOffset]), newOffset, nil
+	if err := d.checkUTF8(offset, newOffset); err != nil {
+		return "", 0, err
+	}
+	return d.intern(d.buffer[offset:newOffset]), newOffset, nil
+}
+
+// checkUTF8 returns an error if the decoder validates UTF-8 and the string
+// data from offset to end is not valid UTF-8.
+func (d *decoder) checkUTF8(offset uint, end uint) error {
+	if d.validateUTF8 && !utf8.Valid(d.buffer[offset:end]) {
+		return newInvalidDatabaseError(
+			"the MaxMind DB file's data section contains bad data (invalid UTF-8 in the string at offset %d)",
+			offset,
+		)
+	}
+	return nil
+}
+
+// maxInternedStrings bounds the number of strings a decoder interns so that
+// a long-lived LookupDecoder does not end up holding every string in the
+// database.
+const maxInternedStrings = 1 << 16
+
+func (d *decoder) intern(b []byte) string {
+	if d.strings == nil {
+		return string(b)
+	}
+	if s, ok := d.strings[string(b)]; ok {
+		return s
+	}
+	s := string(b)
+	if len(d.strings) < maxInternedStrings {
+		d.strings[s] = s
+	}
+	return s
 }
 
 type fieldsType struct {
 	namedFields     map[string]int
 	anonymousFields []int
+	// timeFields maps the index of each time.Time field tagged with a
+	// time option to the duration of one unit of the integer it is
+	// decoded from.
+	timeFields map[int]time.Duration
+	// durationFields maps the index of each time.Duration field tagged
+	// with a duration option to the unit of the integer it is decoded
+	// from.
+	durationFields map[int]time.Duration
+	// ipFields holds the index of each field tagged with the ip option.
+	ipFields map[int]bool
+}
+
+// timeTagOptions are the maxminddb struct tag options for decoding an integer
+// into a time.Time field, e.g., `maxminddb:"last_seen,unixsec"`.
+var timeTagOptions = map[string]time.Duration{
+	"unixsec":   time.Second,
+	"unixmilli": time.Millisecond,
+}
+
+// durationTagOptions are the maxminddb struct tag options for the unit of the
+// integer a time.Duration field is decoded from, e.g.,
+// `maxminddb:"ttl,seconds"`. Without an option, the integer is in
+// nanoseconds, like a time.Duration.
+var durationTagOptions = map[string]time.Duration{
+	"seconds": time.Second,
+	"nanos":   time.Nanosecond,
 }
 
+var (
+	timeType     = reflect.TypeOf(time.Time{})
+	durationType = reflect.TypeOf(time.Duration(0))
+)
+
 var (
 	fieldMap   = map[reflect.Type]*fieldsType{}
 	fieldMapMu sync.RWMutex
 )
 
-func (d *decoder) decodeStruct(
-	size uint,
+// decodeTime decodes the integer at offset into result, which should be a
+// time.Time or a pointer to one. The integer is the number of units since the
+// Unix epoch. If result is of another type, the value is decoded as usual.
+func (d *decoder) decodeTime(
 	offset uint,
 	result reflect.Value,
+	unit time.Duration,
 	depth int,
 ) (uint, error) {
-	resultType := result.Type()
+	if t := result.Type(); t != timeType && (t.Kind() != reflect.Ptr || t.Elem() != timeType) {
+		return d.decode(offset, result, depth)
+	}
+
+	var epoch int64
+	newOffset, err := d.decode(offset, reflect.ValueOf(&epoch), depth)
+	if typeErr, ok := err.(UnmarshalTypeError); ok {
+		return 0, newUnmarshalTypeError(typeErr.Value, result.Type())
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	perSecond := int64(time.Second / unit)
+	value := time.Unix(epoch/perSecond, epoch%perSecond*int64(unit)).UTC()
+	d.indirect(result).Set(reflect.ValueOf(value))
+	return newOffset, nil
+}
+
+// decodeDuration decodes the integer at offset into result, which should be a
+// time.Duration or a pointer to one. The integer is a number of units. If
+// result is of another type, the value is decoded as usual.
+func (d *decoder) decodeDuration(
+	offset uint,
+	result reflect.Value,
+	unit time.Duration,
+	depth int,
+) (uint, error) {
+	if t := result.Type(); t != durationType && (t.Kind() != reflect.Ptr || t.Elem() != durationType) {
+		return d.decode(offset, result, depth)
+	}
 
+	var n int64
+	newOffset, err := d.decode(offset, reflect.ValueOf(&n), depth)
+	if typeErr, ok := err.(UnmarshalTypeError); ok {
+		return 0, newUnmarshalTypeError(typeErr.Value, result.Type())
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	if n > math.MaxInt64/int64(unit) || n < math.MinInt64/int64(unit) {
+		return 0, newUnmarshalTypeError(n, result.Type())
+	}
+	d.indirect(result).SetInt(n * int64(unit))
+	return newOffset, nil
+}
+
+// decodeIP decodes the bytes value at offset, which must be a 4- or 16-byte
+// IP address, into result. The result may be a net.IP, a string, which
+// receives the address in its textual form, an empty interface{}, which
+// receives a net.IP, or a type such as netip.Addr implementing
+// encoding.BinaryUnmarshaler, or a pointer to any of these.
+func (d *decoder) decodeIP(offset uint, result reflect.Value, depth int) (uint, error) {
+	var ip []byte
+	newOffset, err := d.decode(offset, reflect.ValueOf(&ip), depth)
+	if typeErr, ok := err.(UnmarshalTypeError); ok {
+		return 0, newUnmarshalTypeError(typeErr.Value, result.Type())
+	}
+	if err != nil {
+		return 0, err
+	}
+	if len(ip) != net.IPv4len && len(ip) != net.IPv6len {
+		return 0, newUnmarshalTypeError(ip, result.Type())
+	}
+
+	result = d.indirect(result)
+	switch {
+	case result.Type() == ipType:
+		result.SetBytes(ip)
+	case result.Kind() == reflect.String:
+		result.SetString(net.IP(ip).String())
+	case result.Kind() == reflect.Interface && result.NumMethod() == 0:
+		result.Set(reflect.ValueOf(net.IP(ip)))
+	case result.CanAddr() && result.Addr().Type().Implements(binaryUnmarshalerType):
+		u := result.Addr().Interface().(encoding.BinaryUnmarshaler)
+		if err := u.UnmarshalBinary(ip); err != nil {
+			return 0, err
+		}
+	default:
+		return 0, newUnmarshalTypeError(ip, result.Type())
+	}
+	return newOffset, nil
+}
+
+func cachedFields(resultType reflect.Type) *fieldsType {
 	fieldMapMu.RLock()
 	fields, ok := fieldMap[resultType]
 	fieldMapMu.RUnlock()
-	if !ok {
-		numFields := resultType.NumField()
-		namedFields := make(map[string]int, numFields)
-		var anonymous []int
-		for i := 0; i < numFields; i++ {
-			field := resultType.Field(i)
-
-			fieldName := field.Name
-			if tag := field.Tag.Get("maxminddb"); tag != "" {
-				if tag == "-" {
+	if ok {
+		return fields
+	}
+
+	numFields := resultType.NumField()
+	namedFields := make(map[string]int, numFields)
+	var anonymous []int
+	var timeFields map[int]time.Duration
+	var durationFields map[int]time.Duration
+	var ipFields map[int]bool
+	for i := 0; i < numFields; i++ {
+		field := resultType.Field(i)
+
+		fieldName := field.Name
+		named := !field.Anonymous
+		if tag := field.Tag.Get("maxminddb"); tag != "" {
+			if tag == "-" {
+				continue
+			}
+			options := strings.Split(tag, ",")
+			if options[0] != "" {
+				fieldName = options[0]
+				// As with encoding/json, an embedded field with
+				// a name in its tag is not flattened.
+				named = true
+			}
+			for _, option := range options[1:] {
+				if option == "ip" {
+					if ipFields == nil {
+						ipFields = map[int]bool{}
+					}
+					ipFields[i] = true
 					continue
 				}
-				fieldName = tag
-			}
-			if field.Anonymous {
-				anonymous = append(anonymous, i)
-				continue
+				if unit, ok := durationTagOptions[option]; ok {
+					if durationFields == nil {
+						durationFields = map[int]time.Duration{}
+					}
+					durationFields[i] = unit
+					continue
+				}
+				unit, ok := timeTagOptions[option]
+				if !ok {
+					continue
+				}
+				if timeFields == nil {
+					timeFields = map[int]time.Duration{}
+				}
+				timeFields[i] = unit
 			}
-			namedFields[fieldName] = i
 		}
-		fieldMapMu.Lock()
-		fields = &fieldsType{namedFields, anonymous}
-		fieldMap[resultType] = fields
-		fieldMapMu.Unlock()
+		if !named {
+			anonymous = append(anonymous, i)
+			continue
+		}
+		namedFields[fieldName] = i
 	}
+	fieldMapMu.Lock()
+	fields = &fieldsType{namedFields, anonymous, timeFields, durationFields, ipFields}
+	fieldMap[resultType] = fields
+	fieldMapMu.Unlock()
+	return fields
+}
 
-	// This fills in embedded structs
+// hasEmbeddedField returns true if key corresponds to a field of one of the
+// embedded structs of a struct of type resultType.
+func hasEmbeddedField(resultType reflect.Type, fields *fieldsType, key string) bool {
 	for _, i := range fields.anonymousFields {
-		_, err := d.unmarshalMap(size, offset, result.Field(i), depth)
+		fieldType := resultType.Field(i).Type
+		for fieldType.Kind() == reflect.Ptr {
+			fieldType = fieldType.Elem()
+		}
+		if fieldType.Kind() != reflect.Struct {
+			continue
+		}
+		embeddedFields := cachedFields(fieldType)
+		if _, ok := embeddedFields.namedFields[key]; ok {
+			return true
+		}
+		if hasEmbeddedField(fieldType, embeddedFields, key) {
+			return true
+		}
+	}
+	return false
+}
+
+func (d *decoder) decodeStruct(
+	size uint,
+	offset uint,
+	result reflect.Value,
+	depth int,
+	strict bool,
+	only map[string]bool,
+) (uint, error) {
+	resultType := result.Type()
+	fields := cachedFields(resultType)
+
+	// This fills in embedded structs. Keys belonging to the outer struct
+	// are expected here, so the embedded structs are never decoded
+	// strictly.
+	for _, i := range fields.anonymousFields {
+		field := result.Field(i)
+		if field.Kind() == reflect.Ptr && field.IsNil() && !field.CanSet() {
+			return 0, fmt.Errorf(
+				"maxminddb: cannot set embedded pointer to unexported struct type %v",
+				field.Type().Elem(),
+			)
+		}
+		field = d.indirect(field)
+		var err error
+		if field.Kind() == reflect.Struct {
+			_, err = d.decodeStruct(size, offset, field, depth, false, only)
+		} else {
+			_, err = d.unmarshalMap(size, offset, field, depth)
+		}
 		if err != nil {
 			return 0, err
 		}
 	}
 
 	// This handles named fields
+	var (
+		unmappedKeys   []string
+		unmappedOffset uint
+	)
 	for i := uint(0); i < size; i++ {
 		var (
 			err error
 			key []byte
 		)
+		keyOffset := offset
 		key, offset, err = d.decodeKey(offset)
 		if err != nil {
 			return 0, err
@@ -622,7 +1363,22 @@ func (d *decoder) decodeStruct(
 		// The string() does not create a copy due to this compiler
 		// optimization: https://github.com/golang/go/issues/3512
 		j, ok := fields.namedFields[string(key)]
+		if only != nil && !only[string(key)] {
+			// Keys not selected with WithFields are skipped
+			// without being reported as unmapped.
+			offset, err = d.nextValueOffset(offset, 1)
+			if err != nil {
+				return 0, err
+			}
+			continue
+		}
 		if !ok {
+			if strict && !hasEmbeddedField(resultType, fields, string(key)) {
+				if unmappedKeys == nil {
+					unmappedOffset = keyOffset
+				}
+				unmappedKeys = append(unmappedKeys, string(key))
+			}
 			offset, err = d.nextValueOffset(offset, 1)
 			if err != nil {
 				return 0, err
@@ -630,11 +1386,24 @@ func (d *decoder) decodeStruct(
 			continue
 		}
 
-		offset, err = d.decode(offset, result.Field(j), depth)
+		d.pushKey(key)
+		if unit, ok := fields.timeFields[j]; ok {
+			offset, err = d.decodeTime(offset, result.Field(j), unit, depth)
+		} else if unit, ok := fields.durationFields[j]; ok {
+			offset, err = d.decodeDuration(offset, result.Field(j), unit, depth)
+		} else if fields.ipFields[j] {
+			offset, err = d.decodeIP(offset, result.Field(j), depth)
+		} else {
+			offset, err = d.decode(offset, result.Field(j), depth)
+		}
+		d.popKey()
 		if err != nil {
 			return 0, err
 		}
 	}
+	if unmappedKeys != nil {
+		return 0, newUnmappedFieldsError(unmappedKeys, unmappedOffset, resultType)
+	}
 	return offset, nil
 }
 
@@ -675,7 +1444,7 @@ func (d *decoder) decodeKey(offset uint) ([]byte, uint, error) {
 		return nil, 0, err
 	}
 	if typeNum == _Pointer {
-		pointer, ptrOffset, err := d.decodePointer(size, dataOffset)
+		pointer, ptrOffset, err := d.followPointer(size, dataOffset)
 		if err != nil {
 			return nil, 0, err
 		}
@@ -687,11 +1456,27 @@ func (d *decoder) decodeKey(offset uint) ([]byte, uint, error) {
 	}
 	newOffset := dataOffset + size
 	if newOffset > uint(len(d.buffer)) {
-		return nil, 0, newOffsetError()
+		return nil, 0, newOffsetError(newOffset, uint(len(d.buffer)))
+	}
+	if err := d.checkUTF8(dataOffset, newOffset); err != nil {
+		return nil, 0, err
 	}
 	return d.buffer[dataOffset:newOffset], newOffset, nil
 }
 
+// valueSize returns the number of bytes of the value at offset. Unlike
+// nextValueOffset, it checks that the value ends within the buffer.
+func (d *decoder) valueSize(offset uint) (uint, error) {
+	end, err := d.nextValueOffset(offset, 1)
+	if err != nil {
+		return 0, err
+	}
+	if end > uint(len(d.buffer)) {
+		return 0, newOffsetError(end, uint(len(d.buffer)))
+	}
+	return end - offset, nil
+}
+
 // This function is used to skip ahead to the next value without decoding
 // the one at the offset passed in. The size bits have different meanings for
 // different data types
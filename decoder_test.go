@@ -3,12 +3,16 @@ package maxminddb
 import (
 	"encoding/hex"
 	"io/ioutil"
+	"math"
 	"math/big"
+	"net"
 	"reflect"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestBool(t *testing.T) {
@@ -20,6 +24,103 @@ func TestBool(t *testing.T) {
 	validateDecoding(t, bools)
 }
 
+func TestBoolsInMap(t *testing.T) {
+	// A map of {"a": true, "b": "x", "c": false, "d": [false, true],
+	// "e": 1}, where "d" is skipped when decoding into the struct, followed
+	// by a pointer to the true value of "a".
+	input, _ := hex.DecodeString(
+		"e5" + "4161" + "0107" + "4162" + "4178" + "4163" + "0007" +
+			"4164" + "0204" + "0007" + "0107" + "4165" + "a101" + "2003",
+	)
+	d := decoder{buffer: input}
+
+	var result struct {
+		A *bool  `maxminddb:"a"`
+		B string `maxminddb:"b"`
+		C bool   `maxminddb:"c"`
+		E uint16 `maxminddb:"e"`
+	}
+	result.C = true
+	offset, err := d.decode(0, reflect.ValueOf(&result), 0)
+	require.NoError(t, err)
+	assert.Equal(t, uint(len(input)-2), offset)
+	require.NotNil(t, result.A)
+	assert.True(t, *result.A)
+	assert.Equal(t, "x", result.B)
+	assert.False(t, result.C)
+	assert.Equal(t, uint16(1), result.E)
+
+	var m interface{}
+	_, err = d.decode(0, reflect.ValueOf(&m), 0)
+	require.NoError(t, err)
+	assert.Equal(
+		t,
+		map[string]interface{}{
+			"a": true,
+			"b": "x",
+			"c": false,
+			"d": []interface{}{false, true},
+			"e": uint16(1),
+		},
+		m,
+	)
+
+	var pointed bool
+	_, err = d.decode(uint(len(input)-2), reflect.ValueOf(&pointed), 0)
+	require.NoError(t, err)
+	assert.True(t, pointed)
+}
+
+func TestDataCacheContainer(t *testing.T) {
+	// A data cache container of 8 bytes wrapping {"en": "Foo"}.
+	container := "0805" + "e142656e43466f6f"
+	// {"a": <container>, "b": "x"}
+	input, _ := hex.DecodeString("e2" + "4161" + container + "4162" + "4178")
+	d := decoder{buffer: input}
+
+	var m interface{}
+	offset, err := d.decode(0, reflect.ValueOf(&m), 0)
+	require.NoError(t, err)
+	assert.Equal(t, uint(len(input)), offset)
+	assert.Equal(
+		t,
+		map[string]interface{}{"a": map[string]interface{}{"en": "Foo"}, "b": "x"},
+		m,
+	)
+
+	var names struct {
+		A struct {
+			En string `maxminddb:"en"`
+		} `maxminddb:"a"`
+	}
+	_, err = d.decode(0, reflect.ValueOf(&names), 0)
+	require.NoError(t, err)
+	assert.Equal(t, "Foo", names.A.En)
+
+	// The container is skipped as a whole when its key is not in the
+	// struct.
+	var b struct {
+		B string `maxminddb:"b"`
+	}
+	_, err = d.decode(0, reflect.ValueOf(&b), 0)
+	require.NoError(t, err)
+	assert.Equal(t, "x", b.B)
+
+	var en string
+	require.NoError(t, d.decodePath(0, []interface{}{"a", "en"}, reflect.ValueOf(&en)))
+	assert.Equal(t, "Foo", en)
+
+	// A container of 4 bytes cannot hold the 8 byte map.
+	input, _ = hex.DecodeString("0405" + "e142656e43466f6f")
+	d = decoder{buffer: input}
+	_, err = d.decode(0, reflect.ValueOf(&m), 0)
+	assert.EqualError(
+		t,
+		err,
+		"the MaxMind DB file's data section contains bad data (container of 4 bytes at offset 2 holds a value of 8 bytes)",
+	)
+}
+
 func TestDouble(t *testing.T) {
 	doubles := map[string]interface{}{
 		"680000000000000000": 0.0,
@@ -49,22 +150,86 @@ func TestFloat(t *testing.T) {
 	validateDecoding(t, floats)
 }
 
+func TestFloatIntoFloat32AndFloat64(t *testing.T) {
+	// 3.14 as a 32-bit float.
+	input, _ := hex.DecodeString("04084048f5c3")
+	d := decoder{buffer: input}
+
+	var f32 float32
+	_, err := d.decode(0, reflect.ValueOf(&f32), 0)
+	require.Nil(t, err)
+	assert.Equal(t, float32(3.14), f32)
+
+	var f64 float64
+	_, err = d.decode(0, reflect.ValueOf(&f64), 0)
+	require.Nil(t, err)
+	assert.InDelta(t, 3.14, f64, 1e-6)
+
+	var result struct {
+		F *float64 `maxminddb:"f"`
+	}
+	input, _ = hex.DecodeString("e1" + "4166" + "04084048f5c3")
+	d = decoder{buffer: input}
+	_, err = d.decode(0, reflect.ValueOf(&result), 0)
+	require.Nil(t, err)
+	require.NotNil(t, result.F)
+	assert.InDelta(t, 3.14, *result.F, 1e-6)
+}
+
 func TestInt32(t *testing.T) {
-	int32 := map[string]interface{}{
-		"0001":         0,
-		"0401ffffffff": -1,
-		"0101ff":       255,
-		"0401ffffff01": -255,
-		"020101f4":     500,
-		"0401fffffe0c": -500,
-		"0201ffff":     65535,
-		"0401ffff0001": -65535,
-		"0301ffffff":   16777215,
-		"0401ff000001": -16777215,
-		"04017fffffff": 2147483647,
-		"040180000001": -2147483647,
-	}
-	validateDecoding(t, int32)
+	int32s := map[string]interface{}{
+		"0001":         int32(0),
+		"0401ffffffff": int32(-1),
+		"0101ff":       int32(255),
+		"0401ffffff01": int32(-255),
+		"010180":       int32(128),
+		"0401ffffff80": int32(-128),
+		"020101f4":     int32(500),
+		"0401fffffe0c": int32(-500),
+		"0201ffff":     int32(65535),
+		"0401ffff0001": int32(-65535),
+		"02018000":     int32(32768),
+		"0401ffff8000": int32(-32768),
+		"0301ffffff":   int32(16777215),
+		"0401ff000001": int32(-16777215),
+		"04017fffffff": int32(2147483647),
+		"040180000001": int32(-2147483647),
+		"040180000000": int32(-2147483648),
+	}
+	validateDecoding(t, int32s)
+}
+
+func TestInt32IntoSmallerTypes(t *testing.T) {
+	// {"a": -1, "b": -128, "c": -32768, "d": 128}
+	input, _ := hex.DecodeString(
+		"e4" +
+			"4161" + "0401ffffffff" +
+			"4162" + "0401ffffff80" +
+			"4163" + "0401ffff8000" +
+			"4164" + "010180",
+	)
+	d := decoder{buffer: input}
+
+	var result struct {
+		A int8  `maxminddb:"a"`
+		B int8  `maxminddb:"b"`
+		C int16 `maxminddb:"c"`
+		D int16 `maxminddb:"d"`
+	}
+	_, err := d.decode(0, reflect.ValueOf(&result), 0)
+	require.Nil(t, err)
+	assert.Equal(t, int8(-1), result.A)
+	assert.Equal(t, int8(-128), result.B)
+	assert.Equal(t, int16(-32768), result.C)
+	assert.Equal(t, int16(128), result.D)
+
+	// A one byte value is not sign extended, so 0x80 does not fit in an
+	// int8.
+	var overflow struct {
+		D int8 `maxminddb:"d"`
+	}
+	_, err = d.decode(0, reflect.ValueOf(&overflow), 0)
+	assert.Equal(t, newUnmarshalTypeError(128, reflect.TypeOf(int8(0))), err)
 }
 
 func TestMap(t *testing.T) {
@@ -124,28 +289,55 @@ func TestByte(t *testing.T) {
 	validateDecoding(t, b)
 }
 
+type testID [16]byte
+
+func TestBytesIntoByteArray(t *testing.T) {
+	blob := "000102030405060708090a0b0c0d0e0f"
+	input, _ := hex.DecodeString("90" + blob)
+	d := decoder{buffer: input}
+
+	var id [16]byte
+	_, err := d.decode(0, reflect.ValueOf(&id), 0)
+	require.Nil(t, err)
+	assert.Equal(t, blob, hex.EncodeToString(id[:]))
+
+	var named testID
+	_, err = d.decode(0, reflect.ValueOf(&named), 0)
+	require.Nil(t, err)
+	assert.Equal(t, testID(id), named)
+
+	var short [8]byte
+	_, err = d.decode(0, reflect.ValueOf(&short), 0)
+	assert.Equal(t, newUnmarshalTypeError(id[:], reflect.TypeOf(short)), err)
+	assert.Equal(t, [8]byte{}, short)
+
+	var ints [16]int
+	_, err = d.decode(0, reflect.ValueOf(&ints), 0)
+	assert.IsType(t, UnmarshalTypeError{}, err)
+}
+
 func TestUint16(t *testing.T) {
-	uint16 := map[string]interface{}{
-		"a0":     uint64(0),
-		"a1ff":   uint64(255),
-		"a201f4": uint64(500),
-		"a22a78": uint64(10872),
-		"a2ffff": uint64(65535),
+	uint16s := map[string]interface{}{
+		"a0":     uint16(0),
+		"a1ff":   uint16(255),
+		"a201f4": uint16(500),
+		"a22a78": uint16(10872),
+		"a2ffff": uint16(65535),
 	}
-	validateDecoding(t, uint16)
+	validateDecoding(t, uint16s)
 }
 
 func TestUint32(t *testing.T) {
-	uint32 := map[string]interface{}{
-		"c0":         uint64(0),
-		"c1ff":       uint64(255),
-		"c201f4":     uint64(500),
-		"c22a78":     uint64(10872),
-		"c2ffff":     uint64(65535),
-		"c3ffffff":   uint64(16777215),
-		"c4ffffffff": uint64(4294967295),
+	uint32s := map[string]interface{}{
+		"c0":         uint32(0),
+		"c1ff":       uint32(255),
+		"c201f4":     uint32(500),
+		"c22a78":     uint32(10872),
+		"c2ffff":     uint32(65535),
+		"c3ffffff":   uint32(16777215),
+		"c4ffffffff": uint32(4294967295),
 	}
-	validateDecoding(t, uint32)
+	validateDecoding(t, uint32s)
 }
 
 func TestUint64(t *testing.T) {
@@ -167,6 +359,89 @@ func TestUint64(t *testing.T) {
 	validateDecoding(t, uints)
 }
 
+func TestDecodeIntegersIntoSignedTypes(t *testing.T) {
+	decode := func(input string, result interface{}) error {
+		inputBytes, err := hex.DecodeString(input)
+		require.NoError(t, err)
+		d := decoder{buffer: inputBytes}
+		_, err = d.decode(0, reflect.ValueOf(result), 0)
+		return err
+	}
+
+	var i int
+	var i64 int64
+	var i32 int32
+	var u64 uint64
+
+	// int32 -2147483648
+	require.NoError(t, decode("040180000000", &i))
+	assert.Equal(t, math.MinInt32, i)
+	require.NoError(t, decode("040180000000", &i64))
+	assert.Equal(t, int64(math.MinInt32), i64)
+	// int32 -1
+	require.NoError(t, decode("0401ffffffff", &i64))
+	assert.Equal(t, int64(-1), i64)
+	assert.EqualError(
+		t,
+		decode("0401ffffffff", &u64),
+		"maxminddb: cannot unmarshal -1 into type uint64",
+	)
+
+	// uint64 9223372036854775807
+	require.NoError(t, decode("08027fffffffffffffff", &i64))
+	assert.Equal(t, int64(math.MaxInt64), i64)
+	// uint64 9223372036854775808
+	assert.EqualError(
+		t,
+		decode("08028000000000000000", &i64),
+		"maxminddb: cannot unmarshal 9223372036854775808 into type int64",
+	)
+	assert.EqualError(
+		t,
+		decode("0802ffffffffffffffff", &i),
+		"maxminddb: cannot unmarshal 18446744073709551615 into type int",
+	)
+	// uint64 2147483648
+	assert.EqualError(
+		t,
+		decode("040280000000", &i32),
+		"maxminddb: cannot unmarshal 2147483648 into type int32",
+	)
+	// uint64 2147483647
+	require.NoError(t, decode("04027fffffff", &i32))
+	assert.Equal(t, int32(math.MaxInt32), i32)
+}
+
+func TestDecodeMixedIntegerWidthsToInterface(t *testing.T) {
+	// A map of six keys holding 100 as a uint16, uint32, uint64, int32 and
+	// uint128 along with a true boolean.
+	input, _ := hex.DecodeString(
+		"e6" + "41" + "61" + "a164" + "41" + "62" + "c164" + "41" + "63" + "010264" +
+			"41" + "64" + "010164" + "41" + "65" + "010364" + "41" + "66" + "0107",
+	)
+	d := decoder{buffer: input}
+
+	var result interface{}
+	_, err := d.decode(0, reflect.ValueOf(&result), 0)
+	require.NoError(t, err)
+
+	record := result.(map[string]interface{})
+	assert.IsType(t, uint16(0), record["a"])
+	assert.IsType(t, uint32(0), record["b"])
+	assert.IsType(t, uint64(0), record["c"])
+	assert.IsType(t, int32(0), record["d"])
+	assert.IsType(t, &big.Int{}, record["e"])
+	assert.IsType(t, false, record["f"])
+	assert.Equal(t, map[string]interface{}{
+		"a": uint16(100),
+		"b": uint32(100),
+		"c": uint64(100),
+		"d": int32(100),
+		"e": big.NewInt(100),
+		"f": true,
+	}, record)
+}
+
 // Dedup with above somehow
 func TestUint128(t *testing.T) {
 	ctrlByte := "03"
@@ -188,6 +463,186 @@ func TestUint128(t *testing.T) {
 	validateDecoding(t, uints)
 }
 
+func TestUint128IntoBigIntAndArray(t *testing.T) {
+	// 2^64 + 1 does not fit in a uint64.
+	input, _ := hex.DecodeString("0903010000000000000001")
+	d := decoder{buffer: input}
+
+	var result struct {
+		BigInt *big.Int
+		Value  big.Int
+		Array  [16]byte
+	}
+	expected := new(big.Int).Add(powBigInt(big.NewInt(2), 64), big.NewInt(1))
+
+	_, err := d.decode(0, reflect.ValueOf(&result.BigInt), 0)
+	require.Nil(t, err)
+	assert.Equal(t, 0, expected.Cmp(result.BigInt))
+
+	_, err = d.decode(0, reflect.ValueOf(&result.Value), 0)
+	require.Nil(t, err)
+	assert.Equal(t, 0, expected.Cmp(&result.Value))
+
+	_, err = d.decode(0, reflect.ValueOf(&result.Array), 0)
+	require.Nil(t, err)
+	assert.Equal(t, [16]byte{7: 1, 15: 1}, result.Array)
+
+	var small [8]byte
+	_, err = d.decode(0, reflect.ValueOf(&small), 0)
+	assert.IsType(t, UnmarshalTypeError{}, err)
+
+	var u uint64
+	_, err = d.decode(0, reflect.ValueOf(&u), 0)
+	assert.IsType(t, UnmarshalTypeError{}, err)
+
+	input, _ = hex.DecodeString("1003" + strings.Repeat("ff", 16))
+	d = decoder{buffer: input}
+	_, err = d.decode(0, reflect.ValueOf(&result.Array), 0)
+	require.Nil(t, err)
+	for _, b := range result.Array {
+		assert.Equal(t, byte(0xff), b)
+	}
+}
+
+func TestDecodeIP(t *testing.T) {
+	// {"gateway": 2001:db8::1 as 16 bytes, "v4": 1.2.3.4 as 4 bytes,
+	// "short": 3 bytes}
+	input, _ := hex.DecodeString(
+		"e3" +
+			"47" + hex.EncodeToString([]byte("gateway")) + "90" + "20010db8000000000000000000000001" +
+			"42" + hex.EncodeToString([]byte("v4")) + "84" + "01020304" +
+			"45" + hex.EncodeToString([]byte("short")) + "83" + "010203",
+	)
+	d := decoder{buffer: input}
+
+	var tagged struct {
+		Gateway net.IP `maxminddb:"gateway,ip"`
+		V4      string `maxminddb:"v4,ip"`
+	}
+	_, err := d.decode(0, reflect.ValueOf(&tagged), 0)
+	require.Nil(t, err)
+	assert.Equal(t, net.ParseIP("2001:db8::1"), tagged.Gateway)
+	assert.Equal(t, "1.2.3.4", tagged.V4)
+
+	var generic struct {
+		V4 interface{} `maxminddb:"v4,ip"`
+	}
+	_, err = d.decode(0, reflect.ValueOf(&generic), 0)
+	require.Nil(t, err)
+	assert.Equal(t, net.IP{1, 2, 3, 4}, generic.V4)
+
+	var untagged struct {
+		Gateway *net.IP `maxminddb:"gateway"`
+		V4      net.IP  `maxminddb:"v4"`
+		Short   []byte  `maxminddb:"short"`
+	}
+	_, err = d.decode(0, reflect.ValueOf(&untagged), 0)
+	require.Nil(t, err)
+	require.NotNil(t, untagged.Gateway)
+	assert.Equal(t, "2001:db8::1", untagged.Gateway.String())
+	assert.Equal(t, "1.2.3.4", untagged.V4.String())
+	assert.Equal(t, []byte{1, 2, 3}, untagged.Short)
+
+	var short struct {
+		Short net.IP `maxminddb:"short"`
+	}
+	_, err = d.decode(0, reflect.ValueOf(&short), 0)
+	assert.Equal(t, newUnmarshalTypeError([]byte{1, 2, 3}, reflect.TypeOf(net.IP{})), err)
+
+	var shortTagged struct {
+		Short string `maxminddb:"short,ip"`
+	}
+	_, err = d.decode(0, reflect.ValueOf(&shortTagged), 0)
+	assert.Equal(t, newUnmarshalTypeError([]byte{1, 2, 3}, reflect.TypeOf("")), err)
+
+	var wrongType struct {
+		Gateway int `maxminddb:"gateway,ip"`
+	}
+	_, err = d.decode(0, reflect.ValueOf(&wrongType), 0)
+	assert.EqualError(t, err, "maxminddb: cannot unmarshal [32 1 13 184 0 0 0 0 0 0 0 0 0 0 0 1] into type int")
+}
+
+func TestDecodeTime(t *testing.T) {
+	// {"ms": 1500000000123 (uint64), "s": 1500000000 (uint32), "neg": -1 (int32)}
+	input, _ := hex.DecodeString(
+		"e3" +
+			"426d73" + "0602" + "015d3ef7987b" +
+			"4173" + "c4" + "59682f00" +
+			"436e6567" + "0401" + "ffffffff",
+	)
+	d := decoder{buffer: input}
+
+	var result struct {
+		Milli    time.Time  `maxminddb:"ms,unixmilli"`
+		Sec      *time.Time `maxminddb:"s,unixsec"`
+		Negative time.Time  `maxminddb:"neg,unixsec"`
+	}
+	_, err := d.decode(0, reflect.ValueOf(&result), 0)
+	require.Nil(t, err)
+	assert.Equal(t, time.Date(2017, time.July, 14, 2, 40, 0, 123000000, time.UTC), result.Milli)
+	require.NotNil(t, result.Sec)
+	assert.Equal(t, time.Date(2017, time.July, 14, 2, 40, 0, 0, time.UTC), *result.Sec)
+	assert.Equal(t, time.Date(1969, time.December, 31, 23, 59, 59, 0, time.UTC), result.Negative)
+
+	var raw struct {
+		Milli uint64 `maxminddb:"ms"`
+		Sec   uint   `maxminddb:"s,unixsec"`
+	}
+	_, err = d.decode(0, reflect.ValueOf(&raw), 0)
+	require.Nil(t, err)
+	assert.Equal(t, uint64(1500000000123), raw.Milli)
+	assert.Equal(t, uint(1500000000), raw.Sec)
+
+	var untagged struct {
+		Sec time.Time `maxminddb:"s"`
+	}
+	_, err = d.decode(0, reflect.ValueOf(&untagged), 0)
+	assert.IsType(t, UnmarshalTypeError{}, err)
+}
+
+func TestDecodeDuration(t *testing.T) {
+	// {"ttl": 300 (uint16), "def": 1500 (uint32), "ns": 1500 (uint32), "neg": -2 (int32)}
+	input, _ := hex.DecodeString(
+		"e4" +
+			"4374746c" + "a2012c" +
+			"43646566" + "c205dc" +
+			"426e73" + "c205dc" +
+			"436e6567" + "0401" + "fffffffe",
+	)
+	d := decoder{buffer: input}
+
+	var result struct {
+		TTL      time.Duration  `maxminddb:"ttl,seconds"`
+		Default  time.Duration  `maxminddb:"def"`
+		Nanos    *time.Duration `maxminddb:"ns,nanos"`
+		Negative time.Duration  `maxminddb:"neg,seconds"`
+	}
+	_, err := d.decode(0, reflect.ValueOf(&result), 0)
+	require.Nil(t, err)
+	assert.Equal(t, 5*time.Minute, result.TTL)
+	assert.Equal(t, 1500*time.Nanosecond, result.Default)
+	require.NotNil(t, result.Nanos)
+	assert.Equal(t, 1500*time.Nanosecond, *result.Nanos)
+	assert.Equal(t, -2*time.Second, result.Negative)
+
+	// The options do not change how other types are decoded.
+	var raw struct {
+		TTL uint `maxminddb:"ttl,seconds"`
+	}
+	_, err = d.decode(0, reflect.ValueOf(&raw), 0)
+	require.Nil(t, err)
+	assert.Equal(t, uint(300), raw.TTL)
+
+	// {"big": 2^62 (uint64)} overflows a time.Duration in seconds.
+	input, _ = hex.DecodeString("e1" + "43626967" + "0802" + "4000000000000000")
+	d = decoder{buffer: input}
+	var overflow struct {
+		Big time.Duration `maxminddb:"big,seconds"`
+	}
+	_, err = d.decode(0, reflect.ValueOf(&overflow), 0)
+	assert.Equal(t, newUnmarshalTypeError(int64(1)<<62, durationType), err)
+}
+
 // No pow or bit shifting for big int, apparently :-(
 // This is _not_ meant to be a comprehensive power function
 func powBigInt(bi *big.Int, pow uint) *big.Int {
@@ -201,7 +656,7 @@ func powBigInt(bi *big.Int, pow uint) *big.Int {
 func validateDecoding(t *testing.T, tests map[string]interface{}) {
 	for inputStr, expected := range tests {
 		inputBytes, _ := hex.DecodeString(inputStr)
-		d := decoder{inputBytes}
+		d := decoder{buffer: inputBytes}
 
 		var result interface{}
 		_, err := d.decode(0, reflect.ValueOf(&result), 0)
@@ -217,7 +672,7 @@ func validateDecoding(t *testing.T, tests map[string]interface{}) {
 func TestPointers(t *testing.T) {
 	bytes, err := ioutil.ReadFile("test-data/test-data/maps-with-pointers.raw")
 	assert.Nil(t, err)
-	d := decoder{bytes}
+	d := decoder{buffer: bytes}
 
 	expected := map[uint]map[string]string{
 		0:  {"long_key": "long_value1"},
@@ -238,3 +693,405 @@ func TestPointers(t *testing.T) {
 	}
 
 }
+
+func TestSelfReferentialPointer(t *testing.T) {
+	tests := map[string]string{
+		// A pointer to itself.
+		"2000": "exceeded maximum pointer depth of 32 at offset 1; database is likely corrupt",
+		// A map whose key is a pointer to itself.
+		"e1200143666f6f": "exceeded maximum pointer depth of 32 at offset 2; database is likely corrupt",
+	}
+	for input, expected := range tests {
+		inputBytes, _ := hex.DecodeString(input)
+		d := decoder{buffer: inputBytes}
+
+		var result interface{}
+		_, err := d.decode(0, reflect.ValueOf(&result), 0)
+		assert.Equal(t, newInvalidDatabaseError(expected), err, input)
+	}
+}
+
+func TestTruncatedData(t *testing.T) {
+	tests := map[string]string{
+		// A string of 4 bytes with 2 bytes of data.
+		"44666f": "unexpected end of database: attempted to read to offset 5 of a 3 byte buffer",
+		// An extended type without its type byte.
+		"01": "unexpected end of database: attempted to read to offset 2 of a 1 byte buffer",
+		// A pointer with only 1 of its 2 bytes.
+		"2800": "unexpected end of database: attempted to read to offset 3 of a 2 byte buffer",
+		// A string whose size needs one more byte than there is.
+		"5d": "unexpected end of database: attempted to read to offset 2 of a 1 byte buffer",
+	}
+	for input, expected := range tests {
+		inputBytes, _ := hex.DecodeString(input)
+		d := decoder{buffer: inputBytes}
+
+		var result interface{}
+		_, err := d.decode(0, reflect.ValueOf(&result), 0)
+		assert.Equal(t, newInvalidDatabaseError(expected), err, input)
+	}
+}
+
+func TestUnknownExtendedType(t *testing.T) {
+	tests := map[string]string{
+		// Type 16, the first unused type.
+		"0009": "the MaxMind DB file's data section contains bad data (unknown extended type 16 at offset 0)",
+		// Type 257, which wraps around to a pointer if added to the
+		// extended byte.
+		"00fa": "the MaxMind DB file's data section contains bad data (unknown extended type 257 at offset 0)",
+		// Type 7, a map, which is not an extended type.
+		"e14161" + "0000": "the MaxMind DB file's data section contains bad data (unknown extended type 7 at offset 3)",
+	}
+	for input, expected := range tests {
+		inputBytes, _ := hex.DecodeString(input)
+		d := decoder{buffer: inputBytes}
+
+		var result interface{}
+		_, err := d.decode(0, reflect.ValueOf(&result), 0)
+		assert.Equal(t, newInvalidDatabaseError(expected), err, input)
+
+		_, err = d.nextValueOffset(0, 1)
+		assert.Equal(t, newInvalidDatabaseError(expected), err, input)
+	}
+}
+
+func TestMaxPointerDepth(t *testing.T) {
+	// A pointer to a pointer to the string "a".
+	input, _ := hex.DecodeString("200220044161")
+
+	d := decoder{buffer: input}
+	var result interface{}
+	_, err := d.decode(0, reflect.ValueOf(&result), 0)
+	require.Nil(t, err)
+	assert.Equal(t, "a", result)
+
+	d = decoder{buffer: input, maxPointerDepth: 1}
+	_, err = d.decode(0, reflect.ValueOf(&result), 0)
+	assert.Equal(
+		t,
+		newInvalidDatabaseError("exceeded maximum pointer depth of 1 at offset 1; database is likely corrupt"),
+		err,
+	)
+}
+
+func TestNestedSlices(t *testing.T) {
+	// [[1.5, 2.5], [], [-3]]
+	input, _ := hex.DecodeString(
+		"0304" +
+			"0204" + "683ff8000000000000" + "684004000000000000" +
+			"0004" +
+			"0104" + "68c008000000000000",
+	)
+	d := decoder{buffer: input}
+
+	var rings [][]float64
+	_, err := d.decode(0, reflect.ValueOf(&rings), 0)
+	require.Nil(t, err)
+	assert.Equal(t, [][]float64{{1.5, 2.5}, {}, {-3}}, rings)
+
+	var pointers []*[]*float64
+	_, err = d.decode(0, reflect.ValueOf(&pointers), 0)
+	require.Nil(t, err)
+	require.Len(t, pointers, 3)
+	require.Len(t, *pointers[0], 2)
+	assert.Equal(t, 1.5, *(*pointers[0])[0])
+	assert.Equal(t, 2.5, *(*pointers[0])[1])
+	assert.Equal(t, []*float64{}, *pointers[1])
+	require.Len(t, *pointers[2], 1)
+	assert.Equal(t, -3.0, *(*pointers[2])[0])
+
+	var arrays [][2]float64
+	_, err = d.decode(0, reflect.ValueOf(&arrays), 0)
+	require.Nil(t, err)
+	assert.Equal(t, [][2]float64{{1.5, 2.5}, {0, 0}, {-3, 0}}, arrays)
+
+	var tooShort [][1]float64
+	_, err = d.decode(0, reflect.ValueOf(&tooShort), 0)
+	require.Nil(t, err)
+	assert.Equal(t, [][1]float64{{1.5}, {0}, {-3}}, tooShort)
+
+	var generic interface{}
+	_, err = d.decode(0, reflect.ValueOf(&generic), 0)
+	require.Nil(t, err)
+	assert.Equal(
+		t,
+		[]interface{}{[]interface{}{1.5, 2.5}, []interface{}{}, []interface{}{-3.0}},
+		generic,
+	)
+}
+
+func TestDecodeIntoArray(t *testing.T) {
+	// {"location": [51.5, -0.5, 10.0], "name": "x"}
+	input, _ := hex.DecodeString(
+		"e2" + "486c6f636174696f6e" + "0304" +
+			"68" + "4049c00000000000" + "68" + "bfe0000000000000" + "68" + "4024000000000000" +
+			"446e616d65" + "4178",
+	)
+
+	type pair struct {
+		Location [2]float64 `maxminddb:"location"`
+		Name     string     `maxminddb:"name"`
+	}
+	type quad struct {
+		Location [4]float64 `maxminddb:"location"`
+		Name     string     `maxminddb:"name"`
+	}
+	type triple struct {
+		Location [3]float64 `maxminddb:"location"`
+		Name     string     `maxminddb:"name"`
+	}
+
+	d := decoder{buffer: input}
+	var p pair
+	_, err := d.decode(0, reflect.ValueOf(&p), 0)
+	require.Nil(t, err)
+	assert.Equal(t, pair{Location: [2]float64{51.5, -0.5}, Name: "x"}, p)
+
+	q := quad{Location: [4]float64{1, 2, 3, 4}}
+	_, err = d.decode(0, reflect.ValueOf(&q), 0)
+	require.Nil(t, err)
+	assert.Equal(t, quad{Location: [4]float64{51.5, -0.5, 10, 0}, Name: "x"}, q)
+
+	d.strictDecoding = true
+	_, err = d.decode(0, reflect.ValueOf(&p), 0)
+	require.Nil(t, err)
+
+	d.strictArrays = true
+	var tr triple
+	_, err = d.decode(0, reflect.ValueOf(&tr), 0)
+	require.Nil(t, err)
+	assert.Equal(t, triple{Location: [3]float64{51.5, -0.5, 10}, Name: "x"}, tr)
+
+	_, err = d.decode(0, reflect.ValueOf(&p), 0)
+	assert.EqualError(t, err, "maxminddb: cannot unmarshal array of 3 elements into type [2]float64")
+	_, err = d.decode(0, reflect.ValueOf(&q), 0)
+	assert.EqualError(t, err, "maxminddb: cannot unmarshal array of 3 elements into type [4]float64")
+}
+
+func TestDecodeReusesMap(t *testing.T) {
+	// {"en": "Foo", "zh": "人"}
+	input, _ := hex.DecodeString("e242656e43466f6f427a6843e4baba")
+	d := decoder{buffer: input}
+
+	names := map[string]string{"de": "stale"}
+	reused := reflect.ValueOf(names).Pointer()
+	require.NoError(t, d.decodeRecord(0, reflect.ValueOf(&names)))
+	assert.Equal(t, map[string]string{"en": "Foo", "zh": "人"}, names)
+	assert.Equal(t, reused, reflect.ValueOf(names).Pointer())
+
+	// A map held in an interface{} is replaced, not modified.
+	kept := map[string]interface{}{"de": "stale"}
+	var generic interface{} = kept
+	require.NoError(t, d.decodeRecord(0, reflect.ValueOf(&generic)))
+	assert.Equal(t, map[string]interface{}{"en": "Foo", "zh": "人"}, generic)
+	assert.Equal(t, map[string]interface{}{"de": "stale"}, kept)
+
+	// Nested maps are not reused either.
+	// {"names": {"en": "Foo"}}
+	input, _ = hex.DecodeString("e1" + "456e616d6573" + "e142656e43466f6f")
+	d = decoder{buffer: input}
+	nested := map[string]interface{}{"de": "stale", "en": "old"}
+	record := map[string]interface{}{"names": nested, "city": "stale"}
+	require.NoError(t, d.decodeRecord(0, reflect.ValueOf(&record)))
+	assert.Equal(t, map[string]interface{}{"names": map[string]interface{}{"en": "Foo"}}, record)
+	assert.Equal(t, map[string]interface{}{"de": "stale", "en": "old"}, nested)
+
+	// A map in a struct field is decoded into, keeping its other entries.
+	var city struct {
+		Names map[string]string `maxminddb:"names"`
+	}
+	city.Names = map[string]string{"de": "stale", "en": "old"}
+	require.NoError(t, d.decodeRecord(0, reflect.ValueOf(&city)))
+	assert.Equal(t, map[string]string{"de": "stale", "en": "Foo"}, city.Names)
+}
+
+func TestLookupKeepsEarlierMaps(t *testing.T) {
+	reader, err := Open("test-data/test-data/GeoIP2-City-Test.mmdb")
+	require.NoError(t, err)
+	defer reader.Close()
+
+	var result interface{}
+	require.NoError(t, reader.Lookup(net.ParseIP("81.2.69.160"), &result))
+	kept := result.(map[string]interface{})
+	require.Contains(t, kept, "city")
+
+	// The record for this address has no city.
+	require.NoError(t, reader.Lookup(net.ParseIP("2001:218::"), &result))
+	assert.NotContains(t, result, "city")
+	assert.Contains(t, kept, "city")
+}
+
+type EmbeddedLocation struct {
+	MetroCode uint   `maxminddb:"metro_code"`
+	TimeZone  string `maxminddb:"time_zone"`
+}
+
+type embeddedNames struct {
+	Name string `maxminddb:"name"`
+}
+
+func TestDecodeEmbeddedStructs(t *testing.T) {
+	d := decoder{buffer: encodeTestValue(map[string]interface{}{
+		"metro_code": uint(1),
+		"time_zone":  "Europe/London",
+		"name":       "x",
+		"location": map[string]interface{}{
+			"metro_code": uint(2),
+			"time_zone":  "Europe/Paris",
+		},
+	})}
+
+	// The fields of embedded structs, including unexported ones and ones
+	// embedded by pointer, are matched against the keys of the map itself.
+	var flat struct {
+		EmbeddedLocation
+		Name string `maxminddb:"name"`
+	}
+	_, err := d.decode(0, reflect.ValueOf(&flat), 0)
+	require.Nil(t, err)
+	assert.Equal(t, EmbeddedLocation{1, "Europe/London"}, flat.EmbeddedLocation)
+	assert.Equal(t, "x", flat.Name)
+
+	var unexported struct {
+		embeddedNames
+	}
+	_, err = d.decode(0, reflect.ValueOf(&unexported), 0)
+	require.Nil(t, err)
+	assert.Equal(t, "x", unexported.Name)
+
+	var pointer struct {
+		*EmbeddedLocation
+	}
+	_, err = d.decode(0, reflect.ValueOf(&pointer), 0)
+	require.Nil(t, err)
+	require.NotNil(t, pointer.EmbeddedLocation)
+	assert.Equal(t, "Europe/London", pointer.TimeZone)
+
+	// As with encoding/json, a nil pointer to an unexported struct cannot be
+	// set.
+	var unexportedPointer struct {
+		*embeddedNames
+	}
+	_, err = d.decode(0, reflect.ValueOf(&unexportedPointer), 0)
+	assert.EqualError(t, err, "maxminddb: cannot set embedded pointer to unexported struct type maxminddb.embeddedNames")
+
+	// An embedded struct with a name in its tag is decoded from that key.
+	var tagged struct {
+		EmbeddedLocation `maxminddb:"location"`
+	}
+	_, err = d.decode(0, reflect.ValueOf(&tagged), 0)
+	require.Nil(t, err)
+	assert.Equal(t, EmbeddedLocation{2, "Europe/Paris"}, tagged.EmbeddedLocation)
+}
+
+func TestDecodePointerChains(t *testing.T) {
+	reader, err := Open("test-data/test-data/GeoIP2-City-Test.mmdb")
+	require.Nil(t, err)
+	defer reader.Close()
+
+	type City struct {
+		Names map[string]string `maxminddb:"names"`
+	}
+	type Location struct {
+		TimeZone string `maxminddb:"time_zone"`
+	}
+	type record struct {
+		City     *City      `maxminddb:"city"`
+		Location **Location `maxminddb:"location"`
+		Postal   ***struct {
+			Code string `maxminddb:"code"`
+		} `maxminddb:"postal"`
+	}
+
+	var withCity record
+	require.Nil(t, reader.Lookup(net.ParseIP("81.2.69.160"), &withCity))
+	require.NotNil(t, withCity.City)
+	assert.Equal(t, "London", withCity.City.Names["en"])
+	require.NotNil(t, withCity.Location)
+	require.NotNil(t, *withCity.Location)
+	assert.Equal(t, "Europe/London", (*withCity.Location).TimeZone)
+
+	// The record of 2001:218:: only has a country, so the pointers for the
+	// other keys are left nil rather than being allocated.
+	var withoutCity record
+	require.Nil(t, reader.Lookup(net.ParseIP("2001:218::"), &withoutCity))
+	assert.Nil(t, withoutCity.City)
+	assert.Nil(t, withoutCity.Location)
+	assert.Nil(t, withoutCity.Postal)
+
+	var doublePointer **map[string]interface{}
+	require.Nil(t, reader.Lookup(net.ParseIP("81.2.69.160"), &doublePointer))
+	require.NotNil(t, doublePointer)
+	require.NotNil(t, *doublePointer)
+	assert.Contains(t, **doublePointer, "city")
+}
+
+type LangCode string
+
+func TestMapWithNamedStringKeys(t *testing.T) {
+	// {"en": "Foo", "zh": "人"}
+	input, _ := hex.DecodeString("e242656e43466f6f427a6843e4baba")
+	d := decoder{buffer: input}
+
+	var names map[LangCode]string
+	_, err := d.decode(0, reflect.ValueOf(&names), 0)
+	require.NoError(t, err)
+	assert.Equal(t, map[LangCode]string{"en": "Foo", "zh": "人"}, names)
+
+	var floats map[float64]string
+	_, err = d.decode(0, reflect.ValueOf(&floats), 0)
+	assert.EqualError(t, err, "maxminddb: cannot unmarshal map into type map[float64]string")
+
+	var ints map[int]string
+	_, err = d.decode(0, reflect.ValueOf(&ints), 0)
+	assert.Equal(t, newUnmarshalTypeError("en", reflect.TypeOf(0)), err)
+}
+
+func TestMapWithIntegerKeys(t *testing.T) {
+	// {"1": "a", "2": "b", "-3": "c"}
+	input, _ := hex.DecodeString("e3" + "4131" + "4161" + "4132" + "4162" + "422d33" + "4163")
+	d := decoder{buffer: input}
+
+	var ints map[int]string
+	_, err := d.decode(0, reflect.ValueOf(&ints), 0)
+	require.NoError(t, err)
+	assert.Equal(t, map[int]string{1: "a", 2: "b", -3: "c"}, ints)
+
+	// Keys of a reused map that the record does not have are deleted.
+	ints = map[int]string{1: "x", 4: "d"}
+	require.NoError(t, d.decodeRecord(0, reflect.ValueOf(&ints)))
+	assert.Equal(t, map[int]string{1: "a", 2: "b", -3: "c"}, ints)
+
+	var int8s map[int8]string
+	_, err = d.decode(0, reflect.ValueOf(&int8s), 0)
+	require.NoError(t, err)
+	assert.Equal(t, map[int8]string{1: "a", 2: "b", -3: "c"}, int8s)
+
+	// -3 is not a valid unsigned key.
+	var uints map[uint]string
+	_, err = d.decode(0, reflect.ValueOf(&uints), 0)
+	assert.Equal(t, newUnmarshalTypeError("-3", reflect.TypeOf(uint(0))), err)
+
+	// {"300": "a"} does not fit in an int8 key.
+	input, _ = hex.DecodeString("e1" + "43333030" + "4161")
+	d = decoder{buffer: input}
+	int8s = nil
+	_, err = d.decode(0, reflect.ValueOf(&int8s), 0)
+	assert.Equal(t, newUnmarshalTypeError("300", reflect.TypeOf(int8(0))), err)
+
+	var uint16s map[uint16]string
+	_, err = d.decode(0, reflect.ValueOf(&uint16s), 0)
+	require.NoError(t, err)
+	assert.Equal(t, map[uint16]string{300: "a"}, uint16s)
+}
+
+func TestSliceOfMaps(t *testing.T) {
+	// [{"a": "b"}, {}]
+	input, _ := hex.DecodeString("0204" + "e1" + "4161" + "4162" + "e0")
+	d := decoder{buffer: input}
+
+	var result []map[string]string
+	_, err := d.decode(0, reflect.ValueOf(&result), 0)
+	require.Nil(t, err)
+	assert.Equal(t, []map[string]string{{"a": "b"}, {}}, result)
+}
@@ -0,0 +1,181 @@
+package maxminddb
+
+import (
+	"fmt"
+	"net"
+	"reflect"
+)
+
+// DiffResult holds the differences between two databases found by Diff.
+// Each slice is in ascending order of network.
+type DiffResult struct {
+	// Added holds the networks that only the new database has a record
+	// for.
+	Added []NetworkDiff
+	// Removed holds the networks that only the old database has a record
+	// for.
+	Removed []NetworkDiff
+	// Changed holds the networks whose records differ between the
+	// databases.
+	Changed []NetworkDiff
+}
+
+// NetworkDiff is a network whose record differs between two databases. Old
+// is nil for an added network and New is nil for a removed one.
+type NetworkDiff struct {
+	Network *net.IPNet
+	Old     interface{}
+	New     interface{}
+}
+
+// DiffOption is an option for Diff.
+type DiffOption func(*differ)
+
+// DiffEqual is an option for Diff that sets the function used to compare the
+// decoded records of a network in the two databases. The default is
+// reflect.DeepEqual.
+func DiffEqual(equal func(oldRecord, newRecord interface{}) bool) DiffOption {
+	return func(d *differ) {
+		d.equal = equal
+	}
+}
+
+type differ struct {
+	old, new *Reader
+	result   func() interface{}
+	equal    func(oldRecord, newRecord interface{}) bool
+	ipLen    int
+	diff     DiffResult
+}
+
+// Diff compares the records of two databases, oldReader and newReader, which
+// must be of the same IP version. Each record is decoded into a new value
+// from result, which must return a pointer, e.g., &City{}, each time it is
+// called.
+//
+// The search trees of the databases are walked side by side, so a network
+// that is split into smaller networks in one of the databases is reported
+// as each of these smaller networks. Like with the SkipAliasedNetworks
+// option of Networks, the aliases of the IPv4 subtree in an IPv6 database
+// are not compared.
+func Diff(oldReader, newReader *Reader, result func() interface{}, options ...DiffOption) (*DiffResult, error) {
+	if oldReader.buffer == nil || newReader.buffer == nil {
+		return nil, ErrClosed
+	}
+	if oldReader.Metadata.IPVersion != newReader.Metadata.IPVersion {
+		return nil, fmt.Errorf(
+			"maxminddb: cannot diff an IPv%d database against an IPv%d database",
+			oldReader.Metadata.IPVersion,
+			newReader.Metadata.IPVersion,
+		)
+	}
+
+	d := &differ{old: oldReader, new: newReader, result: result, equal: reflect.DeepEqual}
+	for _, option := range options {
+		option(d)
+	}
+	d.ipLen = net.IPv4len
+	if oldReader.Metadata.IsIPv6() {
+		d.ipLen = net.IPv6len
+	}
+
+	var ip [net.IPv6len]byte
+	if err := d.walk(0, 0, ip, 0); err != nil {
+		return nil, err
+	}
+	return &d.diff, nil
+}
+
+// walk compares the subtrees at oldNode and newNode, which are both at the
+// network of ip and bit. A pointer which is not a node, i.e., a data pointer
+// or an empty record, covers the whole network, so it is compared against
+// each of the networks the other subtree splits the network into.
+func (d *differ) walk(oldNode, newNode uint, ip [net.IPv6len]byte, bit uint) error {
+	oldNode = d.skipAlias(d.old, oldNode, ip)
+	newNode = d.skipAlias(d.new, newNode, ip)
+
+	oldIsNode := oldNode < d.old.Metadata.NodeCount
+	newIsNode := newNode < d.new.Metadata.NodeCount
+	if !oldIsNode && !newIsNode {
+		return d.compare(oldNode, newNode, ip, bit)
+	}
+
+	if d.ipLen <= int(bit>>3) {
+		return newInvalidDatabaseError("invalid search tree at %v/%v", net.IP(ip[:d.ipLen]), bit)
+	}
+	for index := uint(0); index < 2; index++ {
+		oldChild, newChild := oldNode, newNode
+		var err error
+		if oldIsNode {
+			if oldChild, err = d.old.readNode(oldNode, index); err != nil {
+				return err
+			}
+		}
+		if newIsNode {
+			if newChild, err = d.new.readNode(newNode, index); err != nil {
+				return err
+			}
+		}
+		childIP := ip
+		if index == 1 {
+			childIP[bit>>3] |= 1 << (7 - (bit % 8))
+		}
+		if err := d.walk(oldChild, newChild, childIP, bit+1); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// skipAlias returns the empty record in place of node if node is an alias of
+// the IPv4 subtree of r.
+func (d *differ) skipAlias(r *Reader, node uint, ip [net.IPv6len]byte) uint {
+	if r.Metadata.IsIPv6() &&
+		node < r.Metadata.NodeCount &&
+		node == r.ipv4Start &&
+		!isZeros(ip[0:12]) {
+		return r.Metadata.NodeCount
+	}
+	return node
+}
+
+func (d *differ) compare(oldPointer, newPointer uint, ip [net.IPv6len]byte, bit uint) error {
+	oldHasData := oldPointer > d.old.Metadata.NodeCount
+	newHasData := newPointer > d.new.Metadata.NodeCount
+	if !oldHasData && !newHasData {
+		return nil
+	}
+
+	entry := NetworkDiff{Network: d.network(ip, bit)}
+	if oldHasData {
+		entry.Old = d.result()
+		if err := d.old.retrieveData(oldPointer, entry.Old); err != nil {
+			return err
+		}
+	}
+	if newHasData {
+		entry.New = d.result()
+		if err := d.new.retrieveData(newPointer, entry.New); err != nil {
+			return err
+		}
+	}
+
+	switch {
+	case !oldHasData:
+		d.diff.Added = append(d.diff.Added, entry)
+	case !newHasData:
+		d.diff.Removed = append(d.diff.Removed, entry)
+	case !d.equal(entry.Old, entry.New):
+		d.diff.Changed = append(d.diff.Changed, entry)
+	}
+	return nil
+}
+
+// network returns the network of ip and bit in the form used by Networks.
+func (d *differ) network(ip [net.IPv6len]byte, bit uint) *net.IPNet {
+	n := &Networks{
+		ipLen:    d.ipLen,
+		lastNode: netNode{ip: ip, bit: bit},
+	}
+	return n.network()
+}
@@ -0,0 +1,171 @@
+package maxminddb
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testDiffDatabase returns an IPv4 database in which each of the networks
+// points to a record holding its value as "v".
+func testDiffDatabase(t *testing.T, records map[string]string) *Reader {
+	var networks []string
+	for network := range records {
+		networks = append(networks, network)
+	}
+	nodes := testTree(networks...)
+	nodeCount := uint(len(nodes))
+
+	var data []byte
+	for network, value := range records {
+		_, ipNet, err := net.ParseCIDR(network)
+		require.Nil(t, err)
+		ones, _ := ipNet.Mask.Size()
+		node := uint(0)
+		for i := 0; i < ones; i++ {
+			bit := (ipNet.IP.To4()[i>>3] >> uint(7-i%8)) & 1
+			if i == ones-1 {
+				nodes[node][bit] = nodeCount + DataSectionSeparatorSize + uint(len(data))
+				break
+			}
+			node = nodes[node][bit]
+		}
+		data = append(data, encodeTestValue(map[string]interface{}{"v": value})...)
+	}
+
+	reader, err := FromBytes(testDatabase(nodes, data, nil))
+	require.Nil(t, err)
+	return reader
+}
+
+func TestDiff(t *testing.T) {
+	oldReader := testDiffDatabase(t, map[string]string{
+		"1.0.0.0/8":   "a",
+		"2.0.0.0/8":   "b",
+		"3.0.0.0/8":   "c",
+		"4.0.0.0/8":   "d",
+		"5.0.0.0/8":   "e",
+		"6.0.0.0/8":   "f",
+		"128.0.0.0/1": "g",
+	})
+	newReader := testDiffDatabase(t, map[string]string{
+		"1.0.0.0/8":   "a",
+		"2.0.0.0/8":   "B",
+		"4.0.0.0/9":   "d",
+		"4.128.0.0/9": "D",
+		"5.0.0.0/9":   "e",
+		"7.0.0.0/8":   "h",
+		"128.0.0.0/2": "g",
+	})
+
+	type record struct {
+		V string `maxminddb:"v"`
+	}
+	diff, err := Diff(oldReader, newReader, func() interface{} { return &record{} })
+	require.Nil(t, err)
+
+	type entry struct {
+		Network  string
+		Old, New interface{}
+	}
+	entries := func(diffs []NetworkDiff) []entry {
+		var entries []entry
+		for _, d := range diffs {
+			e := entry{Network: d.Network.String()}
+			if d.Old != nil {
+				e.Old = d.Old.(*record).V
+			}
+			if d.New != nil {
+				e.New = d.New.(*record).V
+			}
+			entries = append(entries, e)
+		}
+		return entries
+	}
+
+	assert.Equal(
+		t,
+		[]entry{
+			{Network: "7.0.0.0/8", New: "h"},
+		},
+		entries(diff.Added),
+	)
+	assert.Equal(
+		t,
+		[]entry{
+			{Network: "3.0.0.0/8", Old: "c"},
+			{Network: "5.128.0.0/9", Old: "e"},
+			{Network: "6.0.0.0/8", Old: "f"},
+			{Network: "192.0.0.0/2", Old: "g"},
+		},
+		entries(diff.Removed),
+	)
+	assert.Equal(
+		t,
+		[]entry{
+			{Network: "2.0.0.0/8", Old: "b", New: "B"},
+			{Network: "4.128.0.0/9", Old: "d", New: "D"},
+		},
+		entries(diff.Changed),
+	)
+
+	diff, err = Diff(
+		oldReader,
+		newReader,
+		func() interface{} { return &record{} },
+		DiffEqual(func(oldRecord, newRecord interface{}) bool { return true }),
+	)
+	require.Nil(t, err)
+	assert.Empty(t, diff.Changed)
+	assert.Len(t, diff.Added, 1)
+	assert.Len(t, diff.Removed, 4)
+
+	diff, err = Diff(oldReader, oldReader, func() interface{} { return &record{} })
+	require.Nil(t, err)
+	assert.Equal(t, &DiffResult{}, diff)
+}
+
+func TestDiffIPv6Databases(t *testing.T) {
+	oldReader, err := Open("test-data/test-data/MaxMind-DB-test-mixed-24.mmdb")
+	require.Nil(t, err)
+	defer oldReader.Close()
+	newReader, err := Open("test-data/test-data/MaxMind-DB-test-ipv6-32.mmdb")
+	require.Nil(t, err)
+	defer newReader.Close()
+
+	record := func() interface{} { return new(interface{}) }
+	diff, err := Diff(oldReader, oldReader, record)
+	require.Nil(t, err)
+	assert.Equal(t, &DiffResult{}, diff)
+
+	diff, err = Diff(oldReader, newReader, record)
+	require.Nil(t, err)
+	seen := map[string]bool{}
+	for _, d := range diff.Removed {
+		// The aliases of the IPv4 subtree are not compared, so each IPv4
+		// network is removed once.
+		assert.False(t, seen[d.Network.String()], "%s removed twice", d.Network)
+		seen[d.Network.String()] = true
+		assert.Nil(t, d.New)
+	}
+	assert.True(t, seen["1.1.1.1/32"])
+	assert.Empty(t, diff.Added)
+}
+
+func TestDiffErrors(t *testing.T) {
+	ipv4Reader, err := Open("test-data/test-data/MaxMind-DB-test-ipv4-24.mmdb")
+	require.Nil(t, err)
+	ipv6Reader, err := Open("test-data/test-data/MaxMind-DB-test-ipv6-24.mmdb")
+	require.Nil(t, err)
+
+	record := func() interface{} { return new(interface{}) }
+	_, err = Diff(ipv4Reader, ipv6Reader, record)
+	assert.EqualError(t, err, "maxminddb: cannot diff an IPv4 database against an IPv6 database")
+
+	assert.Nil(t, ipv6Reader.Close())
+	_, err = Diff(ipv4Reader, ipv6Reader, record)
+	assert.Equal(t, ErrClosed, err)
+	assert.Nil(t, ipv4Reader.Close())
+}
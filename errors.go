@@ -1,18 +1,37 @@
 package maxminddb
 
 import (
+	"errors"
 	"fmt"
+	"net"
 	"reflect"
+	"strings"
 )
 
+// ErrNotFound is returned by lookups on a Reader created with the
+// WithNotFoundError option when the database does not contain a record for
+// the IP address.
+var ErrNotFound = errors.New("maxminddb: no record found for the IP address")
+
+// ErrClosed is returned when a Reader is used after Close has returned,
+// including by iterators such as Networks that were created before. It does
+// not make it safe to call Close while the Reader is in use.
+var ErrClosed = errors.New("maxminddb: cannot use a closed database")
+
 // InvalidDatabaseError is returned when the database contains invalid data
 // and cannot be parsed.
 type InvalidDatabaseError struct {
 	message string
 }
 
-func newOffsetError() InvalidDatabaseError {
-	return InvalidDatabaseError{"unexpected end of database"}
+// newOffsetError returns the error for an attempt to read up to offset in a
+// buffer of length bytes.
+func newOffsetError(offset, length uint) InvalidDatabaseError {
+	return newInvalidDatabaseError(
+		"unexpected end of database: attempted to read to offset %d of a %d byte buffer",
+		offset,
+		length,
+	)
 }
 
 func newInvalidDatabaseError(format string, args ...interface{}) InvalidDatabaseError {
@@ -23,6 +42,32 @@ func (e InvalidDatabaseError) Error() string {
 	return e.message
 }
 
+// UnmappedFieldsError is returned when strict decoding is enabled and a map
+// in the database contains keys that do not correspond to any field of the
+// struct being decoded into.
+type UnmappedFieldsError struct {
+	Keys   []string     // keys without a corresponding struct field, in database order
+	Offset uintptr      // data section offset of the first unmapped key
+	Type   reflect.Type // struct type that was being decoded into
+}
+
+func newUnmappedFieldsError(keys []string, offset uint, rType reflect.Type) UnmappedFieldsError {
+	return UnmappedFieldsError{
+		Keys:   keys,
+		Offset: uintptr(offset),
+		Type:   rType,
+	}
+}
+
+func (e UnmappedFieldsError) Error() string {
+	return fmt.Sprintf(
+		"maxminddb: keys %s at offset %d have no corresponding field in type %s",
+		strings.Join(e.Keys, ", "),
+		e.Offset,
+		e.Type.String(),
+	)
+}
+
 // UnmarshalTypeError is returned when the value in the database cannot be
 // assigned to the specified data type.
 type UnmarshalTypeError struct {
@@ -40,3 +85,32 @@ func newUnmarshalTypeError(value interface{}, rType reflect.Type) UnmarshalTypeE
 func (e UnmarshalTypeError) Error() string {
 	return fmt.Sprintf("maxminddb: cannot unmarshal %s into type %s", e.Value, e.Type.String())
 }
+
+// LookupManyError is returned by LookupMany when the lookup of one of the IP
+// addresses fails. It wraps the error returned for that address.
+type LookupManyError struct {
+	Index int    // index of the IP address in the slice passed to LookupMany
+	IP    net.IP // the IP address
+	Err   error  // the error encountered looking up the IP address
+}
+
+func (e LookupManyError) Error() string {
+	return fmt.Sprintf("maxminddb: error looking up %s at index %d: %v", e.IP, e.Index, e.Err)
+}
+
+// Unwrap returns the underlying error.
+func (e LookupManyError) Unwrap() error {
+	return e.Err
+}
+
+// RecordLimitError is returned by RecordsWithin when the network contains
+// more records than the limit. The records up to the limit are returned along
+// with it.
+type RecordLimitError struct {
+	Limit int        // the limit passed to RecordsWithin
+	Next  *net.IPNet // the first network that was not returned
+}
+
+func (e RecordLimitError) Error() string {
+	return fmt.Sprintf("maxminddb: more than %d records in network, stopped before %s", e.Limit, e.Next)
+}
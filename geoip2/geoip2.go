@@ -0,0 +1,174 @@
+// Package geoip2 provides structs matching the records of the GeoIP2 and
+// GeoLite2 databases along with a Reader to look them up.
+//
+// Localized names are stored in maps keyed by language code, e.g., "en" or
+// "zh-CN". Not every name is available in every language, so a missing key
+// simply yields an empty string.
+package geoip2
+
+import (
+	"net"
+
+	maxminddb "github.com/oschwald/maxminddb-golang"
+)
+
+// Names are localized names keyed by language code.
+type Names map[string]string
+
+// Continent is the continent associated with an IP address.
+type Continent struct {
+	Code      string `maxminddb:"code"`
+	GeoNameID uint   `maxminddb:"geoname_id"`
+	Names     Names  `maxminddb:"names"`
+}
+
+// CountryRecord is a country associated with an IP address.
+type CountryRecord struct {
+	GeoNameID         uint   `maxminddb:"geoname_id"`
+	IsInEuropeanUnion bool   `maxminddb:"is_in_european_union"`
+	IsoCode           string `maxminddb:"iso_code"`
+	Names             Names  `maxminddb:"names"`
+}
+
+// RepresentedCountry is the country represented by the users of an IP
+// address, e.g., the country of a military base.
+type RepresentedCountry struct {
+	CountryRecord
+	Type string `maxminddb:"type"`
+}
+
+// Traits are the general traits of an IP address.
+type Traits struct {
+	IsAnonymousProxy    bool `maxminddb:"is_anonymous_proxy"`
+	IsSatelliteProvider bool `maxminddb:"is_satellite_provider"`
+}
+
+// Country is a record of a GeoIP2-Country or GeoLite2-Country database.
+type Country struct {
+	Continent          Continent          `maxminddb:"continent"`
+	Country            CountryRecord      `maxminddb:"country"`
+	RegisteredCountry  CountryRecord      `maxminddb:"registered_country"`
+	RepresentedCountry RepresentedCountry `maxminddb:"represented_country"`
+	Traits             Traits             `maxminddb:"traits"`
+}
+
+// CityRecord is the city associated with an IP address.
+type CityRecord struct {
+	GeoNameID uint  `maxminddb:"geoname_id"`
+	Names     Names `maxminddb:"names"`
+}
+
+// Location is the approximate location of an IP address.
+type Location struct {
+	AccuracyRadius uint16  `maxminddb:"accuracy_radius"`
+	Latitude       float64 `maxminddb:"latitude"`
+	Longitude      float64 `maxminddb:"longitude"`
+	MetroCode      uint    `maxminddb:"metro_code"`
+	TimeZone       string  `maxminddb:"time_zone"`
+}
+
+// Postal is the postal code associated with an IP address.
+type Postal struct {
+	Code string `maxminddb:"code"`
+}
+
+// Subdivision is a subdivision of a country, e.g., a state or a province.
+type Subdivision struct {
+	GeoNameID uint   `maxminddb:"geoname_id"`
+	IsoCode   string `maxminddb:"iso_code"`
+	Names     Names  `maxminddb:"names"`
+}
+
+// City is a record of a GeoIP2-City or GeoLite2-City database.
+type City struct {
+	City               CityRecord         `maxminddb:"city"`
+	Continent          Continent          `maxminddb:"continent"`
+	Country            CountryRecord      `maxminddb:"country"`
+	Location           Location           `maxminddb:"location"`
+	Postal             Postal             `maxminddb:"postal"`
+	RegisteredCountry  CountryRecord      `maxminddb:"registered_country"`
+	RepresentedCountry RepresentedCountry `maxminddb:"represented_country"`
+	// Subdivisions are ordered from the largest to the smallest.
+	Subdivisions []Subdivision `maxminddb:"subdivisions"`
+	Traits       Traits        `maxminddb:"traits"`
+}
+
+// ASN is a record of a GeoLite2-ASN database.
+type ASN struct {
+	AutonomousSystemNumber       uint   `maxminddb:"autonomous_system_number"`
+	AutonomousSystemOrganization string `maxminddb:"autonomous_system_organization"`
+}
+
+// AnonymousIP is a record of a GeoIP2-Anonymous-IP database.
+type AnonymousIP struct {
+	IsAnonymous        bool `maxminddb:"is_anonymous"`
+	IsAnonymousVPN     bool `maxminddb:"is_anonymous_vpn"`
+	IsHostingProvider  bool `maxminddb:"is_hosting_provider"`
+	IsPublicProxy      bool `maxminddb:"is_public_proxy"`
+	IsResidentialProxy bool `maxminddb:"is_residential_proxy"`
+	IsTorExitNode      bool `maxminddb:"is_tor_exit_node"`
+}
+
+// Reader is a maxminddb.Reader with methods to look up GeoIP2 and GeoLite2
+// records. The method to use depends on the type of the database. If the
+// database does not contain a record for an IP address, a zero record is
+// returned.
+type Reader struct {
+	*maxminddb.Reader
+}
+
+// Open opens the database file using maxminddb.Open.
+func Open(file string, options ...maxminddb.ReaderOption) (*Reader, error) {
+	reader, err := maxminddb.Open(file, options...)
+	if err != nil {
+		return nil, err
+	}
+	return &Reader{reader}, nil
+}
+
+// FromBytes returns a Reader for the database in buffer using
+// maxminddb.FromBytes.
+func FromBytes(buffer []byte, options ...maxminddb.ReaderOption) (*Reader, error) {
+	reader, err := maxminddb.FromBytes(buffer, options...)
+	if err != nil {
+		return nil, err
+	}
+	return &Reader{reader}, nil
+}
+
+// LookupCity looks up the City record for ip.
+func (r *Reader) LookupCity(ip net.IP) (*City, error) {
+	var city City
+	if err := r.Lookup(ip, &city); err != nil {
+		return nil, err
+	}
+	return &city, nil
+}
+
+// LookupCountry looks up the Country record for ip. It may be used with both
+// Country and City databases.
+func (r *Reader) LookupCountry(ip net.IP) (*Country, error) {
+	var country Country
+	if err := r.Lookup(ip, &country); err != nil {
+		return nil, err
+	}
+	return &country, nil
+}
+
+// LookupASN looks up the ASN record for ip.
+func (r *Reader) LookupASN(ip net.IP) (*ASN, error) {
+	var asn ASN
+	if err := r.Lookup(ip, &asn); err != nil {
+		return nil, err
+	}
+	return &asn, nil
+}
+
+// LookupAnonymousIP looks up the AnonymousIP record for ip.
+func (r *Reader) LookupAnonymousIP(ip net.IP) (*AnonymousIP, error) {
+	var anonymousIP AnonymousIP
+	if err := r.Lookup(ip, &anonymousIP); err != nil {
+		return nil, err
+	}
+	return &anonymousIP, nil
+}
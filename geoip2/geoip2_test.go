@@ -0,0 +1,92 @@
+package geoip2
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLookupCity(t *testing.T) {
+	reader, err := Open("../test-data/test-data/GeoIP2-City-Test.mmdb")
+	require.Nil(t, err)
+
+	city, err := reader.LookupCity(net.ParseIP("81.2.69.142"))
+	require.Nil(t, err)
+	assert.Equal(t, uint(2643743), city.City.GeoNameID)
+	assert.Equal(t, "London", city.City.Names["en"])
+	assert.Equal(t, "", city.City.Names["pt-BR"])
+	assert.Equal(t, "GB", city.Country.IsoCode)
+	assert.Equal(t, "United Kingdom", city.Country.Names["en"])
+	assert.Equal(t, "GB", city.RegisteredCountry.IsoCode)
+	assert.Equal(t, "Europe/London", city.Location.TimeZone)
+	assert.Equal(t, uint16(100), city.Location.AccuracyRadius)
+	assert.InDelta(t, 51.5142, city.Location.Latitude, 1e-9)
+	require.Len(t, city.Subdivisions, 1)
+	assert.Equal(t, "ENG", city.Subdivisions[0].IsoCode)
+
+	// Records without localized names decode to empty names.
+	city, err = reader.LookupCity(net.ParseIP("89.160.20.112"))
+	require.Nil(t, err)
+	assert.Equal(t, "SE", city.Country.IsoCode)
+	assert.Nil(t, city.Country.Names)
+	assert.Equal(t, "", city.Country.Names["en"])
+
+	city, err = reader.LookupCity(net.ParseIP("1.1.1.1"))
+	require.Nil(t, err)
+	assert.Equal(t, City{}, *city)
+
+	_, err = reader.LookupCity(nil)
+	assert.NotNil(t, err)
+
+	assert.Nil(t, reader.Close())
+}
+
+func TestLookupCountry(t *testing.T) {
+	reader, err := Open("../test-data/test-data/GeoIP2-City-Test.mmdb")
+	require.Nil(t, err)
+
+	country, err := reader.LookupCountry(net.ParseIP("2001:218::"))
+	require.Nil(t, err)
+	assert.Equal(t, "JP", country.Country.IsoCode)
+
+	assert.Nil(t, reader.Close())
+}
+
+func TestLookupASN(t *testing.T) {
+	reader, err := Open("../test-data/test-data/GeoLite2-ASN-Test.mmdb")
+	require.Nil(t, err)
+
+	asn, err := reader.LookupASN(net.ParseIP("1.128.0.0"))
+	require.Nil(t, err)
+	assert.Equal(t, ASN{1221, "Telstra Pty Ltd"}, *asn)
+
+	assert.Nil(t, reader.Close())
+}
+
+func TestLookupAnonymousIP(t *testing.T) {
+	reader, err := Open("../test-data/test-data/GeoIP2-Anonymous-IP-Test.mmdb")
+	require.Nil(t, err)
+
+	anonymousIP, err := reader.LookupAnonymousIP(net.ParseIP("1.2.0.1"))
+	require.Nil(t, err)
+	assert.Equal(t, AnonymousIP{IsAnonymous: true, IsAnonymousVPN: true}, *anonymousIP)
+
+	anonymousIP, err = reader.LookupAnonymousIP(net.ParseIP("81.2.69.1"))
+	require.Nil(t, err)
+	assert.Equal(
+		t,
+		AnonymousIP{
+			IsAnonymous:        true,
+			IsAnonymousVPN:     true,
+			IsHostingProvider:  true,
+			IsPublicProxy:      true,
+			IsResidentialProxy: true,
+			IsTorExitNode:      true,
+		},
+		*anonymousIP,
+	)
+
+	assert.Nil(t, reader.Close())
+}
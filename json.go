@@ -0,0 +1,268 @@
+package maxminddb
+
+import (
+	"encoding/base64"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"strconv"
+	"unicode/utf8"
+)
+
+// LookupJSON retrieves the database record for ipAddress and writes it to w
+// as JSON. The JSON is produced directly from the encoded record, without
+// decoding it into a map[string]interface{} first, and is equivalent to
+// json.Marshal of the record decoded into an interface{}: numbers are
+// written as JSON numbers, including 128-bit integers, and bytes as base64
+// strings. Unlike json.Marshal, the keys of a map are written in the order
+// they have in the database rather than sorted.
+//
+// If the database does not contain a record for ipAddress, null is written,
+// unless the Reader was created with WithNotFoundError. null is also written
+// for an empty record with the WithEmptyNodes option.
+func (r *Reader) LookupJSON(ipAddress net.IP, w io.Writer) error {
+	if r.buffer == nil {
+		return ErrClosed
+	}
+	pointer, _, _, err := r.lookupPointer(ipAddress)
+	if err != nil {
+		return err
+	}
+	offset := NotFound
+	if pointer == 0 {
+		if err := r.errNotFound(); err != nil {
+			return err
+		}
+	} else if offset, err = r.resolveDataPointer(pointer); err != nil {
+		return err
+	}
+	var buf []byte
+	if offset == NotFound {
+		buf = append(buf, "null"...)
+	} else {
+		d, dataOffset, err := r.dataDecoder(&r.decoder, uint(offset))
+		if err != nil {
+			return err
+		}
+		buf, _, err = d.appendJSON(buf, dataOffset, 0)
+		if err != nil {
+			return err
+		}
+	}
+	_, err = w.Write(buf)
+	return err
+}
+
+// appendJSON appends the value at offset to dst as JSON. It returns the
+// offset following the value.
+func (d *decoder) appendJSON(dst []byte, offset uint, depth int) ([]byte, uint, error) {
+	if depth > maximumDataStructureDepth {
+		return nil, 0, newInvalidDatabaseError("exceeded maximum data structure depth; database is likely corrupt")
+	}
+	typeNum, size, offset, err := d.decodeCtrlData(offset)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	switch typeNum {
+	case _Pointer:
+		pointer, newOffset, err := d.followPointer(size, offset)
+		if err != nil {
+			return nil, 0, err
+		}
+		dst, _, err = d.appendJSON(dst, pointer, depth+1)
+		return dst, newOffset, err
+	case _Map:
+		dst = append(dst, '{')
+		for i := uint(0); i < size; i++ {
+			if i > 0 {
+				dst = append(dst, ',')
+			}
+			var key []byte
+			key, offset, err = d.decodeKey(offset)
+			if err != nil {
+				return nil, 0, err
+			}
+			dst = appendJSONString(dst, key)
+			dst = append(dst, ':')
+			dst, offset, err = d.appendJSON(dst, offset, depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+		}
+		return append(dst, '}'), offset, nil
+	case _Slice:
+		dst = append(dst, '[')
+		for i := uint(0); i < size; i++ {
+			if i > 0 {
+				dst = append(dst, ',')
+			}
+			dst, offset, err = d.appendJSON(dst, offset, depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+		}
+		return append(dst, ']'), offset, nil
+	case _Bool:
+		if size > 1 {
+			return nil, 0, newInvalidDatabaseError("the MaxMind DB file's data section contains bad data (bool size of %v)", size)
+		}
+		return strconv.AppendBool(dst, size != 0), offset, nil
+	}
+
+	// For the remaining types, size is the byte size
+	newOffset := offset + size
+	if newOffset > uint(len(d.buffer)) {
+		return nil, 0, newOffsetError(newOffset, uint(len(d.buffer)))
+	}
+	value := d.buffer[offset:newOffset]
+	switch typeNum {
+	case _Container:
+		var end uint
+		dst, end, err = d.appendJSON(dst, offset, depth+1)
+		if err != nil {
+			return nil, 0, err
+		}
+		if end > newOffset {
+			return nil, 0, newInvalidDatabaseError(
+				"the MaxMind DB file's data section contains bad data (container of %v bytes at offset %v holds a value of %v bytes)",
+				size,
+				offset,
+				end-offset,
+			)
+		}
+	case _String:
+		if err := d.checkUTF8(offset, newOffset); err != nil {
+			return nil, 0, err
+		}
+		dst = appendJSONString(dst, value)
+	case _Bytes:
+		dst = append(dst, '"')
+		n := len(dst)
+		dst = append(dst, make([]byte, base64.StdEncoding.EncodedLen(len(value)))...)
+		base64.StdEncoding.Encode(dst[n:], value)
+		dst = append(dst, '"')
+	case _Float64:
+		if size != 8 {
+			return nil, 0, newInvalidDatabaseError("the MaxMind DB file's data section contains bad data (float 64 size of %v)", size)
+		}
+		f, _, _ := d.decodeFloat64(size, offset)
+		if dst, err = appendJSONFloat(dst, f, 64); err != nil {
+			return nil, 0, err
+		}
+	case _Float32:
+		if size != 4 {
+			return nil, 0, newInvalidDatabaseError("the MaxMind DB file's data section contains bad data (float32 size of %v)", size)
+		}
+		f, _, _ := d.decodeFloat32(size, offset)
+		if dst, err = appendJSONFloat(dst, float64(f), 32); err != nil {
+			return nil, 0, err
+		}
+	case _Int32:
+		if size > 4 {
+			return nil, 0, newInvalidDatabaseError("the MaxMind DB file's data section contains bad data (int32 size of %v)", size)
+		}
+		n, _, _ := d.decodeInt(size, offset)
+		dst = strconv.AppendInt(dst, int64(n), 10)
+	case _Uint16, _Uint32, _Uint64:
+		uintType := uint(64)
+		switch typeNum {
+		case _Uint16:
+			uintType = 16
+		case _Uint32:
+			uintType = 32
+		}
+		if size > uintType/8 {
+			return nil, 0, newInvalidDatabaseError("the MaxMind DB file's data section contains bad data (uint%v size of %v)", uintType, size)
+		}
+		n, _, _ := d.decodeUint(size, offset)
+		dst = strconv.AppendUint(dst, n, 10)
+	case _Uint128:
+		if size > 16 {
+			return nil, 0, newInvalidDatabaseError("the MaxMind DB file's data section contains bad data (uint128 size of %v)", size)
+		}
+		n, _, _ := d.decodeUint128(size, offset)
+		dst = n.Append(dst, 10)
+	default:
+		return nil, 0, newInvalidDatabaseError("unknown type: %d", typeNum)
+	}
+	return dst, newOffset, nil
+}
+
+const hexDigits = "0123456789abcdef"
+
+// appendJSONString appends s to dst as a JSON string, escaping it like
+// encoding/json does. Invalid UTF-8 is replaced with U+FFFD.
+func appendJSONString(dst []byte, s []byte) []byte {
+	dst = append(dst, '"')
+	start := 0
+	for i := 0; i < len(s); {
+		if b := s[i]; b < utf8.RuneSelf {
+			if b >= 0x20 && b != '"' && b != '\\' && b != '<' && b != '>' && b != '&' {
+				i++
+				continue
+			}
+			dst = append(dst, s[start:i]...)
+			switch b {
+			case '"', '\\':
+				dst = append(dst, '\\', b)
+			case '\n':
+				dst = append(dst, '\\', 'n')
+			case '\r':
+				dst = append(dst, '\\', 'r')
+			case '\t':
+				dst = append(dst, '\\', 't')
+			default:
+				dst = append(dst, '\\', 'u', '0', '0', hexDigits[b>>4], hexDigits[b&0xf])
+			}
+			i++
+			start = i
+			continue
+		}
+		c, size := utf8.DecodeRune(s[i:])
+		if c == utf8.RuneError && size == 1 {
+			dst = append(dst, s[start:i]...)
+			dst = append(dst, `\ufffd`...)
+			i += size
+			start = i
+			continue
+		}
+		// U+2028 and U+2029 are valid JSON but not valid JavaScript.
+		if c == '\u2028' || c == '\u2029' {
+			dst = append(dst, s[start:i]...)
+			dst = append(dst, '\\', 'u', '2', '0', '2', hexDigits[c&0xf])
+			i += size
+			start = i
+			continue
+		}
+		i += size
+	}
+	dst = append(dst, s[start:]...)
+	return append(dst, '"')
+}
+
+// appendJSONFloat appends f to dst as a JSON number in the format used by
+// encoding/json. bits is 32 for a float32.
+func appendJSONFloat(dst []byte, f float64, bits int) ([]byte, error) {
+	if math.IsInf(f, 0) || math.IsNaN(f) {
+		return nil, fmt.Errorf("maxminddb: cannot write the float %v as JSON", f)
+	}
+	format := byte('f')
+	if abs := math.Abs(f); abs != 0 {
+		if bits == 64 && (abs < 1e-6 || abs >= 1e21) ||
+			bits == 32 && (float32(abs) < 1e-6 || float32(abs) >= 1e21) {
+			format = 'e'
+		}
+	}
+	dst = strconv.AppendFloat(dst, f, format, -1, bits)
+	if format == 'e' {
+		// Clean up e-09 to e-9.
+		n := len(dst)
+		if n >= 4 && dst[n-4] == 'e' && dst[n-3] == '-' && dst[n-2] == '0' {
+			dst[n-2] = dst[n-1]
+			dst = dst[:n-1]
+		}
+	}
+	return dst, nil
+}
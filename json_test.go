@@ -0,0 +1,93 @@
+package maxminddb
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// normalizeJSON re-encodes the JSON document b with json.Marshal, which
+// sorts the keys of objects, while keeping numbers as written.
+func normalizeJSON(t *testing.T, b []byte) string {
+	decoder := json.NewDecoder(bytes.NewReader(b))
+	decoder.UseNumber()
+	var v interface{}
+	require.Nil(t, decoder.Decode(&v), string(b))
+	normalized, err := json.Marshal(v)
+	require.Nil(t, err)
+	return string(normalized)
+}
+
+func TestLookupJSON(t *testing.T) {
+	tests := map[string][]string{
+		"test-data/test-data/MaxMind-DB-test-decoder.mmdb": {"::1.1.1.0", "::2.2.0.0", "::0.0.0.0"},
+		"test-data/test-data/GeoIP2-City-Test.mmdb":        {"81.2.69.160", "2.125.160.216", "2001:218::"},
+	}
+	for fileName, ips := range tests {
+		reader, err := Open(fileName)
+		require.Nil(t, err)
+
+		for _, ip := range ips {
+			var record interface{}
+			require.Nil(t, reader.Lookup(net.ParseIP(ip), &record))
+			expected, err := json.Marshal(record)
+			require.Nil(t, err)
+
+			var buf bytes.Buffer
+			require.Nil(t, reader.LookupJSON(net.ParseIP(ip), &buf))
+			assert.Equal(t, string(expected), normalizeJSON(t, buf.Bytes()), ip)
+		}
+
+		assert.Nil(t, reader.Close())
+		assert.Equal(t, ErrClosed, reader.LookupJSON(net.ParseIP("1.1.1.1"), &bytes.Buffer{}))
+	}
+
+	db := testDatabase([][2]uint{{1, 1}}, nil, nil)
+	reader, err := FromBytes(db)
+	require.Nil(t, err)
+	var buf bytes.Buffer
+	require.Nil(t, reader.LookupJSON(net.ParseIP("1.1.1.1"), &buf))
+	assert.Equal(t, "null", buf.String())
+
+	reader, err = FromBytes(db, WithNotFoundError())
+	require.Nil(t, err)
+	assert.Equal(t, ErrNotFound, reader.LookupJSON(net.ParseIP("1.1.1.1"), &buf))
+}
+
+func TestAppendJSON(t *testing.T) {
+	tests := map[string]string{
+		// Strings are escaped like encoding/json does.
+		"47" + hex.EncodeToString([]byte("a\"\\\n<&\x01")): `"a\"\\\n\u003c\u0026\u0001"`,
+		"42" + "ff41":                               `"\ufffdA"`,
+		"43" + "e280a8":                             `"\u2028"`,
+		"83" + "010203":                             `"AQID"`,
+		"68" + "3ff8000000000000":                   `1.5`,
+		"68" + "3e7ad7f29abcaf48":                   `1e-7`,
+		"0408" + "3f8ccccd":                         `1.1`,
+		"0401" + "ffffffff":                         `-1`,
+		"1003" + "ffffffffffffffffffffffffffffffff": `340282366920938463463374607431768211455`,
+		"0107":                                 `true`,
+		"e2" + "4162" + "0004" + "4161" + "e0": `{"b":[],"a":{}}`,
+		"0805" + "e142656e43466f6f":            `{"en":"Foo"}`,
+	}
+	for input, expected := range tests {
+		inputBytes, err := hex.DecodeString(input)
+		require.Nil(t, err)
+		d := decoder{buffer: inputBytes}
+
+		output, offset, err := d.appendJSON(nil, 0, 0)
+		require.Nil(t, err, input)
+		assert.Equal(t, expected, string(output), input)
+		assert.Equal(t, uint(len(inputBytes)), offset, input)
+	}
+
+	// NaN cannot be written as JSON.
+	d := decoder{buffer: []byte{0x68, 0x7f, 0xf8, 0, 0, 0, 0, 0, 1}}
+	_, _, err := d.appendJSON(nil, 0, 0)
+	assert.EqualError(t, err, "maxminddb: cannot write the float NaN as JSON")
+}
@@ -0,0 +1,103 @@
+package maxminddb
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+)
+
+// LazyArray is a result type for an array in the database that is decoded
+// one element at a time rather than into a slice. Decoding an array into a
+// LazyArray, or a struct field of type LazyArray or *LazyArray, only records
+// where the array is and how many elements it has. This avoids building the
+// whole slice for very large arrays, e.g., lists of coordinates.
+//
+// At remembers the element it decoded last, so that decoding the elements
+// in order takes time linear in the length of the array. A LazyArray is
+// therefore not safe for concurrent use; with WithDecodeCache, use a
+// LazyArray rather than a *LazyArray field, as the pointer is shared by every
+// result the record is copied into. Once the Reader is closed, At returns
+// ErrClosed, except for a Reader created by FromReaderAt, whose LazyArrays
+// refer to a copy of the record.
+type LazyArray struct {
+	d      *decoder
+	offset uint
+	length int
+
+	// next and nextOffset are the index and the offset of the element
+	// following the one decoded last.
+	next       int
+	nextOffset uint
+}
+
+var lazyArrayType = reflect.TypeOf(LazyArray{})
+
+// Len returns the number of elements of the array.
+func (la *LazyArray) Len() int {
+	return la.length
+}
+
+// At decodes element i of the array into the value pointed to by result,
+// following the same rules as Decode.
+func (la *LazyArray) At(i int, result interface{}) error {
+	if i < 0 || i >= la.length {
+		return fmt.Errorf("index %d out of range for an array of %d elements", i, la.length)
+	}
+	rv := reflect.ValueOf(result)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return errors.New("result param must be a pointer")
+	}
+	if !la.d.copiedRecord && la.d.reader != nil && la.d.reader.buffer == nil {
+		return ErrClosed
+	}
+
+	offset, skip := la.offset, i
+	if i >= la.next {
+		offset, skip = la.nextOffset, i-la.next
+	}
+	d := la.d
+	if d.resolveType != nil {
+		// The key path changes while decoding; see Reader.dataDecoder.
+		elementDecoder := *d
+		elementDecoder.keyPath = append([]string(nil), d.keyPath...)
+		d = &elementDecoder
+	}
+	offset, err := d.nextValueOffset(offset, uint(skip))
+	if err != nil {
+		return err
+	}
+	newOffset, err := d.decode(offset, rv, 0)
+	if err != nil {
+		return err
+	}
+	la.next, la.nextOffset = i+1, newOffset
+	return nil
+}
+
+// isLazyArray returns true if resultType is LazyArray or a pointer to it.
+func isLazyArray(resultType reflect.Type) bool {
+	for resultType.Kind() == reflect.Ptr {
+		resultType = resultType.Elem()
+	}
+	return resultType == lazyArrayType
+}
+
+func (d *decoder) unmarshalLazyArray(typeNum dataType, size uint, offset uint, result reflect.Value) (uint, error) {
+	if typeNum != _Slice {
+		return 0, newUnmarshalTypeError(typeNum.String(), result.Type())
+	}
+	newOffset, err := d.nextValueOffset(offset, size)
+	if err != nil {
+		return 0, err
+	}
+	// The key path of d changes with the values decoded after the array.
+	elementDecoder := *d
+	elementDecoder.keyPath = append([]string(nil), d.keyPath...)
+	d.indirect(result).Set(reflect.ValueOf(LazyArray{
+		d:          &elementDecoder,
+		offset:     offset,
+		length:     int(size),
+		nextOffset: offset,
+	}))
+	return newOffset, nil
+}
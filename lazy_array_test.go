@@ -0,0 +1,109 @@
+package maxminddb
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLazyArray(t *testing.T) {
+	coordinates := make([]interface{}, 10000)
+	for i := range coordinates {
+		coordinates[i] = []interface{}{uint(i), uint(i * 7)}
+	}
+	data := encodeTestValue(map[string]interface{}{
+		"coordinates": coordinates,
+		"name":        "x",
+	})
+	reader, err := FromBytes(testDatabase([][2]uint{{17, 17}}, data, nil))
+	require.Nil(t, err)
+	ip := net.ParseIP("1.1.1.1")
+
+	var eager struct {
+		Coordinates [][]uint `maxminddb:"coordinates"`
+	}
+	require.Nil(t, reader.Lookup(ip, &eager))
+
+	var lazy struct {
+		Coordinates *LazyArray `maxminddb:"coordinates"`
+		Name        string     `maxminddb:"name"`
+	}
+	require.Nil(t, reader.Lookup(ip, &lazy))
+	assert.Equal(t, "x", lazy.Name)
+	require.Equal(t, len(eager.Coordinates), lazy.Coordinates.Len())
+	for i := 0; i < lazy.Coordinates.Len(); i++ {
+		var coordinate []uint
+		require.Nil(t, lazy.Coordinates.At(i, &coordinate))
+		require.Equal(t, eager.Coordinates[i], coordinate, i)
+	}
+
+	// Elements may also be decoded out of order.
+	for _, i := range []int{9999, 0, 5000, 4999, 5000} {
+		var coordinate []uint
+		require.Nil(t, lazy.Coordinates.At(i, &coordinate))
+		assert.Equal(t, eager.Coordinates[i], coordinate, i)
+	}
+
+	var coordinate []uint
+	assert.EqualError(t, lazy.Coordinates.At(10000, &coordinate), "index 10000 out of range for an array of 10000 elements")
+	assert.EqualError(t, lazy.Coordinates.At(-1, &coordinate), "index -1 out of range for an array of 10000 elements")
+	assert.EqualError(t, lazy.Coordinates.At(0, coordinate), "result param must be a pointer")
+	assert.EqualError(t,
+		lazy.Coordinates.At(0, new(string)),
+		"maxminddb: cannot unmarshal array into type string",
+	)
+
+	var notArray struct {
+		Name LazyArray `maxminddb:"name"`
+	}
+	assert.EqualError(t,
+		reader.Lookup(ip, &notArray),
+		"maxminddb: cannot unmarshal utf8_string into type maxminddb.LazyArray",
+	)
+}
+
+func TestLazyArrayFromReaderAt(t *testing.T) {
+	buffer, err := ioutil.ReadFile("test-data/test-data/MaxMind-DB-test-decoder.mmdb")
+	require.Nil(t, err)
+	reader, err := FromReaderAt(bytes.NewReader(buffer), int64(len(buffer)))
+	require.Nil(t, err)
+	ip := net.ParseIP("::1.1.1.0")
+
+	var eager struct {
+		Array []uint32 `maxminddb:"array"`
+	}
+	require.Nil(t, reader.Lookup(ip, &eager))
+
+	var lazy struct {
+		Array LazyArray `maxminddb:"array"`
+	}
+	require.Nil(t, reader.Lookup(ip, &lazy))
+	actual := make([]uint32, lazy.Array.Len())
+	for i := range actual {
+		require.Nil(t, lazy.Array.At(i, &actual[i]))
+	}
+	assert.Equal(t, eager.Array, actual)
+
+	// The elements are in the copy of the record, which outlives the Reader.
+	require.Nil(t, reader.Close())
+	require.Nil(t, lazy.Array.At(0, &actual[0]))
+	assert.Equal(t, eager.Array[0], actual[0])
+}
+
+func TestLazyArrayAfterClose(t *testing.T) {
+	reader, err := Open("test-data/test-data/MaxMind-DB-test-decoder.mmdb")
+	require.Nil(t, err)
+
+	var lazy struct {
+		Array LazyArray `maxminddb:"array"`
+	}
+	require.Nil(t, reader.Lookup(net.ParseIP("::1.1.1.0"), &lazy))
+	require.Nil(t, reader.Close())
+
+	var element uint32
+	assert.Equal(t, ErrClosed, lazy.Array.At(0, &element))
+}
@@ -0,0 +1,59 @@
+package maxminddb
+
+import (
+	"errors"
+	"net"
+	"reflect"
+)
+
+// LookupDecoder looks up IP addresses and decodes their records like
+// Reader.Lookup, but keeps scratch state between calls to reduce the
+// allocations made while decoding. Strings in the records, including map
+// keys, are interned, so decoding a string the LookupDecoder has seen before
+// does not allocate.
+//
+// A LookupDecoder is not safe for concurrent use. Each goroutine should
+// create its own with NewLookupDecoder. It does not use the cache of a Reader
+// created with WithDecodeCache.
+type LookupDecoder struct {
+	reader  *Reader
+	decoder decoder
+}
+
+// NewLookupDecoder returns a new LookupDecoder for the database.
+func (r *Reader) NewLookupDecoder() *LookupDecoder {
+	d := &LookupDecoder{reader: r, decoder: r.decoder}
+	d.decoder.strings = map[string]string{}
+	return d
+}
+
+// Lookup takes an IP address as a net.IP structure and a pointer to the
+// result value to decode into. It behaves like Reader.Lookup, including its
+// handling of IP addresses without a record.
+func (d *LookupDecoder) Lookup(ipAddress net.IP, result interface{}) error {
+	r := d.reader
+	if r.buffer == nil {
+		return ErrClosed
+	}
+	pointer, _, _, err := r.lookupPointer(ipAddress)
+	if err != nil {
+		return err
+	}
+	if pointer == 0 {
+		return r.errNotFound()
+	}
+	offset, err := r.resolveDataPointer(pointer)
+	if err != nil || offset == NotFound {
+		return err
+	}
+
+	rv := reflect.ValueOf(result)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return errors.New("result param must be a pointer")
+	}
+	valueDecoder, dataOffset, err := r.dataDecoder(&d.decoder, uint(offset))
+	if err != nil {
+		return err
+	}
+	return valueDecoder.decodeRecord(dataOffset, rv)
+}
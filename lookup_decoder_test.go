@@ -0,0 +1,66 @@
+package maxminddb
+
+import (
+	"math/rand"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLookupDecoder(t *testing.T) {
+	reader, err := Open("test-data/test-data/GeoIP2-City-Test.mmdb")
+	require.Nil(t, err)
+
+	decoder := reader.NewLookupDecoder()
+	for _, ip := range []string{"81.2.69.142", "2.125.160.216", "81.2.69.160", "1.1.1.1"} {
+		var expected, result interface{}
+		require.Nil(t, reader.Lookup(net.ParseIP(ip), &expected))
+		// The second lookup decodes the interned strings of the first.
+		for i := 0; i < 2; i++ {
+			result = nil
+			require.Nil(t, decoder.Lookup(net.ParseIP(ip), &result))
+			assert.Equal(t, expected, result, ip)
+		}
+	}
+
+	var result interface{}
+	assert.EqualError(t, decoder.Lookup(net.ParseIP("81.2.69.142"), result), "result param must be a pointer")
+	assert.Equal(t, 0, len(reader.decoder.strings), "the decoder of the Reader does not intern")
+
+	assert.Nil(t, reader.Close())
+	assert.Equal(t, ErrClosed, decoder.Lookup(net.ParseIP("81.2.69.142"), &result))
+}
+
+func TestLookupDecoderInternLimit(t *testing.T) {
+	d := decoder{strings: map[string]string{}}
+	for i := 0; i < maxInternedStrings+10; i++ {
+		d.intern([]byte{byte(i), byte(i >> 8), byte(i >> 16)})
+	}
+	assert.Equal(t, maxInternedStrings, len(d.strings))
+	assert.Equal(t, "abc", d.intern([]byte("abc")))
+}
+
+func BenchmarkLookupDecoder(b *testing.B) {
+	db, err := Open("GeoLite2-City.mmdb")
+	assert.Nil(b, err)
+
+	type MinCountry struct {
+		Country struct {
+			IsoCode string `maxminddb:"iso_code"`
+		} `maxminddb:"country"`
+	}
+
+	r := rand.New(rand.NewSource(0))
+	var result MinCountry
+	decoder := db.NewLookupDecoder()
+
+	ip := make(net.IP, 4, 4)
+	for i := 0; i < b.N; i++ {
+		randomIPv4Address(b, r, ip)
+		err = decoder.Lookup(ip, &result)
+		assert.Nil(b, err)
+	}
+	assert.Nil(b, db.Close(), "error on close")
+}
@@ -1,4 +1,5 @@
-// +build !windows,!appengine
+//go:build !windows && !appengine && !plan9 && !js && !wasip1
+// +build !windows,!appengine,!plan9,!js,!wasip1
 
 package maxminddb
 
@@ -0,0 +1,118 @@
+package maxminddb
+
+import (
+	"net"
+	"reflect"
+)
+
+// KeyValue is a key of a map in the database together with its value.
+type KeyValue struct {
+	Key   string
+	Value interface{}
+}
+
+var keyValuesType = reflect.TypeOf([]KeyValue(nil))
+
+// LookupOrdered retrieves the database record for ipAddress as a list of
+// its keys and values in the order they are encoded in the database. Maps
+// nested in the record are decoded as []KeyValue as well, arrays as
+// []interface{} and all other values as they would be decoded into an
+// interface{}.
+//
+// If the database does not contain a record for ipAddress, nil is
+// returned, unless the Reader was created with WithNotFoundError. An error
+// is returned if the record is not a map.
+func (r *Reader) LookupOrdered(ipAddress net.IP) ([]KeyValue, error) {
+	if r.buffer == nil {
+		return nil, ErrClosed
+	}
+	pointer, _, _, err := r.lookupPointer(ipAddress)
+	if err != nil {
+		return nil, err
+	}
+	if pointer == 0 {
+		return nil, r.errNotFound()
+	}
+	offset, err := r.resolveDataPointer(pointer)
+	if err != nil || offset == NotFound {
+		return nil, err
+	}
+	d, dataOffset, err := r.dataDecoder(&r.decoder, uint(offset))
+	if err != nil {
+		return nil, err
+	}
+	value, _, err := d.decodeOrdered(dataOffset, 0)
+	if err != nil {
+		return nil, err
+	}
+	pairs, ok := value.([]KeyValue)
+	if !ok {
+		return nil, newUnmarshalTypeError(value, keyValuesType)
+	}
+	return pairs, nil
+}
+
+// decodeOrdered decodes the value at offset, decoding maps as []KeyValue.
+// It returns the offset following the value.
+func (d *decoder) decodeOrdered(offset uint, depth int) (interface{}, uint, error) {
+	if depth > maximumDataStructureDepth {
+		return nil, 0, newInvalidDatabaseError("exceeded maximum data structure depth; database is likely corrupt")
+	}
+	typeNum, size, dataOffset, err := d.decodeCtrlData(offset)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	switch typeNum {
+	case _Pointer:
+		pointer, newOffset, err := d.followPointer(size, dataOffset)
+		if err != nil {
+			return nil, 0, err
+		}
+		value, _, err := d.decodeOrdered(pointer, depth+1)
+		return value, newOffset, err
+	case _Map:
+		pairs := make([]KeyValue, size)
+		for i := range pairs {
+			var key []byte
+			key, dataOffset, err = d.decodeKey(dataOffset)
+			if err != nil {
+				return nil, 0, err
+			}
+			pairs[i].Key = string(key)
+			pairs[i].Value, dataOffset, err = d.decodeOrdered(dataOffset, depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+		}
+		return pairs, dataOffset, nil
+	case _Slice:
+		values := make([]interface{}, size)
+		for i := range values {
+			values[i], dataOffset, err = d.decodeOrdered(dataOffset, depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+		}
+		return values, dataOffset, nil
+	case _Container:
+		end := dataOffset + size
+		value, newOffset, err := d.decodeOrdered(dataOffset, depth+1)
+		if err != nil {
+			return nil, 0, err
+		}
+		if newOffset > end {
+			return nil, 0, newInvalidDatabaseError(
+				"the MaxMind DB file's data section contains bad data (container of %v bytes at offset %v holds a value of %v bytes)",
+				size,
+				dataOffset,
+				newOffset-dataOffset,
+			)
+		}
+		return value, end, nil
+	}
+
+	var value interface{}
+	newOffset, err := d.decode(offset, reflect.ValueOf(&value), depth)
+	return value, newOffset, err
+}
@@ -0,0 +1,83 @@
+package maxminddb
+
+import (
+	"encoding/hex"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLookupOrdered(t *testing.T) {
+	// {"name": "x", "age": 42, "city": {"b": "1", "a": "2"}, "tags": [{"z": "3", "y": "4"}]}
+	data, err := hex.DecodeString(
+		"e4" +
+			"446e616d65" + "4178" +
+			"43616765" + "a12a" +
+			"4463697479" + "e2" + "4162" + "4131" + "4161" + "4132" +
+			"4474616773" + "0104" + "e2" + "417a" + "4133" + "4179" + "4134",
+	)
+	require.Nil(t, err)
+	reader, err := FromBytes(testDatabase([][2]uint{{17, 1}}, data, nil))
+	require.Nil(t, err)
+
+	record, err := reader.LookupOrdered(net.ParseIP("1.1.1.1"))
+	require.Nil(t, err)
+	assert.Equal(t, []KeyValue{
+		{"name", "x"},
+		{"age", uint16(42)},
+		{"city", []KeyValue{{"b", "1"}, {"a", "2"}}},
+		{"tags", []interface{}{[]KeyValue{{"z", "3"}, {"y", "4"}}}},
+	}, record)
+
+	record, err = reader.LookupOrdered(net.ParseIP("128.1.1.1"))
+	assert.Nil(t, err)
+	assert.Nil(t, record)
+
+	reader, err = FromBytes(testDatabase([][2]uint{{17, 1}}, data, nil), WithNotFoundError())
+	require.Nil(t, err)
+	_, err = reader.LookupOrdered(net.ParseIP("128.1.1.1"))
+	assert.Equal(t, ErrNotFound, err)
+
+	// The keys and values match those of the record decoded into a map.
+	reader, err = Open("test-data/test-data/GeoIP2-City-Test.mmdb")
+	require.Nil(t, err)
+	ip := net.ParseIP("81.2.69.160")
+	var expected map[string]interface{}
+	require.Nil(t, reader.Lookup(ip, &expected))
+	record, err = reader.LookupOrdered(ip)
+	require.Nil(t, err)
+	assert.Equal(t, expected, orderedToMap(record))
+
+	require.Nil(t, reader.Close())
+	_, err = reader.LookupOrdered(ip)
+	assert.Equal(t, ErrClosed, err)
+}
+
+func TestLookupOrderedNotAMap(t *testing.T) {
+	reader, err := FromBytes(testDatabase([][2]uint{{17, 17}}, encodeTestValue("x"), nil))
+	require.Nil(t, err)
+	_, err = reader.LookupOrdered(net.ParseIP("1.1.1.1"))
+	assert.EqualError(t, err, "maxminddb: cannot unmarshal x into type []maxminddb.KeyValue")
+}
+
+// orderedToMap converts the maps of a value returned by LookupOrdered to
+// map[string]interface{}.
+func orderedToMap(value interface{}) interface{} {
+	switch value := value.(type) {
+	case []KeyValue:
+		m := make(map[string]interface{}, len(value))
+		for _, pair := range value {
+			m[pair.Key] = orderedToMap(pair.Value)
+		}
+		return m
+	case []interface{}:
+		values := make([]interface{}, len(value))
+		for i, v := range value {
+			values[i] = orderedToMap(v)
+		}
+		return values
+	}
+	return value
+}
@@ -0,0 +1,114 @@
+package maxminddb
+
+import (
+	"errors"
+	"reflect"
+)
+
+// RawResult holds the encoded form of a value in the data section. Decoding
+// into a RawResult, or a struct field of that type, copies the value's bytes
+// without interpreting them. Pointers within the value are resolved while
+// copying, so the bytes are self-contained and may be decoded later, e.g.,
+// after the Reader is closed, using Reader.DecodeRaw.
+type RawResult []byte
+
+var rawResultType = reflect.TypeOf(RawResult(nil))
+
+// DecodeRaw decodes raw, as produced by decoding into a RawResult, into the
+// value pointed to by result. It follows the same rules as Decode.
+func (r *Reader) DecodeRaw(raw RawResult, result interface{}) error {
+	rv := reflect.ValueOf(result)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return errors.New("result param must be a pointer")
+	}
+
+	d := decoder{
+		buffer:          raw,
+		strictDecoding:  r.decoder.strictDecoding,
+		strictArrays:    r.decoder.strictArrays,
+		maxPointerDepth: r.decoder.maxPointerDepth,
+	}
+	_, err := d.decode(0, rv, 0)
+	return err
+}
+
+// isRawResult returns true if resultType is RawResult or a pointer to it.
+func isRawResult(resultType reflect.Type) bool {
+	for resultType.Kind() == reflect.Ptr {
+		resultType = resultType.Elem()
+	}
+	return resultType == rawResultType
+}
+
+func (d *decoder) unmarshalRaw(offset uint, result reflect.Value, depth int) (uint, error) {
+	raw, newOffset, err := d.copyRaw(nil, offset, depth)
+	if err != nil {
+		return 0, err
+	}
+	d.indirect(result).SetBytes(raw)
+	return newOffset, nil
+}
+
+// copyRaw appends the encoded value at offset to dst, replacing any pointers
+// with the values they point to and any data cache containers with the value
+// they hold. It returns the offset following the value.
+func (d *decoder) copyRaw(dst []byte, offset uint, depth int) ([]byte, uint, error) {
+	if depth > maximumDataStructureDepth {
+		return nil, 0, newInvalidDatabaseError("exceeded maximum data structure depth; database is likely corrupt")
+	}
+	typeNum, size, dataOffset, err := d.decodeCtrlData(offset)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	switch typeNum {
+	case _Pointer:
+		pointer, newOffset, err := d.followPointer(size, dataOffset)
+		if err != nil {
+			return nil, 0, err
+		}
+		dst, _, err = d.copyRaw(dst, pointer, depth+1)
+		return dst, newOffset, err
+	case _Container:
+		// The size of a container is that of its contents in the
+		// database, which changes once pointers are replaced, so only the
+		// value is kept.
+		end := dataOffset + size
+		var valueEnd uint
+		dst, valueEnd, err = d.copyRaw(dst, dataOffset, depth+1)
+		if err != nil {
+			return nil, 0, err
+		}
+		if valueEnd > end {
+			return nil, 0, newInvalidDatabaseError(
+				"the MaxMind DB file's data section contains bad data (container of %v bytes at offset %v holds a value of %v bytes)",
+				size,
+				dataOffset,
+				valueEnd-dataOffset,
+			)
+		}
+		return dst, end, nil
+	case _Map, _Slice:
+		dst = append(dst, d.buffer[offset:dataOffset]...)
+		count := size
+		if typeNum == _Map {
+			count *= 2
+		}
+		for i := uint(0); i < count; i++ {
+			dst, dataOffset, err = d.copyRaw(dst, dataOffset, depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+		}
+		return dst, dataOffset, nil
+	default:
+		newOffset, err := d.nextValueOffset(offset, 1)
+		if err != nil {
+			return nil, 0, err
+		}
+		if newOffset > uint(len(d.buffer)) {
+			return nil, 0, newOffsetError(newOffset, uint(len(d.buffer)))
+		}
+		return append(dst, d.buffer[offset:newOffset]...), newOffset, nil
+	}
+}
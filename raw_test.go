@@ -0,0 +1,105 @@
+package maxminddb
+
+import (
+	"net"
+	"reflect"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRawResult(t *testing.T) {
+	reader, err := Open("test-data/test-data/GeoIP2-City-Test.mmdb")
+	require.Nil(t, err)
+	ip := net.ParseIP("81.2.69.142")
+
+	var expected map[string]interface{}
+	require.Nil(t, reader.Lookup(ip, &expected))
+
+	var raw RawResult
+	require.Nil(t, reader.Lookup(ip, &raw))
+
+	var partial struct {
+		Country  RawResult  `maxminddb:"country"`
+		Location *RawResult `maxminddb:"location"`
+		City     struct {
+			GeoNameID uint `maxminddb:"geoname_id"`
+		} `maxminddb:"city"`
+	}
+	require.Nil(t, reader.Lookup(ip, &partial))
+	assert.Equal(t, uint(2643743), partial.City.GeoNameID)
+	require.NotNil(t, partial.Location)
+
+	// The raw bytes do not reference the database.
+	require.Nil(t, reader.Close())
+
+	var record map[string]interface{}
+	require.Nil(t, reader.DecodeRaw(raw, &record))
+	assert.Equal(t, expected, record)
+
+	var country struct {
+		IsoCode string            `maxminddb:"iso_code"`
+		Names   map[string]string `maxminddb:"names"`
+	}
+	require.Nil(t, reader.DecodeRaw(partial.Country, &country))
+	assert.Equal(t, "GB", country.IsoCode)
+	assert.Equal(t, "United Kingdom", country.Names["en"])
+
+	var location map[string]interface{}
+	require.Nil(t, reader.DecodeRaw(*partial.Location, &location))
+	assert.Equal(t, expected["location"], location)
+
+	err = reader.DecodeRaw(raw, record)
+	assert.EqualError(t, err, "result param must be a pointer")
+}
+
+func TestRawResultWithPointers(t *testing.T) {
+	// A map whose key and value are both pointers to earlier strings.
+	data := append(encodeTestValue("key"), encodeTestValue("value")...)
+	mapOffset := uint(len(data))
+	data = append(data, testCtrlBytes(_Map, 1)...)
+	data = append(data, 0x20, 0x00) // pointer to offset 0
+	data = append(data, 0x20, 0x04) // pointer to offset 4
+	d := decoder{buffer: data}
+
+	var raw RawResult
+	newOffset, err := d.decode(mapOffset, reflect.ValueOf(&raw), 0)
+	require.Nil(t, err)
+	assert.Equal(t, uint(len(data)), newOffset)
+	assert.Equal(t, RawResult(encodeTestValue(map[string]interface{}{"key": "value"})), raw)
+}
+
+func TestRawResultWithContainer(t *testing.T) {
+	// "Foo", then a data cache container of 2 bytes wrapping a pointer to
+	// it, then "x".
+	data := encodeTestValue("Foo")
+	containerOffset := uint(len(data))
+	data = append(data, 0x02, 0x05, 0x20, 0x00)
+	data = append(data, encodeTestValue("x")...)
+	d := decoder{buffer: data}
+
+	var raw RawResult
+	newOffset, err := d.decode(containerOffset, reflect.ValueOf(&raw), 0)
+	require.Nil(t, err)
+	assert.Equal(t, containerOffset+4, newOffset)
+	assert.Equal(t, RawResult(encodeTestValue("Foo")), raw)
+
+	var s string
+	_, err = (&decoder{buffer: raw}).decode(0, reflect.ValueOf(&s), 0)
+	require.Nil(t, err)
+	assert.Equal(t, "Foo", s)
+}
+
+func TestRawResultStrict(t *testing.T) {
+	db := testDatabase([][2]uint{{17, 17}}, encodeTestValue(map[string]interface{}{"a": "x"}), nil)
+	reader, err := FromBytes(db, WithStrictDecoding())
+	require.Nil(t, err)
+
+	var raw RawResult
+	require.Nil(t, reader.Lookup(net.ParseIP("1.1.1.1"), &raw))
+
+	var result struct{}
+	err = reader.DecodeRaw(raw, &result)
+	assert.IsType(t, UnmappedFieldsError{}, err)
+}
@@ -2,10 +2,16 @@ package maxminddb
 
 import (
 	"bytes"
+	"encoding/binary"
 	"errors"
 	"fmt"
 	"net"
+	"os"
 	"reflect"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
 )
 
 const (
@@ -13,19 +19,44 @@ const (
 	// cannot be found.
 	NotFound = ^uintptr(0)
 
-	dataSectionSeparatorSize = 16
+	// DataSectionSeparatorSize is the size in bytes of the separator between
+	// the search tree and the data section. A record pointing into the data
+	// section holds the node count plus the separator size plus the offset
+	// of the data within the data section.
+	DataSectionSeparatorSize = 16
+
+	// IPv4 is the Metadata.IPVersion of a database whose search tree only
+	// holds IPv4 addresses.
+	IPv4 = 4
+	// IPv6 is the Metadata.IPVersion of a database whose search tree holds
+	// IPv6 addresses, with the IPv4 addresses usually in ::/96.
+	IPv6 = 6
 )
 
 var metadataStartMarker = []byte("\xAB\xCD\xEFMaxMind.com")
 
 // Reader holds the data corresponding to the MaxMind DB file. Its only public
 // field is Metadata, which contains the metadata from the MaxMind DB file.
+//
+// A Reader is safe for concurrent use by multiple goroutines, with the
+// exception of Close, which must not be called while the Reader is in use.
+// The database is never modified after the Reader is created, and the only
+// state shared between lookups, the struct field cache and the optional
+// decode and node caches, is synchronized.
 type Reader struct {
-	hasMappedFile bool
-	buffer        []byte
-	decoder       decoder
-	Metadata      Metadata
-	ipv4Start     uint
+	hasMappedFile     bool
+	buffer            []byte
+	decoder           decoder
+	Metadata          Metadata
+	ipv4Start         uint
+	ipv4StartBitDepth uint
+	cache             *decodeCache
+	nodeCache         *nodeCache
+	notFoundError     bool
+	emptyNodes        bool
+	warmCache         bool
+	readNodeFn        func(r *Reader, nodeNumber uint, index uint) (uint, error)
+	source            *readerAtSource
 }
 
 // Metadata holds the metadata decoded from the MaxMind DB file. In particular
@@ -44,79 +75,744 @@ type Metadata struct {
 	RecordSize               uint              `maxminddb:"record_size"`
 }
 
+// BuildTime returns the time at which the database was built, in UTC.
+func (m Metadata) BuildTime() time.Time {
+	return time.Unix(int64(m.BuildEpoch), 0).UTC()
+}
+
+// LanguagesCopy returns a copy of Languages, the locale codes for which the
+// database may contain localized data. Modifying the returned slice does not
+// affect the Metadata.
+func (m Metadata) LanguagesCopy() []string {
+	if m.Languages == nil {
+		return nil
+	}
+	languages := make([]string, len(m.Languages))
+	copy(languages, m.Languages)
+	return languages
+}
+
+// NodeByteSize returns the size in bytes of a node of the search tree, i.e.,
+// of two records.
+func (m Metadata) NodeByteSize() int {
+	return int(m.RecordSize / 4)
+}
+
+// IsIPv6 reports whether the search tree of the database is an IPv6 tree,
+// i.e., whether IPVersion is IPv6.
+func (m Metadata) IsIPv6() bool {
+	return m.IPVersion == IPv6
+}
+
+// IPVersion returns the IP version of the database's search tree: 4 for a
+// database that only holds IPv4 addresses and 6 for one that may hold both
+// IPv6 and IPv4 addresses. IPv6 addresses cannot be looked up in an IPv4
+// database; IPv4 addresses can be looked up in either.
+func (r *Reader) IPVersion() int {
+	return int(r.Metadata.IPVersion)
+}
+
+// Describe returns a human-readable summary of the database for debugging
+// and logging: its type, build time, IP version, node count, record size,
+// languages, and number of networks. The networks are counted with
+// NetworkCount, without the aliased IPv4 networks of an IPv6 database, which
+// walks the whole search tree but does not decode any data.
+func (r *Reader) Describe() string {
+	networks := "unknown"
+	if count, err := r.NetworkCount(SkipAliasedNetworks); err != nil {
+		networks += " (" + err.Error() + ")"
+	} else {
+		networks = strconv.Itoa(count)
+	}
+	return fmt.Sprintf(
+		`Database type: %s
+Build time: %s
+IP version: %d
+Node count: %d
+Record size: %d bits
+Languages: %s
+Networks: %s
+`,
+		r.Metadata.DatabaseType,
+		r.Metadata.BuildTime().Format(time.RFC3339),
+		r.Metadata.IPVersion,
+		r.Metadata.NodeCount,
+		r.Metadata.RecordSize,
+		strings.Join(r.Metadata.Languages, ", "),
+		networks,
+	)
+}
+
+// DescriptionIn returns the description of the database in the given
+// language, e.g., "en". It returns an empty string if the database does not
+// have a description in that language.
+func (m Metadata) DescriptionIn(lang string) string {
+	return m.Description[lang]
+}
+
+// ReaderOption configures a Reader. ReaderOptions may be passed to Open and
+// FromBytes.
+type ReaderOption func(*Reader)
+
+// WithStrictDecoding returns a ReaderOption that makes decoding a map into a
+// struct fail with an UnmappedFieldsError if the map contains keys that do
+// not correspond to a field of the struct. By default, such keys are
+// ignored.
+func WithStrictDecoding() ReaderOption {
+	return func(r *Reader) {
+		r.decoder.strictDecoding = true
+	}
+}
+
+// WithStrictArrayLength returns a ReaderOption that makes decoding an array
+// into a Go array of a different length fail with an UnmarshalTypeError. By
+// default, database elements that do not fit in the Go array are ignored and
+// Go array elements past the end of the database array are set to their zero
+// value.
+func WithStrictArrayLength() ReaderOption {
+	return func(r *Reader) {
+		r.decoder.strictArrays = true
+	}
+}
+
+// WithMaxPointerDepth returns a ReaderOption that sets the number of pointers
+// in the data section the decoder follows in a row, i.e., a pointer to a
+// pointer to a pointer and so on, before it gives up with an
+// InvalidDatabaseError. This guards against crafted databases with pointer
+// cycles. The default is 32; depth values less than 1 select the default.
+func WithMaxPointerDepth(depth int) ReaderOption {
+	return func(r *Reader) {
+		if depth < 1 {
+			depth = 0
+		}
+		r.decoder.maxPointerDepth = depth
+	}
+}
+
+// WithNotFoundError returns a ReaderOption that makes Lookup, LookupPath, and
+// LookupNetip return ErrNotFound if the database does not contain a record
+// for the IP address. By default, they return a nil error in that case,
+// which cannot be distinguished from a successful lookup without inspecting
+// the result. The error is not returned by LookupPath when the record exists
+// but does not contain the path.
+func WithNotFoundError() ReaderOption {
+	return func(r *Reader) {
+		r.notFoundError = true
+	}
+}
+
+// WithEmptyNodes returns a ReaderOption that makes lookups and Networks treat
+// search tree records equal to Metadata.NodeCount as records of their own
+// rather than as the absence of a record. The MaxMind DB specification
+// defines such a record as pointing to no data, and writers use it for
+// every network without data, so with this option lookups never report a
+// missing record and Networks also iterates over the networks without data,
+// covering the whole address space of the tree. As these records have no
+// data, decoding them leaves the result unchanged, and their offset, e.g.,
+// from LookupOffset or Networks.Offset, is NotFound. The option is meant for
+// custom databases that give these records a meaning.
+func WithEmptyNodes() ReaderOption {
+	return func(r *Reader) {
+		r.emptyNodes = true
+	}
+}
+
+// WithFields returns a ReaderOption that restricts decoding a record into a
+// struct to the given top-level keys of the record, e.g., "country", "city",
+// and "location". The values of the other keys are skipped without being
+// decoded, even if the struct has fields for them, which saves decoding
+// large parts of records that are not needed. Nested maps are decoded in
+// full. Records decoded into other types than structs, such as maps, are
+// not affected, nor is LookupPath.
+func WithFields(fields ...string) ReaderOption {
+	return func(r *Reader) {
+		r.decoder.fields = make(map[string]bool, len(fields))
+		for _, field := range fields {
+			r.decoder.fields[field] = true
+		}
+	}
+}
+
+// WithWarmCache returns a ReaderOption that reads the whole search tree when
+// the Reader is created, so that the first lookups are not slowed down by
+// reading the nodes they visit from disk. For a database opened with Open,
+// every page of the memory mapped search tree is read, loading it into the
+// page cache. For a Reader created by FromReaderAt, the search tree is read
+// into memory and kept there, so lookups no longer read nodes from the
+// io.ReaderAt; only records are still read on demand. This costs the time to
+// read the search tree when opening the database, plus its size in memory
+// with FromReaderAt, and is only worth it if that matters less than the
+// latency of the first lookups.
+func WithWarmCache() ReaderOption {
+	return func(r *Reader) {
+		r.warmCache = true
+	}
+}
+
+// WithUTF8Validation returns a ReaderOption that makes decoding fail with an
+// InvalidDatabaseError if a string of the data section, including a map key,
+// is not valid UTF-8. By default, strings are not validated, as checking
+// them slows down decoding and the strings of a database written by a
+// correct writer are always valid; an invalid string is decoded with its
+// bytes as they are.
+func WithUTF8Validation() ReaderOption {
+	return func(r *Reader) {
+		r.decoder.validateUTF8 = true
+	}
+}
+
+// WithTypeResolver returns a ReaderOption that lets resolve choose the
+// concrete type of the values decoded into empty interfaces, e.g., the
+// interface{} fields of a struct or the values of a map[string]interface{}.
+// resolve is called with the keys of the maps leading from the record to the
+// value, e.g., ["traits", "details"]; array indexes are not included. The
+// value is decoded into a new value of the returned type, which is then
+// stored in the interface. If resolve returns nil, the value is decoded as
+// if there was no resolver, i.e., into a map[string]interface{}, a string,
+// etc. resolve must not retain or modify keyPath, and must be safe for
+// concurrent use if the Reader is.
+//
+// This allows decoding polymorphic data, where the type of a value depends on
+// where it is, into structs.
+func WithTypeResolver(resolve func(keyPath []string) reflect.Type) ReaderOption {
+	return func(r *Reader) {
+		r.decoder.resolveType = resolve
+	}
+}
+
 // FromBytes takes a byte slice corresponding to a MaxMind DB file and returns
-// a Reader structure or an error.
-func FromBytes(buffer []byte) (*Reader, error) {
+// a Reader structure or an error. The Reader uses the slice directly rather
+// than copying it and never modifies it. The caller must not modify the slice
+// and must keep it alive for as long as the Reader is in use. Calling Close on
+// a Reader created by FromBytes does not release the slice.
+func FromBytes(buffer []byte, options ...ReaderOption) (*Reader, error) {
+	metadata, dataSectionEnd, err := decodeMetadata(buffer)
+	if err != nil {
+		return nil, err
+	}
+	dataSectionStart, err := validateMetadata(metadata, dataSectionEnd)
+	if err != nil {
+		return nil, err
+	}
+
+	reader := &Reader{
+		buffer:     buffer,
+		decoder:    decoder{buffer: buffer[dataSectionStart:dataSectionEnd]},
+		Metadata:   metadata,
+		ipv4Start:  0,
+		readNodeFn: nodeReader(metadata.RecordSize),
+	}
+	return reader.init(options)
+}
+
+// decodeMetadata decodes the metadata at the end of buffer, which holds the
+// whole database or, at least, its metadata. It also returns the position of
+// the metadata start marker in buffer, where the data section ends.
+func decodeMetadata(buffer []byte) (Metadata, uint, error) {
 	metadataStart := bytes.LastIndex(buffer, metadataStartMarker)
 
 	if metadataStart == -1 {
-		return nil, newInvalidDatabaseError("error opening database: invalid MaxMind DB file")
+		return Metadata{}, 0, newInvalidDatabaseError("error opening database: invalid MaxMind DB file")
 	}
 
+	dataSectionEnd := uint(metadataStart)
 	metadataStart += len(metadataStartMarker)
-	metadataDecoder := decoder{buffer[metadataStart:]}
+	metadataDecoder := decoder{buffer: buffer[metadataStart:]}
 
 	var metadata Metadata
 
 	rvMetdata := reflect.ValueOf(&metadata)
 	_, err := metadataDecoder.decode(0, rvMetdata, 0)
 	if err != nil {
-		return nil, err
+		return Metadata{}, 0, err
 	}
+	return metadata, dataSectionEnd, nil
+}
 
-	searchTreeSize := metadata.NodeCount * metadata.RecordSize / 4
-	dataSectionStart := searchTreeSize + dataSectionSeparatorSize
-	dataSectionEnd := uint(metadataStart - len(metadataStartMarker))
-	if dataSectionStart > dataSectionEnd {
-		return nil, newInvalidDatabaseError("the MaxMind DB contains invalid metadata")
+// validateMetadata checks that the database described by metadata is supported
+// and that its search tree ends before dataSectionEnd. It returns the offset
+// of the data section in the database.
+func validateMetadata(metadata Metadata, dataSectionEnd uint) (uint, error) {
+	if metadata.BinaryFormatMajorVersion != 2 {
+		return 0, newInvalidDatabaseError(
+			"the MaxMind DB contains invalid metadata: unsupported binary format major version of %d",
+			metadata.BinaryFormatMajorVersion,
+		)
+	}
+	if metadata.DatabaseType == "" {
+		return 0, newInvalidDatabaseError("the MaxMind DB contains invalid metadata: the database type is empty")
 	}
-	d := decoder{
-		buffer[searchTreeSize+dataSectionSeparatorSize : metadataStart-len(metadataStartMarker)],
+	switch metadata.RecordSize {
+	case 24, 28, 32:
+	default:
+		return 0, newInvalidDatabaseError(
+			"the MaxMind DB contains invalid metadata: unsupported record size of %d",
+			metadata.RecordSize,
+		)
+	}
+	switch metadata.IPVersion {
+	case IPv4, IPv6:
+	default:
+		return 0, newInvalidDatabaseError(
+			"the MaxMind DB contains invalid metadata: unsupported IP version of %d",
+			metadata.IPVersion,
+		)
 	}
 
-	reader := &Reader{
-		buffer:    buffer,
-		decoder:   d,
-		Metadata:  metadata,
-		ipv4Start: 0,
+	// Without a node, even the root of the search tree would be read as a
+	// record.
+	if metadata.NodeCount == 0 {
+		return 0, newInvalidDatabaseError("the MaxMind DB contains invalid metadata: the search tree has no nodes")
+	}
+	// A record equal to the node count marks an empty network, so the node
+	// count must fit in a record.
+	if uint64(metadata.NodeCount) >= uint64(1)<<metadata.RecordSize {
+		return 0, newInvalidDatabaseError(
+			"the MaxMind DB contains invalid metadata: node count of %d does not fit in a %d bit record",
+			metadata.NodeCount,
+			metadata.RecordSize,
+		)
+	}
+	// The node count fits in 32 bits, so the size of the search tree does
+	// not overflow a uint64, while it would a 32-bit uint.
+	searchTreeSize := uint64(metadata.NodeCount)*uint64(metadata.RecordSize)/4 + DataSectionSeparatorSize
+	if searchTreeSize > uint64(dataSectionEnd) {
+		return 0, newInvalidDatabaseError(
+			"the MaxMind DB contains invalid metadata: a search tree of %d nodes does not fit in the %d bytes before the metadata",
+			metadata.NodeCount,
+			dataSectionEnd,
+		)
+	}
+	return uint(searchTreeSize), nil
+}
+
+// init applies options to the newly created reader and finds the node at
+// which IPv4 lookups begin.
+func (r *Reader) init(options []ReaderOption) (*Reader, error) {
+	r.decoder.reader = r
+	for _, option := range options {
+		option(r)
+	}
+
+	if r.warmCache {
+		if err := r.warmSearchTree(); err != nil {
+			return r, err
+		}
+	}
+
+	var err error
+	r.ipv4Start, r.ipv4StartBitDepth, err = r.startNode()
+
+	return r, err
+}
+
+// OpenBytes is like Open, except that it also returns the contents of the
+// database file, e.g., to pass them to another library without reading the
+// file again. The slice is the buffer used by the Reader, not a copy: where
+// Open memory maps the file, it is a read-only mapping that must not be
+// used after Close and that causes a fault if written to. Elsewhere,
+// modifying the slice corrupts the Reader.
+func OpenBytes(file string, options ...ReaderOption) (*Reader, []byte, error) {
+	reader, err := Open(file, options...)
+	if err != nil {
+		return nil, nil, err
 	}
+	return reader, reader.buffer, nil
+}
 
-	reader.ipv4Start, err = reader.startNode()
+// Buffer returns the contents of the database file the Reader uses, e.g., to
+// decode records with another decoder, starting at DataSectionStart() +
+// offset for an offset from LookupOffset, or to read the search tree
+// alongside ReadNode and ValueSize. As with OpenBytes, the slice is not a
+// copy and must not be modified, nor used after Close; a memory mapped
+// database faults if it is written to. Buffer returns nil once the Reader is
+// closed and for a Reader created by FromReaderAt.
+func (r *Reader) Buffer() []byte {
+	if r.source != nil {
+		return nil
+	}
+	return r.buffer
+}
 
-	return reader, err
+// DataSectionStart returns the position in the database file at which the
+// data section begins. Offsets returned by LookupOffset and accepted by
+// Decode are relative to it: the data for an offset starts at byte
+// DataSectionStart() + offset of the file.
+func (r *Reader) DataSectionStart() uintptr {
+	return uintptr(r.Metadata.NodeCount*r.Metadata.RecordSize/4 + DataSectionSeparatorSize)
 }
 
-func (r *Reader) startNode() (uint, error) {
-	if r.Metadata.IPVersion != 6 {
-		return 0, nil
+// startNode returns the node at which IPv4 lookups begin, along with the bit
+// depth at which it was found. The depth is less than 96 if the search tree
+// terminates before the IPv4 subtree is reached.
+func (r *Reader) startNode() (uint, uint, error) {
+	if !r.Metadata.IsIPv6() {
+		return 0, 96, nil
 	}
 
 	nodeCount := r.Metadata.NodeCount
 
 	node := uint(0)
+	i := uint(0)
 	var err error
-	for i := 0; i < 96 && node < nodeCount; i++ {
+	for ; i < 96 && node < nodeCount; i++ {
 		node, err = r.readNode(node, 0)
 		if err != nil {
-			return 0, err
+			return 0, 0, err
 		}
 	}
-	return node, err
+	return node, i, err
 }
 
 // Lookup takes an IP address as a net.IP structure and a pointer to the
 // result value to Decode into.
+//
+// If the database does not contain a record for the IP address, result is
+// left unchanged and a nil error is returned, or ErrNotFound if the Reader
+// was created with the WithNotFoundError option. Other errors are either
+// caused by invalid arguments or are an InvalidDatabaseError or
+// UnmarshalTypeError describing a problem with the record.
 func (r *Reader) Lookup(ipAddress net.IP, result interface{}) error {
 	if r.buffer == nil {
-		return errors.New("cannot call Lookup on a closed database")
+		return ErrClosed
 	}
-	pointer, err := r.lookupPointer(ipAddress)
-	if pointer == 0 || err != nil {
+	pointer, _, _, err := r.lookupPointer(ipAddress)
+	if err != nil {
 		return err
 	}
+	if pointer == 0 {
+		return r.errNotFound()
+	}
 	return r.retrieveData(pointer, result)
 }
 
+// LookupUint32 is like Lookup, except that it takes an IPv4 address as an
+// integer in which the first octet is the most significant byte, e.g.,
+// 0x01020304 for 1.2.3.4. No net.IP is allocated for the lookup.
+func (r *Reader) LookupUint32(ip uint32, result interface{}) error {
+	if r.buffer == nil {
+		return ErrClosed
+	}
+	ipBytes := [net.IPv4len]byte{byte(ip >> 24), byte(ip >> 16), byte(ip >> 8), byte(ip)}
+	pointer, _, err := r.findAddressInTree(ipBytes[:])
+	if err != nil {
+		return err
+	}
+	if pointer == 0 {
+		return r.errNotFound()
+	}
+	return r.retrieveData(pointer, result)
+}
+
+// LookupAll looks up ipAddress at each location of the database that holds
+// its data and returns the record found at each of them. Each record is
+// decoded into a new value returned by result, e.g.,
+// func() interface{} { return new(geoip2.City) }.
+//
+// IPv6 databases usually alias parts of the IPv6 address space to the IPv4
+// subtree, so that the data of an IPv4 address such as 1.2.3.4 is also found
+// at ::ffff:1.2.3.4, at the Teredo address 2001:0:102:304::, and at the 6to4
+// address 2002:102:304::. For an IPv4 address, or an address within one of
+// these networks, LookupAll returns the record from ::1.2.3.4 followed by
+// those from the aliases the database has, which makes it possible to check
+// that all the aliases lead to the same data. For other IPv6 addresses and in
+// IPv4 databases, it returns the single record of ipAddress.
+//
+// Locations without a record are skipped. If there is no record at all, nil
+// is returned with a nil error, or ErrNotFound if the Reader was created with
+// the WithNotFoundError option.
+func (r *Reader) LookupAll(ipAddress net.IP, result func() interface{}) ([]interface{}, error) {
+	if r.buffer == nil {
+		return nil, ErrClosed
+	}
+	var pointers []uint
+	ipv4, err := r.aliasedIPv4(ipAddress)
+	if err != nil {
+		return nil, err
+	}
+	if ipv4 == nil {
+		pointer, _, _, err := r.lookupPointer(ipAddress)
+		if err != nil {
+			return nil, err
+		}
+		pointers = append(pointers, pointer)
+	} else {
+		for _, location := range ipv4AddressSpaces {
+			aliased, err := r.holdsIPv4(location.prefix, location.prefixLen)
+			if err != nil {
+				return nil, err
+			}
+			if !aliased {
+				continue
+			}
+			ip := make(net.IP, net.IPv6len)
+			copy(ip, location.prefix)
+			copy(ip[location.prefixLen/8:], ipv4)
+			// The IPv6 address is looked up as is, as lookupPointer
+			// would look up an IPv4-mapped address in the IPv4 subtree.
+			pointer, _, err := r.findAddressInTree(ip)
+			if err != nil {
+				return nil, err
+			}
+			pointers = append(pointers, pointer)
+		}
+	}
+
+	var records []interface{}
+	for _, pointer := range pointers {
+		if pointer == 0 {
+			continue
+		}
+		record := result()
+		if err := r.retrieveData(pointer, record); err != nil {
+			return nil, err
+		}
+		records = append(records, record)
+	}
+	if records == nil {
+		return nil, r.errNotFound()
+	}
+	return records, nil
+}
+
+// aliasedIPv4 returns the IPv4 address whose data the IPv6 database holds for
+// ip, if ip is an IPv4 address or within the IPv4 subtree or one of its
+// aliases, and nil otherwise.
+func (r *Reader) aliasedIPv4(ip net.IP) (net.IP, error) {
+	if !r.Metadata.IsIPv6() || r.ipv4StartBitDepth != 96 {
+		return nil, nil
+	}
+	if ipv4 := ip.To4(); ipv4 != nil {
+		return ipv4, nil
+	}
+	if len(ip) != net.IPv6len {
+		return nil, nil
+	}
+	for _, location := range ipv4AddressSpaces {
+		start := location.prefixLen / 8
+		if !bytes.Equal(ip[:start], location.prefix[:start]) {
+			continue
+		}
+		aliased, err := r.holdsIPv4(location.prefix, location.prefixLen)
+		if err != nil || !aliased {
+			return nil, err
+		}
+		return ip[start : start+net.IPv4len], nil
+	}
+	return nil, nil
+}
+
+// holdsIPv4 reports whether the network prefix/prefixLen of the IPv6 database
+// leads to the IPv4 subtree.
+func (r *Reader) holdsIPv4(prefix net.IP, prefixLen uint) (bool, error) {
+	node, depth, err := r.traverseTree(prefix, 0, prefixLen)
+	if err != nil {
+		return false, err
+	}
+	return node == r.ipv4Start && depth == prefixLen, nil
+}
+
+// LookupMany looks up each of ips and decodes its record into the element
+// with the same index of the slice pointed to by results. The slice is
+// resized to the length of ips, reusing its backing array if it is large
+// enough. Elements for IP addresses without a record have their zero value.
+//
+// Decoding directly into the slice avoids the per-call overhead of Lookup,
+// making LookupMany faster for large batches. It stops at the first error,
+// which is returned as a LookupManyError identifying the IP address. The
+// elements for the following IP addresses are left unset.
+func (r *Reader) LookupMany(ips []net.IP, results interface{}) error {
+	if r.buffer == nil {
+		return ErrClosed
+	}
+	rv := reflect.ValueOf(results)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() || rv.Elem().Kind() != reflect.Slice {
+		return errors.New("results param must be a pointer to a slice")
+	}
+
+	slice := rv.Elem()
+	if slice.Cap() >= len(ips) {
+		slice.SetLen(len(ips))
+		zero := reflect.Zero(slice.Type().Elem())
+		for i := 0; i < len(ips); i++ {
+			slice.Index(i).Set(zero)
+		}
+	} else {
+		slice.Set(reflect.MakeSlice(slice.Type(), len(ips), len(ips)))
+	}
+
+	for i, ip := range ips {
+		pointer, _, _, err := r.lookupPointer(ip)
+		if err == nil && pointer != 0 {
+			err = r.decodePointerInto(pointer, slice.Index(i).Addr())
+		}
+		if err != nil {
+			return LookupManyError{Index: i, IP: ip, Err: err}
+		}
+	}
+	return nil
+}
+
+// LookupPath retrieves the value found by following path within the database
+// record for ipAddress and stores it in the value pointed to by result. Each
+// element of path is either a string, to select a key in a map, or an int, to
+// select an index in an array. Only the value at the end of the path is
+// decoded.
+//
+// If the record or any element of the path does not exist, result is left
+// unchanged and no error is returned. With the WithNotFoundError option,
+// ErrNotFound is returned if the record does not exist. An error is returned
+// if a path element does not match the type of the value it is applied to,
+// e.g., an int index applied to a map.
+func (r *Reader) LookupPath(ipAddress net.IP, result interface{}, path ...interface{}) error {
+	if r.buffer == nil {
+		return ErrClosed
+	}
+	pointer, _, _, err := r.lookupPointer(ipAddress)
+	if err != nil {
+		return err
+	}
+	if pointer == 0 {
+		return r.errNotFound()
+	}
+	offset, err := r.resolveDataPointer(pointer)
+	if err != nil || offset == NotFound {
+		return err
+	}
+
+	rv := reflect.ValueOf(result)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return errors.New("result param must be a pointer")
+	}
+	d, dataOffset, err := r.dataDecoder(&r.decoder, uint(offset))
+	if err != nil {
+		return err
+	}
+	return d.decodePath(dataOffset, path, rv)
+}
+
+// LookupName returns the localized name found in the names map of field in
+// the database record for ipAddress, e.g., the name of the city for the
+// "city" field of a City database. The name is that of the first language in
+// langs for which the database has one. If langs is empty, the languages of
+// the database's metadata are used in order. An empty string and a nil error
+// are returned if the field or a name in any of the languages does not
+// exist, and if the database has no record for ipAddress, unless the Reader
+// was created with WithNotFoundError, in which case ErrNotFound is returned.
+func (r *Reader) LookupName(ipAddress net.IP, field string, langs ...string) (string, error) {
+	if r.buffer == nil {
+		return "", ErrClosed
+	}
+	var names map[string]string
+	if err := r.LookupPath(ipAddress, &names, field, "names"); err != nil {
+		return "", err
+	}
+	if len(langs) == 0 {
+		langs = r.Metadata.Languages
+	}
+	for _, lang := range langs {
+		if name, ok := names[lang]; ok {
+			return name, nil
+		}
+	}
+	return "", nil
+}
+
+// LookupNetwork retrieves the database record for ipAddress and stores it in
+// the value pointed to by result. The network returned is the network
+// associated with the data record in the database. The ok return value
+// indicates whether the database contained a record for ipAddress.
+//
+// For IPv4 addresses in an IPv6 database, the returned network is in its
+// 4-byte form.
+func (r *Reader) LookupNetwork(ipAddress net.IP, result interface{}) (network *net.IPNet, ok bool, err error) {
+	if r.buffer == nil {
+		return nil, false, ErrClosed
+	}
+	pointer, prefixLength, ip, err := r.lookupPointer(ipAddress)
+	if err != nil {
+		return nil, false, err
+	}
+
+	network = r.cidr(ip, prefixLength)
+	if pointer == 0 {
+		return network, false, nil
+	}
+	return network, true, r.retrieveData(pointer, result)
+}
+
+// LookupRange is like LookupNetwork, except that it returns the first and the
+// last IP address of the network instead of the network itself. IPv4
+// addresses are returned in their 4-byte form, including for IPv4 networks
+// in an IPv6 database.
+//
+// If the database does not contain a record for the IP address, the range of
+// the largest empty network containing it is returned, result is left
+// unchanged, and the error is nil, or ErrNotFound if the Reader was created
+// with the WithNotFoundError option.
+func (r *Reader) LookupRange(ipAddress net.IP, result interface{}) (start, end net.IP, err error) {
+	if r.buffer == nil {
+		return nil, nil, ErrClosed
+	}
+	pointer, prefixLength, ip, err := r.lookupPointer(ipAddress)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	start, end = networkRange(r.cidr(ip, prefixLength))
+	if pointer == 0 {
+		return start, end, r.errNotFound()
+	}
+	return start, end, r.retrieveData(pointer, result)
+}
+
+// networkRange returns the first and the last IP address of network.
+func networkRange(network *net.IPNet) (net.IP, net.IP) {
+	start := network.IP.Mask(network.Mask)
+	end := make(net.IP, len(start))
+	for i := range start {
+		end[i] = start[i] | ^network.Mask[i]
+	}
+	return start, end
+}
+
+// LookupPrefix returns the prefix length of the network in the database that
+// contains ipAddress, as well as whether the database contains a record for
+// it. If there is no record, the prefix length is that of the largest empty
+// network containing ipAddress. The prefix length is the same as that of the
+// network returned by LookupNetwork, but neither the record is decoded nor
+// the network constructed.
+func (r *Reader) LookupPrefix(ipAddress net.IP) (prefixLen int, ok bool, err error) {
+	if r.buffer == nil {
+		return 0, false, ErrClosed
+	}
+	pointer, prefixLength, ip, err := r.lookupPointer(ipAddress)
+	if err != nil {
+		return 0, false, err
+	}
+	if len(ip) == net.IPv4len && r.ipv4StartBitDepth != 96 {
+		// See cidr.
+		prefixLength = r.ipv4StartBitDepth
+	}
+	return int(prefixLength), pointer != 0, nil
+}
+
+// Contains reports whether the database has a record with data for
+// ipAddress, e.g., whether ipAddress is in an allowlist or blocklist
+// database. Only the search tree is walked; the record is not decoded. The
+// empty records the WithEmptyNodes option treats as records have no data, so
+// Contains reports false for them.
+func (r *Reader) Contains(ipAddress net.IP) (bool, error) {
+	if r.buffer == nil {
+		return false, ErrClosed
+	}
+	pointer, _, _, err := r.lookupPointer(ipAddress)
+	if err != nil {
+		return false, err
+	}
+	return pointer > r.Metadata.NodeCount, nil
+}
+
 // LookupOffset maps an argument net.IP to a corresponding record offset in the
 // database. NotFound is returned if no such record is found, and a record may
 // otherwise be extracted by passing the returned offset to Decode. LookupOffset
@@ -124,9 +820,9 @@ func (r *Reader) Lookup(ipAddress net.IP, result interface{}) error {
 // previously-decoded records.
 func (r *Reader) LookupOffset(ipAddress net.IP) (uintptr, error) {
 	if r.buffer == nil {
-		return 0, errors.New("cannot call LookupOffset on a closed database")
+		return 0, ErrClosed
 	}
-	pointer, err := r.lookupPointer(ipAddress)
+	pointer, _, _, err := r.lookupPointer(ipAddress)
 	if pointer == 0 || err != nil {
 		return NotFound, err
 	}
@@ -143,46 +839,155 @@ func (r *Reader) LookupOffset(ipAddress net.IP) (uintptr, error) {
 // the structure, the decoder will not decode that field, reducing the time
 // required to decode the record.
 //
+// As with encoding/json, the fields of an embedded struct, or a pointer to
+// one, are decoded from the keys of the map the outer struct is decoded
+// from. An embedded struct with a name in its tag, e.g.,
+// `maxminddb:"location"`, is instead decoded from that key like any other
+// field.
+//
+// When decoding into an empty interface{}, integers keep the width of their
+// database type: uint16, uint32 and uint64 values decode to the Go types of
+// the same name, int32 values to int32 and uint128 values to *big.Int.
+//
+// If result points to a non-nil map, the record is decoded into that map:
+// its entries are overwritten and entries the record does not have are
+// deleted. Repeated lookups into the same map thus allocate less. A map held
+// in an interface{}, including one result points to, is always replaced by a
+// newly allocated map rather than modified. A non-nil map in a struct field,
+// e.g., a Names field left over from an earlier lookup into the same struct,
+// is decoded into as well, but its entries the record does not have are
+// kept. Set such fields to nil before decoding to get only the entries of the
+// record.
+//
+// Maps may also be decoded into Go maps with integer keys, e.g.,
+// map[int]string, for data keyed by numeric identifiers: the keys, which are
+// always strings in the database, are parsed as decimal numbers, and a key
+// that is not a number of the key type is an UnmarshalTypeError.
+//
+// Arrays may be decoded into slices, including nested slices such as
+// [][]float64, or into Go arrays such as [2]float64. Elements of a Go array
+// past the end of the database array are set to their zero value and
+// database elements that do not fit in the Go array are ignored. With the
+// WithStrictArrayLength option, decoding an array into a Go array of a
+// different length fails with an UnmarshalTypeError instead.
+//
+// A time.Time field may be decoded from an integer holding Unix time by
+// adding the unixsec or unixmilli option to its tag, e.g.,
+// `maxminddb:"last_seen,unixsec"` for seconds and
+// `maxminddb:"last_seen,unixmilli"` for milliseconds. The time is in UTC.
+// Likewise, an integer is decoded into a time.Duration field as a number of
+// nanoseconds, or of seconds with the seconds option, e.g.,
+// `maxminddb:"ttl,seconds"`.
+//
+// A bytes value may be decoded into a byte array of the same length, e.g., a
+// [16]byte for a fixed-width identifier. A bytes value holding a 4- or
+// 16-byte IP address may be decoded into a net.IP. With the ip tag option,
+// e.g., `maxminddb:"gateway,ip"`, it may also be decoded into a string,
+// which receives the address in its textual form, or into a type
+// implementing encoding.BinaryUnmarshaler such as netip.Addr.
+//
 // As a special case, a struct field of type uintptr will be used to capture
 // the offset of the value. Decode may later be used to extract the stored
 // value from the offset. MaxMind DBs are highly normalized: for example in
 // the City database, all records of the same country will reference a
 // single representative record for that country. This uintptr behavior allows
 // clients to leverage this normalization in their own sub-record caching.
+//
+// Offsets are stable for the lifetime of the Reader. An error is returned if
+// offset is not within the data section, e.g., if NotFound is passed.
 func (r *Reader) Decode(offset uintptr, result interface{}) error {
 	if r.buffer == nil {
-		return errors.New("cannot call Decode on a closed database")
+		return ErrClosed
+	}
+	if offset >= uintptr(r.dataSectionSize()) {
+		return fmt.Errorf("offset %d passed to Decode is outside of the data section", offset)
 	}
 	return r.decode(offset, result)
 }
 
+// ValueSize returns the number of bytes the value at offset in the data
+// section occupies, including its control byte and, for maps and arrays,
+// all of their contents. A pointer is not followed and occupies only its
+// own bytes, so the size of a record may be less than the size of its data.
+// This allows tools to skip over values without decoding them.
+func (r *Reader) ValueSize(offset uintptr) (uintptr, error) {
+	if r.buffer == nil {
+		return 0, ErrClosed
+	}
+	if r.source != nil {
+		return 0, errors.New("maxminddb: ValueSize is not supported for a Reader created by FromReaderAt")
+	}
+	if offset >= uintptr(len(r.decoder.buffer)) {
+		return 0, fmt.Errorf("offset %d passed to ValueSize is outside of the data section", offset)
+	}
+	size, err := r.decoder.valueSize(uint(offset))
+	return uintptr(size), err
+}
+
 func (r *Reader) decode(offset uintptr, result interface{}) error {
 	rv := reflect.ValueOf(result)
 	if rv.Kind() != reflect.Ptr || rv.IsNil() {
 		return errors.New("result param must be a pointer")
 	}
 
-	_, err := r.decoder.decode(uint(offset), rv, 0)
-	return err
+	d, dataOffset, err := r.dataDecoder(&r.decoder, uint(offset))
+	if err != nil {
+		return err
+	}
+	return d.decodeRecord(dataOffset, rv)
 }
 
-func (r *Reader) lookupPointer(ipAddress net.IP) (uint, error) {
+// cidr returns the network of the given prefix length containing ip. The
+// prefix length is relative to ip, i.e., for a 4-byte IP in an IPv6 database
+// the bits above the IPv4 start node are not included.
+func (r *Reader) cidr(ip net.IP, prefixLength uint) *net.IPNet {
+	// The IPv4 start node may be at a depth of less than 96 when the
+	// search tree terminates before reaching the IPv4 subtree, e.g., if
+	// ::/64 is in the database and there is no IPv4 data.
+	if len(ip) == net.IPv4len && r.ipv4StartBitDepth != 96 {
+		return &net.IPNet{
+			IP:   make(net.IP, net.IPv6len),
+			Mask: net.CIDRMask(int(r.ipv4StartBitDepth), 128),
+		}
+	}
+
+	mask := net.CIDRMask(int(prefixLength), len(ip)*8)
+	ip = ip.Mask(mask)
+	if len(ip) == net.IPv6len && prefixLength >= 96 {
+		if sanitized := ipv4SubtreeNetworkIP(ip, prefixLength); len(sanitized) == net.IPv4len {
+			return &net.IPNet{
+				IP:   sanitized,
+				Mask: net.CIDRMask(int(prefixLength)-96, 32),
+			}
+		}
+	}
+	return &net.IPNet{IP: ip, Mask: mask}
+}
+
+// lookupPointer returns the search tree pointer for ipAddress, the prefix
+// length at which the search terminated, and the form of the IP address used
+// for the search.
+func (r *Reader) lookupPointer(ipAddress net.IP) (uint, uint, net.IP, error) {
 	if ipAddress == nil {
-		return 0, errors.New("ipAddress passed to Lookup cannot be nil")
+		return 0, 0, nil, errors.New("ipAddress passed to Lookup cannot be nil")
 	}
 
 	ipV4Address := ipAddress.To4()
 	if ipV4Address != nil {
 		ipAddress = ipV4Address
 	}
-	if len(ipAddress) == 16 && r.Metadata.IPVersion == 4 {
-		return 0, fmt.Errorf("error looking up '%s': you attempted to look up an IPv6 address in an IPv4-only database", ipAddress.String())
+	if len(ipAddress) != net.IPv4len && len(ipAddress) != net.IPv6len {
+		return 0, 0, nil, fmt.Errorf("error looking up %v: an IP address must be 4 or 16 bytes, not %d", []byte(ipAddress), len(ipAddress))
+	}
+	if len(ipAddress) == 16 && r.Metadata.IPVersion == IPv4 {
+		return 0, 0, nil, fmt.Errorf("error looking up '%s': you attempted to look up an IPv6 address in an IPv4-only database", ipAddress.String())
 	}
 
-	return r.findAddressInTree(ipAddress)
+	pointer, prefixLength, err := r.findAddressInTree(ipAddress)
+	return pointer, prefixLength, ipAddress, err
 }
 
-func (r *Reader) findAddressInTree(ipAddress net.IP) (uint, error) {
+func (r *Reader) findAddressInTree(ipAddress net.IP) (uint, uint, error) {
 
 	bitCount := uint(len(ipAddress) * 8)
 
@@ -193,66 +998,255 @@ func (r *Reader) findAddressInTree(ipAddress net.IP) (uint, error) {
 
 	nodeCount := r.Metadata.NodeCount
 
-	for i := uint(0); i < bitCount && node < nodeCount; i++ {
+	var prefixLength uint
+	var err error
+	if bitCount == 32 {
+		// Copying the address to an array lets the search use its bits as
+		// an integer without indexing ipAddress for each bit.
+		node, prefixLength, err = r.traverseIPv4(
+			[net.IPv4len]byte{ipAddress[0], ipAddress[1], ipAddress[2], ipAddress[3]},
+			node,
+		)
+	} else {
+		node, prefixLength, err = r.traverseTree(ipAddress, node, bitCount)
+	}
+	if err != nil {
+		return 0, 0, err
+	}
+	if node == nodeCount {
+		// Record is empty
+		if r.emptyNodes {
+			return node, prefixLength, nil
+		}
+		return 0, prefixLength, nil
+	} else if node > nodeCount {
+		return node, prefixLength, nil
+	}
+
+	return 0, 0, newInvalidDatabaseError("invalid node in search tree")
+}
+
+// traverseTree walks the search tree from node following the first bitCount
+// bits of ipAddress. It stops early when it reaches a data pointer or the
+// empty record and returns the final node together with the number of bits
+// consumed.
+func (r *Reader) traverseTree(ipAddress net.IP, node uint, bitCount uint) (uint, uint, error) {
+	nodeCount := r.Metadata.NodeCount
+
+	i := uint(0)
+	for ; i < bitCount && node < nodeCount; i++ {
 		bit := uint(1) & (uint(ipAddress[i>>3]) >> (7 - (i % 8)))
 
 		var err error
 		node, err = r.readNode(node, bit)
 		if err != nil {
-			return 0, err
+			return 0, 0, err
 		}
 	}
-	if node == nodeCount {
-		// Record is empty
-		return 0, nil
-	} else if node > nodeCount {
-		return node, nil
+	return node, i, nil
+}
+
+// traverseIPv4 is traverseTree for an IPv4 address held in an array, which
+// stays on the stack, rather than in a net.IP.
+func (r *Reader) traverseIPv4(ip [net.IPv4len]byte, node uint) (uint, uint, error) {
+	nodeCount := r.Metadata.NodeCount
+	bits := binary.BigEndian.Uint32(ip[:])
+
+	i := uint(0)
+	for ; i < 32 && node < nodeCount; i++ {
+		var err error
+		node, err = r.readNode(node, uint(bits>>(31-i))&1)
+		if err != nil {
+			return 0, 0, err
+		}
 	}
+	return node, i, nil
+}
 
-	return 0, newInvalidDatabaseError("invalid node in search tree")
+// ReadNode returns a record of node nodeNumber of the search tree, its left
+// record if index is 0 and its right record if index is 1. The root of the
+// tree is node 0 and the record for a bit of an IP address is the left record
+// if the bit is 0. The value returned is one of:
+//
+//   - less than Metadata.NodeCount: the number of the node to continue with;
+//   - equal to Metadata.NodeCount: there is no data for the network;
+//   - greater than Metadata.NodeCount: a pointer to the data for the network.
+//     The data is at offset value - Metadata.NodeCount -
+//     DataSectionSeparatorSize of the data section, which may be passed to
+//     Decode.
+func (r *Reader) ReadNode(nodeNumber uint, index int) (uint, error) {
+	if r.buffer == nil {
+		return 0, ErrClosed
+	}
+	if index != 0 && index != 1 {
+		return 0, fmt.Errorf("index passed to ReadNode must be 0 or 1, got %d", index)
+	}
+	if nodeNumber >= r.Metadata.NodeCount {
+		return 0, fmt.Errorf(
+			"node number %d passed to ReadNode is not less than the node count of %d",
+			nodeNumber,
+			r.Metadata.NodeCount,
+		)
+	}
+	return r.readNode(nodeNumber, uint(index))
 }
 
-func (r *Reader) readNode(nodeNumber uint, index uint) (uint, error) {
-	RecordSize := r.Metadata.RecordSize
+// warmSearchTree reads the search tree for WithWarmCache.
+func (r *Reader) warmSearchTree() error {
+	treeSize := r.Metadata.NodeCount * r.Metadata.RecordSize / 4
+	if r.source != nil {
+		// The search tree is at the start of the file, so the node readers
+		// of FromBytes work on it as they are.
+		tree := make([]byte, treeSize)
+		if err := r.source.readAt(tree, 0); err != nil {
+			return err
+		}
+		r.buffer = tree
+		r.readNodeFn = nodeReader(r.Metadata.RecordSize)
+		return nil
+	}
+	var sum byte
+	for i := uint(0); i < treeSize; i += uint(os.Getpagesize()) {
+		sum += r.buffer[i]
+	}
+	runtime.KeepAlive(sum)
+	return nil
+}
 
-	baseOffset := nodeNumber * RecordSize / 4
+func (r *Reader) readNode(nodeNumber uint, index uint) (uint, error) {
+	return r.readNodeFn(r, nodeNumber, index)
+}
 
-	var nodeBytes []byte
-	var prefix uint
-	switch RecordSize {
+// nodeReader returns the function reading the records of a search tree with
+// recordSize bit records. Each is specialized for its record size, and the
+// function is chosen once by FromBytes, so that the search tree walks do not
+// branch on the record size for every node.
+func nodeReader(recordSize uint) func(r *Reader, nodeNumber uint, index uint) (uint, error) {
+	switch recordSize {
 	case 24:
-		offset := baseOffset + index*3
-		nodeBytes = r.buffer[offset : offset+3]
+		return (*Reader).readNode24
 	case 28:
-		prefix = uint(r.buffer[baseOffset+3])
-		if index != 0 {
-			prefix &= 0x0F
-		} else {
-			prefix = (0xF0 & prefix) >> 4
-		}
-		offset := baseOffset + index*4
-		nodeBytes = r.buffer[offset : offset+3]
+		return (*Reader).readNode28
 	case 32:
-		offset := baseOffset + index*4
-		nodeBytes = r.buffer[offset : offset+4]
-	default:
-		return 0, newInvalidDatabaseError("unknown record size: %d", RecordSize)
+		return (*Reader).readNode32
+	}
+	return func(*Reader, uint, uint) (uint, error) {
+		return 0, newInvalidDatabaseError("unknown record size: %d", recordSize)
 	}
-	return uintFromBytes(prefix, nodeBytes), nil
 }
 
-func (r *Reader) retrieveData(pointer uint, result interface{}) error {
+func (r *Reader) readNode24(nodeNumber uint, index uint) (uint, error) {
+	baseOffset := nodeNumber * 6
+	if nodeNumber >= r.Metadata.NodeCount || baseOffset+6 > uint(len(r.buffer)) {
+		return 0, r.nodePastEndError(nodeNumber, 6)
+	}
+	return record24(r.buffer[baseOffset:baseOffset+6], index), nil
+}
+
+func (r *Reader) readNode28(nodeNumber uint, index uint) (uint, error) {
+	baseOffset := nodeNumber * 7
+	if nodeNumber >= r.Metadata.NodeCount || baseOffset+7 > uint(len(r.buffer)) {
+		return 0, r.nodePastEndError(nodeNumber, 7)
+	}
+	return record28(r.buffer[baseOffset:baseOffset+7], index), nil
+}
+
+func (r *Reader) readNode32(nodeNumber uint, index uint) (uint, error) {
+	baseOffset := nodeNumber * 8
+	if nodeNumber >= r.Metadata.NodeCount || baseOffset+8 > uint(len(r.buffer)) {
+		return 0, r.nodePastEndError(nodeNumber, 8)
+	}
+	return record32(r.buffer[baseOffset:baseOffset+8], index), nil
+}
+
+// record24 returns the left record of the 6 byte node if index is 0 and its
+// right record otherwise.
+func record24(node []byte, index uint) uint {
+	b := node[index*3 : index*3+3]
+	return uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])
+}
+
+// record28 is like record24 for a 7 byte node. The middle byte of the node
+// holds the most significant bits of both records: the high nibble those of
+// the left record and the low nibble those of the right one.
+func record28(node []byte, index uint) uint {
+	if index == 0 {
+		return uint(node[3]&0xF0)<<20 | uint(node[0])<<16 | uint(node[1])<<8 | uint(node[2])
+	}
+	return uint(node[3]&0x0F)<<24 | uint(node[4])<<16 | uint(node[5])<<8 | uint(node[6])
+}
+
+// record32 is like record24 for an 8 byte node.
+func record32(node []byte, index uint) uint {
+	b := node[index*4 : index*4+4]
+	return uint(b[0])<<24 | uint(b[1])<<16 | uint(b[2])<<8 | uint(b[3])
+}
+
+// nodePastEndError returns the error for reading node nodeNumber, of
+// nodeSize bytes, past the end of the search tree. FromBytes ensures the
+// search tree fits in the buffer, so only such node numbers fail to read.
+func (r *Reader) nodePastEndError(nodeNumber uint, nodeSize uint) error {
+	return newInvalidDatabaseError(
+		"the MaxMind DB file's search tree is corrupt: node %d at offset %d is past the end of the %d byte search tree",
+		nodeNumber,
+		nodeNumber*nodeSize,
+		r.Metadata.NodeCount*nodeSize,
+	)
+}
+
+// errNotFound returns the error to return from a lookup for an IP address
+// without a record.
+func (r *Reader) errNotFound() error {
+	if r.notFoundError {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// decodePointerInto decodes the data record for the search tree pointer into
+// result, which must be a non-nil pointer.
+func (r *Reader) decodePointerInto(pointer uint, result reflect.Value) error {
+	if r.buffer == nil {
+		return ErrClosed
+	}
 	offset, err := r.resolveDataPointer(pointer)
+	if err != nil || offset == NotFound {
+		return err
+	}
+	if r.cache != nil {
+		return r.decodeCached(offset, result.Interface())
+	}
+	d, dataOffset, err := r.dataDecoder(&r.decoder, uint(offset))
 	if err != nil {
 		return err
 	}
+	return d.decodeRecord(dataOffset, result)
+}
+
+func (r *Reader) retrieveData(pointer uint, result interface{}) error {
+	if r.buffer == nil {
+		return ErrClosed
+	}
+	offset, err := r.resolveDataPointer(pointer)
+	if err != nil || offset == NotFound {
+		return err
+	}
+	if r.cache != nil {
+		return r.decodeCached(offset, result)
+	}
 	return r.decode(offset, result)
 }
 
+// resolveDataPointer returns the data section offset of the search tree
+// pointer, or NotFound for the empty record, which only reaches it with the
+// WithEmptyNodes option.
 func (r *Reader) resolveDataPointer(pointer uint) (uintptr, error) {
-	var resolved = uintptr(pointer - r.Metadata.NodeCount - dataSectionSeparatorSize)
+	if pointer == r.Metadata.NodeCount {
+		return NotFound, nil
+	}
+	var resolved = uintptr(pointer - r.Metadata.NodeCount - DataSectionSeparatorSize)
 
-	if resolved > uintptr(len(r.buffer)) {
+	if resolved >= uintptr(r.dataSectionSize()) {
 		return 0, newInvalidDatabaseError("the MaxMind DB file's search tree is corrupt")
 	}
 	return resolved, nil
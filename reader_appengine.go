@@ -1,28 +1,59 @@
-// +build appengine
+//go:build appengine || plan9 || js || wasip1
+// +build appengine plan9 js wasip1
 
 package maxminddb
 
-import "io/ioutil"
+import (
+	"io"
+	"io/ioutil"
+	"os"
+)
 
 // Open takes a string path to a MaxMind DB file and returns a Reader
 // structure or an error. The database file is opened using a memory map,
-// except on Google App Engine where mmap is not supported; there the database
-// is loaded into memory. Use the Close method on the Reader object to return
-// the resources to the system.
-func Open(file string) (*Reader, error) {
+// except on Google App Engine and on platforms without mmap support; there the
+// database is loaded into memory. Use the Close method on the Reader object to
+// return the resources to the system.
+func Open(file string, options ...ReaderOption) (*Reader, error) {
 	bytes, err := ioutil.ReadFile(file)
 	if err != nil {
 		return nil, err
 	}
 
-	return FromBytes(bytes)
+	return FromBytes(bytes, options...)
+}
+
+// openFile reads the database in f from its start. The caller closes f.
+func openFile(f *os.File, options []ReaderOption) (*Reader, error) {
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	bytes, err := ioutil.ReadAll(f)
+	if err != nil {
+		return nil, err
+	}
+
+	return FromBytes(bytes, options...)
 }
 
 // Close unmaps the database file from virtual memory and returns the
 // resources to the system. If called on a Reader opened using FromBytes
-// or Open on Google App Engine, this method sets the underlying buffer
-// to nil, returning the resources to the system.
+// or Open on Google App Engine or a platform without mmap support, this
+// method sets the underlying buffer to nil, returning the resources to the
+// system. Once Close has returned, the methods of the Reader and of the
+// iterators created from it return ErrClosed. Calling Close more than once is
+// safe, but Close must not be called while the Reader or its iterators are in
+// use by other goroutines, as the check for a closed Reader is not
+// synchronized with Close.
+//
+// Values decoded from the database do not refer to its memory: strings and
+// byte slices are copied out of it, so they remain valid after Close and may
+// be shared between goroutines. The exception is a LazyArray, which decodes
+// its elements from the database when they are requested. With
+// WithDecodeCache, the maps, slices, and pointers of a result are also those
+// of the cached record, so results must be treated as read-only.
 func (r *Reader) Close() error {
 	r.buffer = nil
+	r.decoder.buffer = nil
 	return nil
 }
@@ -0,0 +1,365 @@
+package maxminddb
+
+import (
+	"container/list"
+	"errors"
+	"io"
+	"sync"
+)
+
+const (
+	// metadataMaxSize is the maximum size of the metadata section, including
+	// its start marker, allowed by the MaxMind DB specification.
+	metadataMaxSize = 128 * 1024
+
+	// readAtWindowSize is the number of bytes of the data section read at
+	// once when copying a record out of a database read through an
+	// io.ReaderAt. Most records fit in a single read.
+	readAtWindowSize = 4096
+)
+
+// readerAtSource is the database of a Reader created by FromReaderAt.
+type readerAtSource struct {
+	readerAt         io.ReaderAt
+	size             int64
+	dataSectionStart uint
+	dataSectionSize  uint
+}
+
+// FromReaderAt returns a Reader for the MaxMind DB file of size bytes that
+// readerAt reads from, e.g., an *os.File or a *bytes.Reader. Unlike Open and
+// FromBytes, the Reader does not keep the database in memory: the nodes of
+// the search tree and the records are read from readerAt as lookups need
+// them. This trades the memory of the database for a read of each node and
+// record, which makes lookups considerably slower, particularly on slow
+// storage. WithNodeCache avoids reading frequently visited nodes again,
+// WithWarmCache keeps the whole search tree in memory, and WithDecodeCache
+// avoids reading frequently used records again.
+//
+// readerAt must be safe for concurrent use if the Reader is, as is the case
+// for *os.File and *bytes.Reader, and must remain usable until the Reader is
+// closed. Closing the Reader does not close readerAt.
+//
+// As records are copied out of the data section before they are decoded,
+// decoding into a uintptr, e.g., a struct field receiving the offset of a
+// value, returns an error. ValueSize, Verify, and VerifyAll are not
+// supported.
+func FromReaderAt(readerAt io.ReaderAt, size int64, options ...ReaderOption) (*Reader, error) {
+	if size < 0 {
+		return nil, errors.New("size passed to FromReaderAt must not be negative")
+	}
+	source := &readerAtSource{readerAt: readerAt, size: size}
+
+	tailStart := size - metadataMaxSize
+	if tailStart < 0 {
+		tailStart = 0
+	}
+	tail := make([]byte, size-tailStart)
+	if err := source.readAt(tail, tailStart); err != nil {
+		return nil, err
+	}
+	metadata, tailDataSectionEnd, err := decodeMetadata(tail)
+	if err != nil {
+		return nil, err
+	}
+	dataSectionEnd := uint(tailStart) + tailDataSectionEnd
+	dataSectionStart, err := validateMetadata(metadata, dataSectionEnd)
+	if err != nil {
+		return nil, err
+	}
+	source.dataSectionStart = dataSectionStart
+	source.dataSectionSize = dataSectionEnd - dataSectionStart
+
+	reader := &Reader{
+		// The buffer only marks the Reader as open.
+		buffer:     []byte{},
+		source:     source,
+		Metadata:   metadata,
+		ipv4Start:  0,
+		readNodeFn: (*Reader).readNodeAt,
+	}
+	return reader.init(options)
+}
+
+// readAt fills p with the bytes of the database at off.
+func (s *readerAtSource) readAt(p []byte, off int64) error {
+	n, err := s.readerAt.ReadAt(p, off)
+	if n == len(p) {
+		// ReaderAt may return io.EOF along with the last bytes.
+		return nil
+	}
+	if err == nil || err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+func (r *Reader) readNodeAt(nodeNumber uint, index uint) (uint, error) {
+	if r.nodeCache != nil {
+		if records, ok := r.nodeCache.get(nodeNumber); ok {
+			return records[index], nil
+		}
+	}
+	nodeSize := r.Metadata.RecordSize / 4
+	if nodeNumber >= r.Metadata.NodeCount {
+		return 0, r.nodePastEndError(nodeNumber, nodeSize)
+	}
+	var buf [8]byte
+	node := buf[:nodeSize]
+	if err := r.source.readAt(node, int64(nodeNumber*nodeSize)); err != nil {
+		return 0, err
+	}
+	var records [2]uint
+	for i := range records {
+		switch nodeSize {
+		case 6:
+			records[i] = record24(node, uint(i))
+		case 7:
+			records[i] = record28(node, uint(i))
+		default:
+			records[i] = record32(node, uint(i))
+		}
+	}
+	if r.nodeCache != nil {
+		r.nodeCache.add(nodeNumber, records)
+	}
+	return records[index], nil
+}
+
+// WithNodeCache returns a ReaderOption that keeps up to size nodes of the
+// search tree in an in-memory LRU cache for a Reader created by
+// FromReaderAt. The nodes near the root of the tree are visited by most
+// lookups, so they are then read from the io.ReaderAt only once rather than
+// on every lookup. The option has no effect on other Readers, whose search
+// tree is in memory, or with WithWarmCache. A size of zero or less disables
+// the cache.
+func WithNodeCache(size int) ReaderOption {
+	return func(r *Reader) {
+		if size <= 0 {
+			r.nodeCache = nil
+			return
+		}
+		r.nodeCache = newNodeCache(size)
+	}
+}
+
+type nodeCacheEntry struct {
+	node    uint
+	records [2]uint
+}
+
+// nodeCache is an LRU cache of the records of search tree nodes. It is safe
+// for concurrent use.
+type nodeCache struct {
+	mu      sync.Mutex
+	size    int
+	entries map[uint]*list.Element
+	lru     *list.List // Most recently used entries are at the front.
+}
+
+func newNodeCache(size int) *nodeCache {
+	return &nodeCache{
+		size:    size,
+		entries: make(map[uint]*list.Element, size),
+		lru:     list.New(),
+	}
+}
+
+func (c *nodeCache) get(node uint) ([2]uint, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, ok := c.entries[node]
+	if !ok {
+		return [2]uint{}, false
+	}
+	c.lru.MoveToFront(e)
+	return e.Value.(*nodeCacheEntry).records, true
+}
+
+func (c *nodeCache) add(node uint, records [2]uint) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if e, ok := c.entries[node]; ok {
+		c.lru.MoveToFront(e)
+		return
+	}
+	c.entries[node] = c.lru.PushFront(&nodeCacheEntry{node, records})
+	if c.lru.Len() > c.size {
+		oldest := c.lru.Back()
+		c.lru.Remove(oldest)
+		delete(c.entries, oldest.Value.(*nodeCacheEntry).node)
+	}
+}
+
+func (c *nodeCache) len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.lru.Len()
+}
+
+// fileSize returns the size of the database file.
+func (r *Reader) fileSize() uint {
+	if r.source != nil {
+		return uint(r.source.size)
+	}
+	return uint(len(r.buffer))
+}
+
+// dataSectionSize returns the size of the data section.
+func (r *Reader) dataSectionSize() uint {
+	if r.source != nil {
+		return r.source.dataSectionSize
+	}
+	return uint(len(r.decoder.buffer))
+}
+
+// dataDecoder returns the decoder to decode the value at offset of the data
+// section with, which is d itself unless the Reader was created by
+// FromReaderAt, along with the offset of the value in the decoder's buffer.
+// For FromReaderAt, the value is read into a buffer of its own, with the
+// values it points to in place of the pointers, and decoded from there with
+// the options of d.
+//
+// With WithTypeResolver, the decoder tracks the key path of the value it
+// decodes, so a copy of d is returned in any case.
+func (r *Reader) dataDecoder(d *decoder, offset uint) (*decoder, uint, error) {
+	if r.source == nil {
+		if d.resolveType != nil {
+			valueDecoder := *d
+			valueDecoder.keyPath = nil
+			return &valueDecoder, offset, nil
+		}
+		return d, offset, nil
+	}
+	c := rawCopier{source: r.source}
+	raw, _, err := c.copyRaw(nil, offset, 0)
+	if err != nil {
+		return nil, 0, err
+	}
+	valueDecoder := *d
+	valueDecoder.buffer = raw
+	valueDecoder.keyPath = nil
+	valueDecoder.copiedRecord = true
+	return &valueDecoder, 0, nil
+}
+
+// rawCopier is like decoder.copyRaw for the data section of a database read
+// through an io.ReaderAt. It reads the data section in windows of
+// readAtWindowSize bytes, so that a record and the values it points to take
+// few reads.
+type rawCopier struct {
+	source      *readerAtSource
+	window      []byte
+	windowStart uint
+}
+
+// bytesAt returns n bytes of the data section at offset, or fewer if the
+// data section ends before. The bytes are only valid until the next call.
+func (c *rawCopier) bytesAt(offset uint, n uint) ([]byte, error) {
+	size := c.source.dataSectionSize
+	if offset > size {
+		return nil, newOffsetError(offset, size)
+	}
+	if offset+n > size {
+		n = size - offset
+	}
+	if offset < c.windowStart || offset+n > c.windowStart+uint(len(c.window)) {
+		windowSize := n
+		if windowSize < readAtWindowSize {
+			windowSize = readAtWindowSize
+		}
+		if offset+windowSize > size {
+			windowSize = size - offset
+		}
+		if uint(cap(c.window)) < windowSize {
+			c.window = make([]byte, windowSize)
+		}
+		c.window = c.window[:windowSize]
+		c.windowStart = offset
+		if err := c.source.readAt(c.window, int64(c.source.dataSectionStart+offset)); err != nil {
+			return nil, err
+		}
+	}
+	return c.window[offset-c.windowStart : offset-c.windowStart+n], nil
+}
+
+// maxCtrlDataSize is the size of the largest control data: the control byte,
+// the extended type byte, and three bytes of size.
+const maxCtrlDataSize = 5
+
+func (c *rawCopier) copyRaw(dst []byte, offset uint, depth int) ([]byte, uint, error) {
+	if depth > maximumDataStructureDepth {
+		return nil, 0, newInvalidDatabaseError("exceeded maximum data structure depth; database is likely corrupt")
+	}
+	ctrlData, err := c.bytesAt(offset, maxCtrlDataSize)
+	if err != nil {
+		return nil, 0, err
+	}
+	ctrlDecoder := decoder{buffer: ctrlData}
+	typeNum, size, ctrlSize, err := ctrlDecoder.decodeCtrlData(0)
+	if err != nil {
+		return nil, 0, err
+	}
+	dataOffset := offset + ctrlSize
+
+	switch typeNum {
+	case _Pointer:
+		pointerSize := ((size >> 3) & 0x3) + 1
+		pointerBytes, err := c.bytesAt(dataOffset, pointerSize)
+		if err != nil {
+			return nil, 0, err
+		}
+		pointerDecoder := decoder{buffer: pointerBytes}
+		pointer, _, err := pointerDecoder.decodePointer(size, 0)
+		if err != nil {
+			return nil, 0, err
+		}
+		dst, _, err = c.copyRaw(dst, pointer, depth+1)
+		return dst, dataOffset + pointerSize, err
+	case _Container:
+		// As in decoder.copyRaw, only the value is kept, as the size of the
+		// container no longer matches once pointers are replaced.
+		end := dataOffset + size
+		var valueEnd uint
+		dst, valueEnd, err = c.copyRaw(dst, dataOffset, depth+1)
+		if err != nil {
+			return nil, 0, err
+		}
+		if valueEnd > end {
+			return nil, 0, newInvalidDatabaseError(
+				"the MaxMind DB file's data section contains bad data (container of %v bytes at offset %v holds a value of %v bytes)",
+				size,
+				dataOffset,
+				valueEnd-dataOffset,
+			)
+		}
+		return dst, end, nil
+	case _Map, _Slice:
+		dst = append(dst, ctrlData[:ctrlSize]...)
+		count := size
+		if typeNum == _Map {
+			count *= 2
+		}
+		for i := uint(0); i < count; i++ {
+			dst, dataOffset, err = c.copyRaw(dst, dataOffset, depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+		}
+		return dst, dataOffset, nil
+	case _Bool:
+		return append(dst, ctrlData[:ctrlSize]...), dataOffset, nil
+	default:
+		dst = append(dst, ctrlData[:ctrlSize]...)
+		value, err := c.bytesAt(dataOffset, size)
+		if err != nil {
+			return nil, 0, err
+		}
+		if uint(len(value)) < size {
+			return nil, 0, newOffsetError(dataOffset+size, c.source.dataSectionSize)
+		}
+		return append(dst, value...), dataOffset + size, nil
+	}
+}
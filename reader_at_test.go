@@ -0,0 +1,318 @@
+package maxminddb
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// readerAtRecords returns the networks of reader with their records.
+func readerAtRecords(t *testing.T, reader *Reader) map[string]interface{} {
+	records := map[string]interface{}{}
+	n := reader.Networks()
+	for n.Next() {
+		var record interface{}
+		network, err := n.Network(&record)
+		require.Nil(t, err)
+		records[network.String()] = record
+	}
+	require.Nil(t, n.Err())
+	return records
+}
+
+func TestFromReaderAt(t *testing.T) {
+	for _, fileName := range []string{
+		"MaxMind-DB-test-ipv4-24.mmdb",
+		"MaxMind-DB-test-ipv6-28.mmdb",
+		"MaxMind-DB-test-mixed-32.mmdb",
+		"MaxMind-DB-test-decoder.mmdb",
+		"GeoIP2-City-Test.mmdb",
+	} {
+		t.Run(fileName, func(t *testing.T) {
+			path := "test-data/test-data/" + fileName
+			expected, err := Open(path)
+			require.Nil(t, err)
+			defer expected.Close()
+
+			buffer, err := ioutil.ReadFile(path)
+			require.Nil(t, err)
+			fromBytesReader, err := FromReaderAt(bytes.NewReader(buffer), int64(len(buffer)))
+			require.Nil(t, err)
+			assert.Equal(t, expected.Metadata, fromBytesReader.Metadata)
+			assert.Equal(t, readerAtRecords(t, expected), readerAtRecords(t, fromBytesReader))
+
+			f, err := os.Open(path)
+			require.Nil(t, err)
+			defer f.Close()
+			info, err := f.Stat()
+			require.Nil(t, err)
+			fromFile, err := FromReaderAt(f, info.Size(), WithDecodeCache(16))
+			require.Nil(t, err)
+			assert.Equal(t, readerAtRecords(t, expected), readerAtRecords(t, fromFile))
+
+			for _, ip := range []string{"1.1.1.1", "1.1.1.33", "81.2.69.160", "::1.1.1.0"} {
+				var expectedRecord, record interface{}
+				expectedNetwork, expectedOK, expectedErr := expected.LookupNetwork(net.ParseIP(ip), &expectedRecord)
+				network, ok, err := fromFile.LookupNetwork(net.ParseIP(ip), &record)
+				assert.Equal(t, expectedErr, err, ip)
+				assert.Equal(t, expectedOK, ok, ip)
+				assert.Equal(t, expectedNetwork, network, ip)
+				assert.Equal(t, expectedRecord, record, ip)
+			}
+
+			assert.Nil(t, fromBytesReader.Close())
+			assert.Nil(t, fromFile.Close())
+			var record interface{}
+			assert.Equal(t, ErrClosed, fromFile.Lookup(net.ParseIP("1.1.1.1"), &record))
+		})
+	}
+}
+
+func TestFromReaderAtLookups(t *testing.T) {
+	f, err := os.Open("test-data/test-data/GeoIP2-City-Test.mmdb")
+	require.Nil(t, err)
+	defer f.Close()
+	info, err := f.Stat()
+	require.Nil(t, err)
+	reader, err := FromReaderAt(f, info.Size())
+	require.Nil(t, err)
+	ip := net.ParseIP("81.2.69.160")
+
+	var isoCode string
+	require.Nil(t, reader.LookupPath(ip, &isoCode, "country", "iso_code"))
+	assert.Equal(t, "GB", isoCode)
+
+	var city struct {
+		City struct {
+			Names map[string]string `maxminddb:"names"`
+		} `maxminddb:"city"`
+	}
+	require.Nil(t, reader.NewLookupDecoder().Lookup(ip, &city))
+	assert.Equal(t, "London", city.City.Names["en"])
+
+	var buf bytes.Buffer
+	require.Nil(t, reader.LookupJSON(ip, &buf))
+	assert.Contains(t, buf.String(), `"iso_code":"GB"`)
+
+	offset, err := reader.LookupOffset(ip)
+	require.Nil(t, err)
+	var record map[string]interface{}
+	require.Nil(t, reader.Decode(offset, &record))
+	assert.Contains(t, record, "city")
+
+	_, err = reader.ValueSize(offset)
+	assert.EqualError(t, err, "maxminddb: ValueSize is not supported for a Reader created by FromReaderAt")
+	assert.EqualError(t, reader.Verify(), "maxminddb: Verify is not supported for a Reader created by FromReaderAt")
+
+	assert.Nil(t, reader.Close())
+}
+
+// failingReaderAt returns err for reads at or past failAt.
+type failingReaderAt struct {
+	r      io.ReaderAt
+	failAt int64
+	err    error
+}
+
+func (f failingReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	if off+int64(len(p)) > f.failAt {
+		return 0, f.err
+	}
+	return f.r.ReadAt(p, off)
+}
+
+func TestFromReaderAtErrors(t *testing.T) {
+	_, err := FromReaderAt(bytes.NewReader(nil), -1)
+	assert.EqualError(t, err, "size passed to FromReaderAt must not be negative")
+
+	_, err = FromReaderAt(bytes.NewReader([]byte("not a database")), 14)
+	assert.IsType(t, InvalidDatabaseError{}, err)
+
+	buffer, err := ioutil.ReadFile("test-data/test-data/MaxMind-DB-test-ipv4-24.mmdb")
+	require.Nil(t, err)
+
+	// A size larger than the file makes the metadata read fail.
+	_, err = FromReaderAt(bytes.NewReader(buffer), int64(len(buffer))+1)
+	assert.Equal(t, io.ErrUnexpectedEOF, err)
+
+	// Errors reading nodes and records are returned by the lookups.
+	reader, err := FromReaderAt(bytes.NewReader(buffer), int64(len(buffer)))
+	require.Nil(t, err)
+	readErr := errors.New("read failed")
+	reader.source.readerAt = failingReaderAt{bytes.NewReader(buffer), 0, readErr}
+	var record interface{}
+	assert.Equal(t, readErr, reader.Lookup(net.ParseIP("1.1.1.1"), &record))
+
+	dataSectionStart := int64(reader.DataSectionStart())
+	reader.source.readerAt = failingReaderAt{bytes.NewReader(buffer), dataSectionStart, readErr}
+	assert.Equal(t, readErr, reader.Lookup(net.ParseIP("1.1.1.1"), &record))
+	contains, err := reader.Contains(net.ParseIP("1.1.1.1"))
+	require.Nil(t, err)
+	assert.True(t, contains)
+}
+
+func TestFromReaderAtUintptr(t *testing.T) {
+	buffer, err := ioutil.ReadFile("test-data/test-data/GeoIP2-City-Test.mmdb")
+	require.Nil(t, err)
+	reader, err := FromReaderAt(bytes.NewReader(buffer), int64(len(buffer)))
+	require.Nil(t, err)
+
+	// An offset into the copy of the record would decode the wrong value.
+	var record struct {
+		City uintptr `maxminddb:"city"`
+	}
+	err = reader.Lookup(net.ParseIP("81.2.69.160"), &record)
+	assert.EqualError(t, err, "maxminddb: decoding into a uintptr is not supported for a Reader created by FromReaderAt")
+}
+
+func TestFromReaderAtContainer(t *testing.T) {
+	// The record is a data cache container wrapping a map whose value is a
+	// pointer to "Foo" at offset 0.
+	data := encodeTestValue("Foo")
+	containerOffset := uint(len(data))
+	data = append(data, 0x05, 0x05, 0xe1, 0x41, 0x61, 0x20, 0x00)
+	db := testDatabase([][2]uint{{17 + containerOffset, 1}}, data, nil)
+
+	reader, err := FromReaderAt(bytes.NewReader(db), int64(len(db)))
+	require.Nil(t, err)
+	var record interface{}
+	require.Nil(t, reader.Lookup(net.ParseIP("1.1.1.1"), &record))
+	assert.Equal(t, map[string]interface{}{"a": "Foo"}, record)
+}
+
+// countingReaderAt counts the reads before end.
+type countingReaderAt struct {
+	r     io.ReaderAt
+	end   int64
+	reads int
+}
+
+func (c *countingReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	if off < c.end {
+		c.reads++
+	}
+	return c.r.ReadAt(p, off)
+}
+
+func TestWithNodeCache(t *testing.T) {
+	buffer, err := ioutil.ReadFile("test-data/test-data/GeoIP2-City-Test.mmdb")
+	require.Nil(t, err)
+	expected, err := FromBytes(buffer)
+	require.Nil(t, err)
+	ips := []net.IP{net.ParseIP("81.2.69.160"), net.ParseIP("2.125.160.216"), net.ParseIP("2001:218::")}
+
+	counter := &countingReaderAt{r: bytes.NewReader(buffer), end: int64(expected.DataSectionStart())}
+	reader, err := FromReaderAt(counter, int64(len(buffer)), WithNodeCache(int(expected.Metadata.NodeCount)))
+	require.Nil(t, err)
+	for _, ip := range ips {
+		var expectedRecord, record interface{}
+		require.Nil(t, expected.Lookup(ip, &expectedRecord))
+		require.Nil(t, reader.Lookup(ip, &record))
+		assert.Equal(t, expectedRecord, record, ip.String())
+	}
+	require.NotZero(t, counter.reads)
+
+	// The nodes visited by the first lookups are not read again.
+	counter.reads = 0
+	for _, ip := range ips {
+		var record interface{}
+		require.Nil(t, reader.Lookup(ip, &record))
+	}
+	assert.Equal(t, 0, counter.reads)
+	assert.Equal(t, readerAtRecords(t, expected), readerAtRecords(t, reader))
+
+	// The least recently used nodes are evicted.
+	reader, err = FromReaderAt(bytes.NewReader(buffer), int64(len(buffer)), WithNodeCache(2))
+	require.Nil(t, err)
+	var record interface{}
+	require.Nil(t, reader.Lookup(ips[0], &record))
+	assert.Equal(t, 2, reader.nodeCache.len())
+
+	reader, err = FromReaderAt(bytes.NewReader(buffer), int64(len(buffer)), WithNodeCache(2), WithNodeCache(0))
+	require.Nil(t, err)
+	assert.Nil(t, reader.nodeCache)
+}
+
+func TestWithWarmCache(t *testing.T) {
+	fileName := "test-data/test-data/GeoIP2-City-Test.mmdb"
+	ip := net.ParseIP("81.2.69.160")
+
+	reader, err := Open(fileName, WithWarmCache())
+	require.Nil(t, err)
+	var isoCode string
+	require.Nil(t, reader.LookupPath(ip, &isoCode, "country", "iso_code"))
+	assert.Equal(t, "GB", isoCode)
+	require.Nil(t, reader.Close())
+
+	buffer, err := ioutil.ReadFile(fileName)
+	require.Nil(t, err)
+	reader, err = FromReaderAt(bytes.NewReader(buffer), int64(len(buffer)), WithWarmCache())
+	require.Nil(t, err)
+	expected, err := FromBytes(buffer)
+	require.Nil(t, err)
+	assert.Equal(t, readerAtRecords(t, expected), readerAtRecords(t, reader))
+
+	// The search tree is in memory, so only reading records fails.
+	readErr := errors.New("read failed")
+	reader.source.readerAt = failingReaderAt{bytes.NewReader(buffer), 0, readErr}
+	contains, err := reader.Contains(ip)
+	require.Nil(t, err)
+	assert.True(t, contains)
+	var record interface{}
+	assert.Equal(t, readErr, reader.Lookup(ip, &record))
+
+	require.Nil(t, reader.Close())
+	assert.Equal(t, ErrClosed, reader.Lookup(ip, &record))
+
+	// An error reading the search tree is returned by FromReaderAt.
+	dataSectionStart := int64(expected.DataSectionStart())
+	_, err = FromReaderAt(
+		failingReaderAt{bytes.NewReader(buffer), dataSectionStart - 1, readErr},
+		int64(len(buffer)),
+		WithWarmCache(),
+	)
+	assert.Equal(t, readErr, err)
+}
+
+// BenchmarkFirstLookup measures the latency of the first lookup of a Reader
+// created by FromReaderAt, with and without WithWarmCache. Creating the
+// Reader is not measured.
+func BenchmarkFirstLookup(b *testing.B) {
+	f, err := os.Open("GeoLite2-City.mmdb")
+	require.Nil(b, err)
+	defer f.Close()
+	info, err := f.Stat()
+	require.Nil(b, err)
+
+	for _, test := range []struct {
+		name    string
+		options []ReaderOption
+	}{
+		{"cold", nil},
+		{"warm", []ReaderOption{WithWarmCache()}},
+	} {
+		b.Run(test.name, func(b *testing.B) {
+			r := rand.New(rand.NewSource(time.Now().UnixNano()))
+			ip := make(net.IP, 4)
+			var isoCode string
+			for i := 0; i < b.N; i++ {
+				b.StopTimer()
+				reader, err := FromReaderAt(f, info.Size(), test.options...)
+				require.Nil(b, err)
+				randomIPv4Address(b, r, ip)
+				b.StartTimer()
+
+				require.Nil(b, reader.LookupPath(ip, &isoCode, "country", "iso_code"))
+			}
+		})
+	}
+}
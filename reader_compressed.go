@@ -0,0 +1,64 @@
+package maxminddb
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+)
+
+var gzipMagic = []byte{0x1f, 0x8b}
+
+// maxDecompressedSize is the largest database OpenCompressed decompresses
+// into memory. It guards against gzip files that expand to more memory than
+// any database needs.
+var maxDecompressedSize int64 = 4 << 30
+
+// OpenCompressed takes a string path to a MaxMind DB file that may be gzip
+// compressed, e.g., GeoLite2-City.mmdb.gz, and returns a Reader structure or
+// an error. A gzip compressed file is detected by its magic bytes rather
+// than its name and is decompressed into memory, so calling Close on the
+// Reader does not release any resources. An error is returned if the
+// decompressed database is larger than 4 GiB. Any other file is opened as
+// with Open.
+func OpenCompressed(file string, options ...ReaderOption) (*Reader, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	br := bufio.NewReader(f)
+	magic, err := br.Peek(len(gzipMagic))
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	if !bytes.Equal(magic, gzipMagic) {
+		// A file too short to be gzip compressed is also opened as is, so
+		// that it is reported as an invalid database.
+		return openFile(f, options)
+	}
+
+	gz, err := gzip.NewReader(br)
+	if err != nil {
+		return nil, err
+	}
+	buffer, err := ioutil.ReadAll(io.LimitReader(gz, maxDecompressedSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(buffer)) > maxDecompressedSize {
+		return nil, fmt.Errorf(
+			"maxminddb: the decompressed database in %s is larger than %d bytes",
+			file,
+			maxDecompressedSize,
+		)
+	}
+	if err := gz.Close(); err != nil {
+		return nil, err
+	}
+	return FromBytes(buffer, options...)
+}
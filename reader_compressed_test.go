@@ -0,0 +1,95 @@
+package maxminddb
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOpenCompressed(t *testing.T) {
+	dir, err := ioutil.TempDir("", "maxminddb")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	buffer, err := ioutil.ReadFile("test-data/test-data/MaxMind-DB-test-ipv4-24.mmdb")
+	require.Nil(t, err)
+	// The name does not matter, only the contents.
+	compressedFile := filepath.Join(dir, "GeoIP.mmdb")
+	f, err := os.Create(compressedFile)
+	require.Nil(t, err)
+	gz := gzip.NewWriter(f)
+	_, err = gz.Write(buffer)
+	require.Nil(t, err)
+	require.Nil(t, gz.Close())
+	require.Nil(t, f.Close())
+
+	for _, file := range []string{
+		compressedFile,
+		"test-data/test-data/MaxMind-DB-test-ipv4-24.mmdb",
+	} {
+		reader, err := OpenCompressed(file, WithStrictDecoding())
+		require.Nil(t, err, "unexpected error while opening %s: %v", file, err)
+		assert.Equal(t, uint(4), reader.Metadata.IPVersion)
+		checkIpv4(t, reader)
+		assert.True(t, reader.decoder.strictDecoding)
+		assert.Nil(t, reader.Close())
+	}
+}
+
+func TestOpenCompressedErrors(t *testing.T) {
+	dir, err := ioutil.TempDir("", "maxminddb")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	_, err = OpenCompressed(filepath.Join(dir, "missing.mmdb.gz"))
+	assert.True(t, os.IsNotExist(err))
+
+	// A file that starts like a gzip file but is not one.
+	corruptFile := filepath.Join(dir, "corrupt.mmdb.gz")
+	require.Nil(t, ioutil.WriteFile(corruptFile, []byte{0x1f, 0x8b, 0x00}, 0644))
+	_, err = OpenCompressed(corruptFile)
+	assert.NotNil(t, err)
+
+	// A file that is neither gzip compressed nor a database.
+	plainFile := filepath.Join(dir, "plain.mmdb")
+	require.Nil(t, ioutil.WriteFile(plainFile, []byte("not a database"), 0644))
+	_, err = OpenCompressed(plainFile)
+	assert.IsType(t, InvalidDatabaseError{}, err)
+}
+
+func TestOpenCompressedTooLarge(t *testing.T) {
+	dir, err := ioutil.TempDir("", "maxminddb")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	buffer, err := ioutil.ReadFile("test-data/test-data/MaxMind-DB-test-ipv4-24.mmdb")
+	require.Nil(t, err)
+	compressedFile := filepath.Join(dir, "GeoIP.mmdb.gz")
+	f, err := os.Create(compressedFile)
+	require.Nil(t, err)
+	gz := gzip.NewWriter(f)
+	_, err = gz.Write(buffer)
+	require.Nil(t, err)
+	require.Nil(t, gz.Close())
+	require.Nil(t, f.Close())
+
+	defer func(size int64) { maxDecompressedSize = size }(maxDecompressedSize)
+	maxDecompressedSize = int64(len(buffer))
+	reader, err := OpenCompressed(compressedFile)
+	require.Nil(t, err)
+	assert.Nil(t, reader.Close())
+
+	maxDecompressedSize = int64(len(buffer) - 1)
+	_, err = OpenCompressed(compressedFile)
+	assert.EqualError(t, err, fmt.Sprintf(
+		"maxminddb: the decompressed database in %s is larger than %d bytes",
+		compressedFile,
+		len(buffer)-1,
+	))
+}
@@ -0,0 +1,18 @@
+//go:build go1.16
+// +build go1.16
+
+package maxminddb
+
+import "io/fs"
+
+// OpenFS reads the MaxMind DB file name from fsys into memory and returns a
+// Reader for it, or an error. This allows databases to be opened from, e.g.,
+// an embed.FS. As the file is not memory mapped, calling Close on the Reader
+// does not release any resources.
+func OpenFS(fsys fs.FS, name string, options ...ReaderOption) (*Reader, error) {
+	buffer, err := fs.ReadFile(fsys, name)
+	if err != nil {
+		return nil, err
+	}
+	return FromBytes(buffer, options...)
+}
@@ -0,0 +1,65 @@
+//go:build go1.16
+// +build go1.16
+
+package maxminddb
+
+import (
+	"embed"
+	"errors"
+	"io/fs"
+	"net"
+	"os"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOpenFS(t *testing.T) {
+	reader, err := OpenFS(os.DirFS("test-data/test-data"), "MaxMind-DB-test-ipv4-24.mmdb")
+	require.Nil(t, err, "unexpected error while opening database: %v", err)
+	assert.Equal(t, uint(4), reader.Metadata.IPVersion)
+	assert.Equal(t, uint(24), reader.Metadata.RecordSize)
+	checkIpv4(t, reader)
+	assert.Nil(t, reader.Close())
+}
+
+//go:embed testdata/embed-test-ipv4-24.mmdb
+var embeddedDatabases embed.FS
+
+func TestOpenFSEmbed(t *testing.T) {
+	reader, err := OpenFS(embeddedDatabases, "testdata/embed-test-ipv4-24.mmdb")
+	require.Nil(t, err, "unexpected error while opening database: %v", err)
+	assert.Equal(t, "Embed-Test", reader.Metadata.DatabaseType)
+
+	var record struct {
+		Name string `maxminddb:"name"`
+	}
+	require.Nil(t, reader.Lookup(net.ParseIP("1.2.3.4"), &record))
+	assert.Equal(t, "embedded", record.Name)
+	assert.Nil(t, reader.Close())
+}
+
+func TestOpenFSMapFS(t *testing.T) {
+	buffer, err := os.ReadFile("test-data/test-data/MaxMind-DB-test-ipv6-24.mmdb")
+	require.Nil(t, err)
+	fsys := fstest.MapFS{
+		"dbs/GeoIP.mmdb": &fstest.MapFile{Data: buffer},
+		"dbs/empty.mmdb": &fstest.MapFile{},
+	}
+
+	reader, err := OpenFS(fsys, "dbs/GeoIP.mmdb", WithNotFoundError())
+	require.Nil(t, err)
+	var record map[string]string
+	require.Nil(t, reader.Lookup(net.ParseIP("::1:ffff:ffff"), &record))
+	assert.Equal(t, map[string]string{"ip": "::1:ffff:ffff"}, record)
+	assert.Equal(t, ErrNotFound, reader.Lookup(net.ParseIP("89fa::"), &record))
+	assert.Nil(t, reader.Close())
+
+	_, err = OpenFS(fsys, "dbs/missing.mmdb")
+	assert.True(t, errors.Is(err, fs.ErrNotExist))
+
+	_, err = OpenFS(fsys, "dbs/empty.mmdb")
+	assert.IsType(t, InvalidDatabaseError{}, err)
+}
@@ -0,0 +1,48 @@
+//go:build go1.18
+// +build go1.18
+
+package maxminddb
+
+import (
+	"errors"
+	"fmt"
+	"net/netip"
+)
+
+// LookupNetip retrieves the database record for ip and stores it in the value
+// pointed to by result. It behaves like Lookup but takes a netip.Addr, which
+// avoids allocating a net.IP. IPv4-mapped IPv6 addresses are looked up as
+// IPv4 addresses, as with Lookup.
+func (r *Reader) LookupNetip(ip netip.Addr, result interface{}) error {
+	if r.buffer == nil {
+		return ErrClosed
+	}
+	pointer, err := r.lookupNetipPointer(ip)
+	if err != nil {
+		return err
+	}
+	if pointer == 0 {
+		return r.errNotFound()
+	}
+	return r.retrieveData(pointer, result)
+}
+
+func (r *Reader) lookupNetipPointer(ip netip.Addr) (uint, error) {
+	if !ip.IsValid() {
+		return 0, errors.New("ip passed to LookupNetip cannot be the zero netip.Addr")
+	}
+
+	var pointer uint
+	var err error
+	if ip.Is4() || ip.Is4In6() {
+		ipBytes := ip.As4()
+		pointer, _, err = r.findAddressInTree(ipBytes[:])
+	} else {
+		if r.Metadata.IPVersion == IPv4 {
+			return 0, fmt.Errorf("error looking up '%s': you attempted to look up an IPv6 address in an IPv4-only database", ip.String())
+		}
+		ipBytes := ip.As16()
+		pointer, _, err = r.findAddressInTree(ipBytes[:])
+	}
+	return pointer, err
+}
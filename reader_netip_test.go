@@ -0,0 +1,90 @@
+//go:build go1.18
+// +build go1.18
+
+package maxminddb
+
+import (
+	"fmt"
+	"net"
+	"net/netip"
+	"reflect"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLookupNetip(t *testing.T) {
+	for _, recordSize := range []uint{24, 28, 32} {
+		for _, database := range []string{"ipv4", "ipv6", "mixed"} {
+			fileName := fmt.Sprintf("test-data/test-data/MaxMind-DB-test-%s-%d.mmdb", database, recordSize)
+			reader, err := Open(fileName)
+			require.Nil(t, err, "unexpected error while opening database: %v", err)
+
+			addresses := []string{
+				"1.1.1.1", "1.1.1.3", "1.1.1.33", "::ffff:1.1.1.16",
+			}
+			if database != "ipv4" {
+				addresses = append(addresses, "::1:ffff:ffff", "::2:0:59", "89fa::")
+			}
+			for _, address := range addresses {
+				var expected, actual map[string]string
+				require.Nil(t, reader.Lookup(net.ParseIP(address), &expected))
+				require.Nil(t, reader.LookupNetip(netip.MustParseAddr(address), &actual))
+				assert.Equal(t, expected, actual, "lookup of %s", address)
+			}
+
+			assert.Nil(t, reader.Close())
+		}
+	}
+}
+
+func TestLookupNetipErrors(t *testing.T) {
+	reader, err := Open("test-data/test-data/MaxMind-DB-test-ipv4-24.mmdb")
+	require.Nil(t, err, "unexpected error while opening database: %v", err)
+
+	var result interface{}
+	err = reader.LookupNetip(netip.Addr{}, &result)
+	assert.EqualError(t, err, "ip passed to LookupNetip cannot be the zero netip.Addr")
+
+	err = reader.LookupNetip(netip.MustParseAddr("2001::"), &result)
+	assert.EqualError(t, err, "error looking up '2001::': you attempted to look up an IPv6 address in an IPv4-only database")
+
+	assert.Nil(t, reader.Close())
+	err = reader.LookupNetip(netip.MustParseAddr("1.1.1.1"), &result)
+	assert.Equal(t, ErrClosed, err)
+}
+
+func TestLookupNetipNotFoundError(t *testing.T) {
+	reader, err := Open("test-data/test-data/MaxMind-DB-test-ipv4-24.mmdb", WithNotFoundError())
+	require.Nil(t, err, "unexpected error while opening database: %v", err)
+
+	var result interface{}
+	err = reader.LookupNetip(netip.MustParseAddr("1.1.1.33"), &result)
+	assert.Equal(t, ErrNotFound, err)
+	assert.Nil(t, result)
+
+	assert.Nil(t, reader.Close())
+}
+
+func TestDecodeIPIntoNetipAddr(t *testing.T) {
+	// {"gateway": 2001:db8::1 as 16 bytes, "v4": 1.2.3.4 as 4 bytes}
+	input := []byte{0xe2, 0x47}
+	input = append(input, "gateway"...)
+	input = append(input, 0x90)
+	input = append(input, net.ParseIP("2001:db8::1")...)
+	input = append(input, 0x42)
+	input = append(input, "v4"...)
+	input = append(input, 0x84, 1, 2, 3, 4)
+	d := decoder{buffer: input}
+
+	var result struct {
+		Gateway netip.Addr  `maxminddb:"gateway,ip"`
+		V4      *netip.Addr `maxminddb:"v4,ip"`
+	}
+	_, err := d.decode(0, reflect.ValueOf(&result), 0)
+	require.Nil(t, err)
+	assert.Equal(t, netip.MustParseAddr("2001:db8::1"), result.Gateway)
+	require.NotNil(t, result.V4)
+	assert.Equal(t, netip.MustParseAddr("1.2.3.4"), *result.V4)
+}
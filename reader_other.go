@@ -1,4 +1,5 @@
-// +build !appengine
+//go:build !appengine && !plan9 && !js && !wasip1
+// +build !appengine,!plan9,!js,!wasip1
 
 package maxminddb
 
@@ -9,10 +10,10 @@ import (
 
 // Open takes a string path to a MaxMind DB file and returns a Reader
 // structure or an error. The database file is opened using a memory map,
-// except on Google App Engine where mmap is not supported; there the database
-// is loaded into memory. Use the Close method on the Reader object to return
-// the resources to the system.
-func Open(file string) (*Reader, error) {
+// except on Google App Engine and on platforms without mmap support; there the
+// database is loaded into memory. Use the Close method on the Reader object to
+// return the resources to the system.
+func Open(file string, options ...ReaderOption) (*Reader, error) {
 	mapFile, err := os.Open(file)
 	if err != nil {
 		return nil, err
@@ -23,6 +24,12 @@ func Open(file string) (*Reader, error) {
 		}
 	}()
 
+	return openFile(mapFile, options)
+}
+
+// openFile memory maps the database in mapFile. The caller closes mapFile,
+// which the mapping does not need.
+func openFile(mapFile *os.File, options []ReaderOption) (*Reader, error) {
 	stats, err := mapFile.Stat()
 	if err != nil {
 		return nil, err
@@ -34,7 +41,7 @@ func Open(file string) (*Reader, error) {
 		return nil, err
 	}
 
-	reader, err := FromBytes(mmap)
+	reader, err := FromBytes(mmap, options...)
 	if err != nil {
 		if err2 := munmap(mmap); err2 != nil {
 			// failing to unmap the file is probably the more severe error
@@ -50,7 +57,20 @@ func Open(file string) (*Reader, error) {
 
 // Close unmaps the database file from virtual memory and returns the
 // resources to the system. If called on a Reader opened using FromBytes
-// or Open on Google App Engine, this method does nothing.
+// or Open on a platform without mmap support, this method does nothing
+// beyond marking the Reader as closed. Once Close has returned, the methods of
+// the Reader and of the iterators created from it return ErrClosed. Calling
+// Close more than once is safe, but, as for any Reader, Close must not be
+// called while the Reader or its iterators are in use by other goroutines:
+// the check for a closed Reader is not synchronized with Close, so it does
+// not keep concurrent lookups from reading the unmapped memory.
+//
+// Values decoded from the database do not refer to its memory: strings and
+// byte slices are copied out of it, so they remain valid after Close and may
+// be shared between goroutines. The exception is a LazyArray, which decodes
+// its elements from the database when they are requested. With
+// WithDecodeCache, the maps, slices, and pointers of a result are also those
+// of the cached record, so results must be treated as read-only.
 func (r *Reader) Close() error {
 	var err error
 	if r.hasMappedFile {
@@ -59,5 +79,6 @@ func (r *Reader) Close() error {
 		err = munmap(r.buffer)
 	}
 	r.buffer = nil
+	r.decoder.buffer = nil
 	return err
 }
@@ -1,12 +1,18 @@
 package maxminddb
 
 import (
+	"bytes"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"io/ioutil"
 	"math/big"
 	"math/rand"
 	"net"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
 	"testing"
 	"time"
 
@@ -50,6 +56,62 @@ func TestReaderBytes(t *testing.T) {
 	}
 }
 
+func TestMetadataBuildTimeAndDescription(t *testing.T) {
+	db := testDatabase([][2]uint{{1, 1}}, nil, map[string]interface{}{
+		"description": map[string]interface{}{
+			"en": "Test Database",
+			"zh": "小型数据库",
+		},
+	})
+	reader, err := FromBytes(db)
+	require.Nil(t, err)
+
+	metadata := reader.Metadata
+	assert.Equal(t, time.Date(2017, time.July, 14, 2, 40, 0, 0, time.UTC), metadata.BuildTime())
+	assert.Equal(t, "Test Database", metadata.DescriptionIn("en"))
+	assert.Equal(t, "小型数据库", metadata.DescriptionIn("zh"))
+	assert.Equal(t, "", metadata.DescriptionIn("de"))
+}
+
+func TestMetadataNodeByteSizeAndLanguages(t *testing.T) {
+	for _, recordSize := range []uint{24, 28, 32} {
+		fileName := fmt.Sprintf("test-data/test-data/MaxMind-DB-test-ipv4-%d.mmdb", recordSize)
+		reader, err := Open(fileName)
+		require.Nil(t, err, "unexpected error while opening database: %v", err)
+
+		metadata := reader.Metadata
+		assert.Equal(t, int(recordSize)/4, metadata.NodeByteSize())
+
+		languages := metadata.LanguagesCopy()
+		assert.Equal(t, []string{"en", "zh"}, languages)
+		languages[0] = "de"
+		assert.Equal(t, []string{"en", "zh"}, reader.Metadata.Languages)
+
+		assert.Nil(t, reader.Close())
+	}
+	assert.Equal(t, 6, Metadata{RecordSize: 24}.NodeByteSize())
+	assert.Equal(t, 7, Metadata{RecordSize: 28}.NodeByteSize())
+	assert.Equal(t, 8, Metadata{RecordSize: 32}.NodeByteSize())
+	assert.Nil(t, Metadata{}.LanguagesCopy())
+}
+
+func TestFromBytesDoesNotModifyBuffer(t *testing.T) {
+	buffer, err := ioutil.ReadFile("test-data/test-data/MaxMind-DB-test-decoder.mmdb")
+	require.Nil(t, err)
+	original := make([]byte, len(buffer))
+	copy(original, buffer)
+
+	reader, err := FromBytes(buffer)
+	require.Nil(t, err, "unexpected error while opening bytes: %v", err)
+
+	var result interface{}
+	require.Nil(t, reader.Lookup(net.ParseIP("::1.1.1.0"), &result))
+	require.Nil(t, reader.Verify())
+	assert.Nil(t, reader.Close())
+
+	assert.Equal(t, original, buffer)
+}
+
 func TestDecodingToInterface(t *testing.T) {
 	reader, err := Open("test-data/test-data/MaxMind-DB-test-decoder.mmdb")
 	assert.Nil(t, err, "unexpected error while opening database: %v", err)
@@ -59,21 +121,21 @@ func TestDecodingToInterface(t *testing.T) {
 	require.Nil(t, err, "unexpected error while doing lookup: %v", err)
 
 	record := recordInterface.(map[string]interface{})
-	assert.Equal(t, record["array"], []interface{}{uint64(1), uint64(2), uint64(3)})
+	assert.Equal(t, record["array"], []interface{}{uint32(1), uint32(2), uint32(3)})
 	assert.Equal(t, record["boolean"], true)
 	assert.Equal(t, record["bytes"], []byte{0x00, 0x00, 0x00, 0x2a})
 	assert.Equal(t, record["double"], 42.123456)
 	assert.Equal(t, record["float"], float32(1.1))
-	assert.Equal(t, record["int32"], -268435456)
+	assert.Equal(t, record["int32"], int32(-268435456))
 	assert.Equal(t, record["map"],
 		map[string]interface{}{
 			"mapX": map[string]interface{}{
-				"arrayX":       []interface{}{uint64(7), uint64(8), uint64(9)},
+				"arrayX":       []interface{}{uint32(7), uint32(8), uint32(9)},
 				"utf8_stringX": "hello",
 			}})
 
-	assert.Equal(t, record["uint16"], uint64(100))
-	assert.Equal(t, record["uint32"], uint64(268435456))
+	assert.Equal(t, record["uint16"], uint16(100))
+	assert.Equal(t, record["uint32"], uint32(268435456))
 	assert.Equal(t, record["uint64"], uint64(1152921504606846976))
 	assert.Equal(t, record["utf8_string"], "unicode! ☯ - ♫")
 	bigInt := new(big.Int)
@@ -111,7 +173,7 @@ func TestDecoder(t *testing.T) {
 		assert.Equal(t, result.Map,
 			map[string]interface{}{
 				"mapX": map[string]interface{}{
-					"arrayX":       []interface{}{uint64(7), uint64(8), uint64(9)},
+					"arrayX":       []interface{}{uint32(7), uint32(8), uint32(9)},
 					"utf8_stringX": "hello",
 				}})
 
@@ -280,6 +342,106 @@ func TestComplexStructWithNestingAndPointer(t *testing.T) {
 	assert.Nil(t, reader.Close())
 }
 
+func TestDecodeInvalidOffset(t *testing.T) {
+	reader, err := Open("test-data/test-data/MaxMind-DB-test-decoder.mmdb")
+	require.Nil(t, err, "unexpected error while opening database: %v", err)
+
+	var result interface{}
+	err = reader.Decode(NotFound, &result)
+	assert.EqualError(t, err, fmt.Sprintf("offset %d passed to Decode is outside of the data section", NotFound))
+
+	dataSectionSize := uintptr(len(reader.decoder.buffer))
+	err = reader.Decode(dataSectionSize, &result)
+	assert.EqualError(t, err, fmt.Sprintf("offset %d passed to Decode is outside of the data section", dataSectionSize))
+	assert.Nil(t, result)
+
+	assert.Nil(t, reader.Close())
+}
+
+func TestDataSectionStart(t *testing.T) {
+	// The left record points to "b", which follows "a" in the data section;
+	// "a" occupies two bytes.
+	const offset = 2
+	nodes := [][2]uint{{1 + DataSectionSeparatorSize + offset, 1}}
+	data := append(encodeTestValue("a"), encodeTestValue("b")...)
+	db := testDatabase(nodes, data, nil)
+	reader, err := FromBytes(db)
+	require.Nil(t, err)
+
+	assert.Equal(t, uintptr(6+DataSectionSeparatorSize), reader.DataSectionStart())
+
+	found, err := reader.LookupOffset(net.ParseIP("1.1.1.1"))
+	require.Nil(t, err)
+	assert.Equal(t, uintptr(offset), found)
+
+	var result string
+	require.Nil(t, reader.Decode(found, &result))
+	assert.Equal(t, "b", result)
+
+	start := reader.DataSectionStart() + found
+	assert.Equal(t, encodeTestValue("b"), db[start:start+2])
+}
+
+func TestValueSize(t *testing.T) {
+	values := []string{
+		// Pointers of each size, which are not followed.
+		"2000",
+		"280000",
+		"30000000",
+		"3800000000",
+		// A string, one needing an extra size byte, and bytes.
+		"43666f6f",
+		"5d00" + strings.Repeat("78", 29),
+		"82ffff",
+		// Numbers.
+		"68" + "3ff8000000000000",
+		"0408" + "3f800000",
+		"a201f4",
+		"c3ffffff",
+		"0401ffffffff",
+		"0002",
+		"0203ffff",
+		"1003" + strings.Repeat("ff", 16),
+		// Booleans have no bytes beyond the control bytes.
+		"0107",
+		// A map with a nested array and pointer, and an array with a map.
+		"e2" + "4161" + "0204" + "4162" + "2000" + "4162" + "e0",
+		"0204" + "e14161a101" + "4178",
+		// A data cache container whose contents are counted in bytes.
+		"0805" + "e142656e43466f6f",
+	}
+	var data []byte
+	for _, value := range values {
+		b, err := hex.DecodeString(value)
+		require.Nil(t, err)
+		data = append(data, b...)
+	}
+	reader, err := FromBytes(testDatabase([][2]uint{{17, 17}}, data, nil))
+	require.Nil(t, err)
+
+	offset := uintptr(0)
+	for _, value := range values {
+		size, err := reader.ValueSize(offset)
+		require.Nil(t, err, value)
+		assert.Equal(t, uintptr(len(value)/2), size, value)
+		offset += size
+	}
+
+	_, err = reader.ValueSize(uintptr(len(data) + 100))
+	assert.EqualError(t, err, fmt.Sprintf("offset %d passed to ValueSize is outside of the data section", len(data)+100))
+
+	// A string running past the end of the buffer.
+	reader, err = FromBytes(testDatabase([][2]uint{{17, 17}}, nil, nil))
+	require.Nil(t, err)
+	reader.decoder.buffer = []byte{0x44, 0x61}
+	_, err = reader.ValueSize(0)
+	assert.Equal(t, newOffsetError(5, 2), err)
+
+	assert.Nil(t, reader.Close())
+	_, err = reader.ValueSize(0)
+	assert.Equal(t, ErrClosed, err)
+}
+
 func TestNestedOffsetDecode(t *testing.T) {
 	db, err := Open("test-data/test-data/GeoIP2-City-Test.mmdb")
 	require.Nil(t, err)
@@ -319,6 +481,896 @@ func TestNestedOffsetDecode(t *testing.T) {
 	assert.Nil(t, db.Close())
 }
 
+type lookupNetworkTest struct {
+	IP             net.IP
+	DBFile         string
+	ExpectedCIDR   string
+	ExpectedRecord interface{}
+	ExpectedOK     bool
+}
+
+var lookupNetworkTests = []lookupNetworkTest{
+	{
+		IP:           net.ParseIP("1.1.1.1"),
+		DBFile:       "MaxMind-DB-test-ipv4-24.mmdb",
+		ExpectedCIDR: "1.1.1.1/32",
+		ExpectedRecord: map[string]interface{}{
+			"ip": "1.1.1.1",
+		},
+		ExpectedOK: true,
+	},
+	{
+		IP:           net.ParseIP("1.1.1.3"),
+		DBFile:       "MaxMind-DB-test-ipv4-28.mmdb",
+		ExpectedCIDR: "1.1.1.2/31",
+		ExpectedRecord: map[string]interface{}{
+			"ip": "1.1.1.2",
+		},
+		ExpectedOK: true,
+	},
+	{
+		IP:           net.ParseIP("1.1.1.15"),
+		DBFile:       "MaxMind-DB-test-mixed-32.mmdb",
+		ExpectedCIDR: "1.1.1.8/29",
+		ExpectedRecord: map[string]interface{}{
+			"ip": "::1.1.1.8",
+		},
+		ExpectedOK: true,
+	},
+	{
+		IP:           net.ParseIP("::2:0:41"),
+		DBFile:       "MaxMind-DB-test-ipv6-24.mmdb",
+		ExpectedCIDR: "::2:0:40/124",
+		ExpectedRecord: map[string]interface{}{
+			"ip": "::2:0:40",
+		},
+		ExpectedOK: true,
+	},
+	{
+		IP:           net.ParseIP("1.1.1.33"),
+		DBFile:       "MaxMind-DB-test-ipv4-24.mmdb",
+		ExpectedCIDR: "1.1.1.33/32",
+		ExpectedOK:   false,
+	},
+}
+
+func TestLookupNetwork(t *testing.T) {
+	for _, test := range lookupNetworkTests {
+		t.Run(fmt.Sprintf("%s - %s", test.DBFile, test.IP), func(t *testing.T) {
+			var record interface{}
+			reader, err := Open("test-data/test-data/" + test.DBFile)
+			require.Nil(t, err)
+
+			network, ok, err := reader.LookupNetwork(test.IP, &record)
+			require.Nil(t, err)
+			assert.Equal(t, test.ExpectedOK, ok)
+			assert.Equal(t, test.ExpectedCIDR, network.String())
+			if test.ExpectedOK {
+				assert.Equal(t, test.ExpectedRecord, record)
+			} else {
+				assert.Nil(t, record)
+			}
+
+			assert.Nil(t, reader.Close())
+		})
+	}
+}
+
+func TestLookupPath(t *testing.T) {
+	reader, err := Open("test-data/test-data/MaxMind-DB-test-decoder.mmdb")
+	require.Nil(t, err, "unexpected error while opening database: %v", err)
+	ip := net.ParseIP("::1.1.1.0")
+
+	var u uint
+	require.Nil(t, reader.LookupPath(ip, &u, "map", "mapX", "arrayX", 1))
+	assert.Equal(t, uint(8), u)
+
+	var s string
+	require.Nil(t, reader.LookupPath(ip, &s, "utf8_string"))
+	assert.Equal(t, "unicode! ☯ - ♫", s)
+
+	var m map[string]interface{}
+	require.Nil(t, reader.LookupPath(ip, &m, "map", "mapX"))
+	assert.Equal(t, "hello", m["utf8_stringX"])
+
+	var missing string
+	require.Nil(t, reader.LookupPath(ip, &missing, "map", "does-not-exist"))
+	assert.Equal(t, "", missing)
+	require.Nil(t, reader.LookupPath(ip, &missing, "array", 3))
+	assert.Equal(t, "", missing)
+
+	err = reader.LookupPath(ip, &missing, "utf8_string", 0)
+	assert.EqualError(t, err, "maxminddb: cannot look up index 0 at path element 1: value is of type utf8_string, not array")
+
+	err = reader.LookupPath(ip, &missing, "array", "key")
+	assert.EqualError(t, err, `maxminddb: cannot look up key "key" at path element 1: value is of type array, not map`)
+
+	err = reader.LookupPath(ip, &missing, 1.5)
+	assert.EqualError(t, err, "maxminddb: invalid path element 0 (1.5): must be a string or an int, not float64")
+
+	assert.Nil(t, reader.Close())
+}
+
+func TestLookupPathWithPointers(t *testing.T) {
+	reader, err := Open("test-data/test-data/GeoIP2-City-Test.mmdb")
+	require.Nil(t, err, "unexpected error while opening database: %v", err)
+	ip := net.ParseIP("81.2.69.142")
+
+	var isoCode string
+	require.Nil(t, reader.LookupPath(ip, &isoCode, "country", "iso_code"))
+	assert.Equal(t, "GB", isoCode)
+
+	require.Nil(t, reader.LookupPath(ip, &isoCode, "subdivisions", 0, "iso_code"))
+	assert.Equal(t, "ENG", isoCode)
+
+	assert.Nil(t, reader.Close())
+}
+
+func TestLookupName(t *testing.T) {
+	data := encodeTestValue(map[string]interface{}{
+		"city": map[string]interface{}{
+			"names": map[string]interface{}{"de": "München", "en": "Munich"},
+		},
+		"country": map[string]interface{}{
+			"names": map[string]interface{}{"de": "Deutschland"},
+		},
+		"postal": map[string]interface{}{"code": "80331"},
+	})
+	db := testDatabase([][2]uint{{17, 1}}, data, map[string]interface{}{
+		"languages": []interface{}{"en", "de"},
+	})
+	reader, err := FromBytes(db)
+	require.Nil(t, err)
+	ip := net.ParseIP("1.1.1.1")
+
+	tests := []struct {
+		Field    string
+		Langs    []string
+		Expected string
+	}{
+		{"city", []string{"en"}, "Munich"},
+		{"city", []string{"de", "en"}, "München"},
+		{"city", []string{"fr", "de"}, "München"},
+		{"city", nil, "Munich"},
+		{"country", nil, "Deutschland"},
+		{"country", []string{"fr"}, ""},
+		{"postal", nil, ""},
+		{"continent", nil, ""},
+	}
+	for _, test := range tests {
+		name, err := reader.LookupName(ip, test.Field, test.Langs...)
+		require.Nil(t, err)
+		assert.Equal(t, test.Expected, name, "%s %v", test.Field, test.Langs)
+	}
+
+	name, err := reader.LookupName(net.ParseIP("200.1.1.1"), "city", "en")
+	require.Nil(t, err)
+	assert.Equal(t, "", name)
+
+	assert.Nil(t, reader.Close())
+	_, err = reader.LookupName(ip, "city")
+	assert.Equal(t, ErrClosed, err)
+
+	// Only a missing record is an error with WithNotFoundError.
+	reader, err = FromBytes(db, WithNotFoundError())
+	require.Nil(t, err)
+	name, err = reader.LookupName(net.ParseIP("200.1.1.1"), "city", "en")
+	assert.Equal(t, ErrNotFound, err)
+	assert.Equal(t, "", name)
+	name, err = reader.LookupName(ip, "continent")
+	require.Nil(t, err)
+	assert.Equal(t, "", name)
+	name, err = reader.LookupName(ip, "city")
+	require.Nil(t, err)
+	assert.Equal(t, "Munich", name)
+}
+
+func TestLookupPathThroughSharedArray(t *testing.T) {
+	// The record's subdivisions value is a pointer to an array whose only
+	// element is itself a pointer to a map:
+	//
+	//	0:  {"iso_code": "ENG"}
+	//	14: [pointer to 0]
+	//	18: {"subdivisions": pointer to 14}
+	data, _ := hex.DecodeString(
+		"e1" + "48" + hex.EncodeToString([]byte("iso_code")) + "43" + hex.EncodeToString([]byte("ENG")) +
+			"0104" + "2000" +
+			"e1" + "4c" + hex.EncodeToString([]byte("subdivisions")) + "200e",
+	)
+	db := testDatabase([][2]uint{{1 + DataSectionSeparatorSize + 18, 1}}, data, nil)
+	reader, err := FromBytes(db)
+	require.Nil(t, err)
+	ip := net.ParseIP("1.1.1.1")
+
+	var isoCode string
+	require.Nil(t, reader.LookupPath(ip, &isoCode, "subdivisions", 0, "iso_code"))
+	assert.Equal(t, "ENG", isoCode)
+
+	var subdivision map[string]string
+	require.Nil(t, reader.LookupPath(ip, &subdivision, "subdivisions", 0))
+	assert.Equal(t, map[string]string{"iso_code": "ENG"}, subdivision)
+
+	var subdivisions []map[string]string
+	require.Nil(t, reader.LookupPath(ip, &subdivisions, "subdivisions"))
+	assert.Equal(t, []map[string]string{{"iso_code": "ENG"}}, subdivisions)
+}
+
+func TestStrictDecoding(t *testing.T) {
+	data := encodeTestValue(map[string]interface{}{
+		"a": "x",
+		"b": "y",
+		"c": uint(1),
+	})
+	db := testDatabase([][2]uint{{17, 17}}, data, nil)
+
+	type Embedded struct {
+		B string `maxminddb:"b"`
+	}
+	type result struct {
+		Embedded
+		A string `maxminddb:"a"`
+	}
+
+	reader, err := FromBytes(db)
+	require.Nil(t, err)
+	var lenient result
+	require.Nil(t, reader.Lookup(net.ParseIP("1.1.1.1"), &lenient))
+	assert.Equal(t, result{Embedded{"y"}, "x"}, lenient)
+
+	reader, err = FromBytes(db, WithStrictDecoding())
+	require.Nil(t, err)
+	assert.Equal(t, "Test", reader.Metadata.DatabaseType)
+
+	var strict result
+	err = reader.Lookup(net.ParseIP("1.1.1.1"), &strict)
+	assert.Equal(
+		t,
+		UnmappedFieldsError{
+			Keys:   []string{"c"},
+			Offset: 9,
+			Type:   reflect.TypeOf(result{}),
+		},
+		err,
+	)
+	assert.EqualError(t, err, "maxminddb: keys c at offset 9 have no corresponding field in type maxminddb.result")
+
+	type complete struct {
+		result
+		C uint `maxminddb:"c"`
+	}
+	var c complete
+	require.Nil(t, reader.Lookup(net.ParseIP("1.1.1.1"), &c))
+	assert.Equal(t, uint(1), c.C)
+	assert.Equal(t, "y", c.B)
+
+	var m map[string]interface{}
+	require.Nil(t, reader.Lookup(net.ParseIP("1.1.1.1"), &m))
+	assert.Len(t, m, 3)
+}
+
+// citySubset is a struct for part of a record of the City database.
+type citySubset struct {
+	City struct {
+		GeoNameID uint              `maxminddb:"geoname_id"`
+		Names     map[string]string `maxminddb:"names"`
+	} `maxminddb:"city"`
+	Country struct {
+		IsoCode string `maxminddb:"iso_code"`
+	} `maxminddb:"country"`
+	Location struct {
+		Latitude  float64 `maxminddb:"latitude"`
+		Longitude float64 `maxminddb:"longitude"`
+	} `maxminddb:"location"`
+	Subdivisions []struct {
+		IsoCode string `maxminddb:"iso_code"`
+	} `maxminddb:"subdivisions"`
+}
+
+func TestWithFields(t *testing.T) {
+	ip := net.ParseIP("81.2.69.160")
+	reader, err := Open("test-data/test-data/GeoIP2-City-Test.mmdb")
+	require.Nil(t, err)
+	defer reader.Close()
+	var full citySubset
+	require.Nil(t, reader.Lookup(ip, &full))
+	require.NotEmpty(t, full.Subdivisions)
+
+	filtered, err := Open(
+		"test-data/test-data/GeoIP2-City-Test.mmdb",
+		WithFields("city", "country", "location"),
+	)
+	require.Nil(t, err)
+	defer filtered.Close()
+
+	// Only "subdivisions" is left out.
+	var result citySubset
+	require.Nil(t, filtered.Lookup(ip, &result))
+	expected := full
+	expected.Subdivisions = nil
+	assert.Equal(t, expected, result)
+
+	offset, err := filtered.LookupOffset(ip)
+	require.Nil(t, err)
+	result = citySubset{}
+	require.Nil(t, filtered.Decode(offset, &result))
+	assert.Equal(t, expected, result)
+
+	// With WithStrictDecoding, only the selected keys without a field are
+	// reported.
+	db := testDatabase([][2]uint{{17, 17}}, encodeTestValue(map[string]interface{}{
+		"a": "x",
+		"b": "y",
+		"c": uint(1),
+	}), nil)
+	var a struct {
+		A string `maxminddb:"a"`
+	}
+	strict, err := FromBytes(db, WithFields("a"), WithStrictDecoding())
+	require.Nil(t, err)
+	require.Nil(t, strict.Lookup(net.ParseIP("1.1.1.1"), &a))
+	assert.Equal(t, "x", a.A)
+	strict, err = FromBytes(db, WithFields("a", "b"), WithStrictDecoding())
+	require.Nil(t, err)
+	err = strict.Lookup(net.ParseIP("1.1.1.1"), &a)
+	require.IsType(t, UnmappedFieldsError{}, err)
+	assert.Equal(t, []string{"b"}, err.(UnmappedFieldsError).Keys)
+
+	// Other types than structs are decoded in full.
+	var m map[string]interface{}
+	require.Nil(t, filtered.Lookup(ip, &m))
+	assert.Contains(t, m, "subdivisions")
+	var isoCode string
+	require.Nil(t, filtered.LookupPath(ip, &isoCode, "subdivisions", 0, "iso_code"))
+	assert.Equal(t, full.Subdivisions[0].IsoCode, isoCode)
+}
+
+func TestWithMaxPointerDepth(t *testing.T) {
+	// The record is a pointer to a pointer to "x".
+	data, _ := hex.DecodeString("200220044178")
+	db := testDatabase([][2]uint{{17, 17}}, data, nil)
+
+	reader, err := FromBytes(db)
+	require.Nil(t, err)
+	var result string
+	require.Nil(t, reader.Lookup(net.ParseIP("1.1.1.1"), &result))
+	assert.Equal(t, "x", result)
+
+	reader, err = FromBytes(db, WithMaxPointerDepth(1))
+	require.Nil(t, err)
+	expected := newInvalidDatabaseError("exceeded maximum pointer depth of 1 at offset 1; database is likely corrupt")
+	assert.Equal(t, expected, reader.Lookup(net.ParseIP("1.1.1.1"), &result))
+	assert.Equal(t, expected, reader.LookupPath(net.ParseIP("1.1.1.1"), &result))
+
+	// The record is a pointer to itself.
+	db = testDatabase([][2]uint{{17, 17}}, []byte{0x20, 0x00}, nil)
+	reader, err = FromBytes(db)
+	require.Nil(t, err)
+	assert.Equal(
+		t,
+		newInvalidDatabaseError("exceeded maximum pointer depth of 32 at offset 1; database is likely corrupt"),
+		reader.Lookup(net.ParseIP("1.1.1.1"), &result),
+	)
+	assert.NotNil(t, reader.Verify())
+}
+
+func TestNotFoundError(t *testing.T) {
+	fileName := "test-data/test-data/MaxMind-DB-test-ipv4-24.mmdb"
+	missing := net.ParseIP("1.1.1.33")
+
+	reader, err := Open(fileName)
+	require.Nil(t, err)
+	record := map[string]string{"ip": "unchanged"}
+	assert.Nil(t, reader.Lookup(missing, &record))
+	assert.Equal(t, map[string]string{"ip": "unchanged"}, record)
+	assert.Nil(t, reader.Close())
+
+	reader, err = Open(fileName, WithNotFoundError())
+	require.Nil(t, err)
+
+	err = reader.Lookup(missing, &record)
+	assert.Equal(t, ErrNotFound, err)
+	assert.Equal(t, map[string]string{"ip": "unchanged"}, record)
+
+	ip := "unchanged"
+	err = reader.LookupPath(missing, &ip, "ip")
+	assert.Equal(t, ErrNotFound, err)
+	assert.Equal(t, "unchanged", ip)
+
+	require.Nil(t, reader.Lookup(net.ParseIP("1.1.1.1"), &record))
+	assert.Equal(t, map[string]string{"ip": "1.1.1.1"}, record)
+	require.Nil(t, reader.LookupPath(net.ParseIP("1.1.1.1"), &ip, "does-not-exist"))
+
+	_, ok, err := reader.LookupNetwork(missing, &record)
+	assert.Nil(t, err)
+	assert.False(t, ok)
+
+	assert.Nil(t, reader.Close())
+}
+
+func TestWithEmptyNodes(t *testing.T) {
+	// 0.0.0.0/2 has a record, while the records of 64.0.0.0/2 and
+	// 128.0.0.0/1 are the empty record, i.e., the node count.
+	db := testDatabase(
+		[][2]uint{{1, 2}, {2 + DataSectionSeparatorSize, 2}},
+		encodeTestValue(map[string]interface{}{"name": "a"}),
+		nil,
+	)
+	empty := net.ParseIP("128.0.0.1")
+
+	reader, err := FromBytes(db)
+	require.Nil(t, err)
+	_, ok, err := reader.LookupNetwork(empty, new(interface{}))
+	require.Nil(t, err)
+	assert.False(t, ok)
+	count, err := reader.NetworkCount()
+	require.Nil(t, err)
+	assert.Equal(t, 1, count)
+
+	reader, err = FromBytes(db, WithEmptyNodes(), WithNotFoundError())
+	require.Nil(t, err)
+
+	record := map[string]string{"name": "unchanged"}
+	network, ok, err := reader.LookupNetwork(empty, &record)
+	require.Nil(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, "128.0.0.0/1", network.String())
+	assert.Equal(t, map[string]string{"name": "unchanged"}, record)
+
+	require.Nil(t, reader.Lookup(empty, &record))
+	assert.Equal(t, map[string]string{"name": "unchanged"}, record)
+	name := "unchanged"
+	require.Nil(t, reader.LookupPath(empty, &name, "name"))
+	assert.Equal(t, "unchanged", name)
+
+	offset, err := reader.LookupOffset(empty)
+	require.Nil(t, err)
+	assert.Equal(t, NotFound, offset)
+
+	var buf bytes.Buffer
+	require.Nil(t, reader.LookupJSON(empty, &buf))
+	assert.Equal(t, "null", buf.String())
+
+	type entry struct {
+		Network string
+		Offset  uintptr
+		Name    string
+	}
+	var networks []entry
+	n := reader.Networks()
+	for n.Next() {
+		var record struct {
+			Name string `maxminddb:"name"`
+		}
+		ipNet, err := n.Network(&record)
+		require.Nil(t, err)
+		networks = append(networks, entry{ipNet.String(), n.Offset(), record.Name})
+	}
+	require.Nil(t, n.Err())
+	assert.Equal(
+		t,
+		[]entry{
+			{"0.0.0.0/2", 0, "a"},
+			{"64.0.0.0/2", NotFound, ""},
+			{"128.0.0.0/1", NotFound, ""},
+		},
+		networks,
+	)
+}
+
+func TestVerifyWithEmptyNodes(t *testing.T) {
+	for _, fileName := range []string{
+		"MaxMind-DB-test-ipv4-24.mmdb",
+		"MaxMind-DB-test-mixed-24.mmdb",
+		"GeoIP2-City-Test.mmdb",
+	} {
+		reader, err := Open("test-data/test-data/"+fileName, WithEmptyNodes())
+		require.Nil(t, err)
+		assert.Nil(t, reader.Verify(), fileName)
+		assert.Nil(t, reader.SelfConsistencyCheck(), fileName)
+		require.Nil(t, reader.Close())
+	}
+}
+
+func TestWithUTF8Validation(t *testing.T) {
+	// The value of "name" starts at offset 7: the map's control byte, the
+	// key, and the value's control byte come first.
+	db := testDatabase(
+		[][2]uint{{1 + DataSectionSeparatorSize, 1}},
+		encodeTestValue(map[string]interface{}{"name": "a\xffb"}),
+		nil,
+	)
+	ip := net.ParseIP("1.1.1.1")
+
+	reader, err := FromBytes(db)
+	require.Nil(t, err)
+	var record map[string]string
+	require.Nil(t, reader.Lookup(ip, &record))
+	assert.Equal(t, "a\xffb", record["name"])
+
+	reader, err = FromBytes(db, WithUTF8Validation())
+	require.Nil(t, err)
+	expected := newInvalidDatabaseError(
+		"the MaxMind DB file's data section contains bad data (invalid UTF-8 in the string at offset 7)",
+	)
+	assert.Equal(t, expected, reader.Lookup(ip, &record))
+	var name string
+	assert.Equal(t, expected, reader.LookupPath(ip, &name, "name"))
+	assert.Equal(t, expected, reader.LookupJSON(ip, &bytes.Buffer{}))
+
+	// Keys are validated too.
+	db = testDatabase(
+		[][2]uint{{1 + DataSectionSeparatorSize, 1}},
+		encodeTestValue(map[string]interface{}{"\xc3": "a"}),
+		nil,
+	)
+	reader, err = FromBytes(db, WithUTF8Validation())
+	require.Nil(t, err)
+	var generic interface{}
+	assert.Equal(
+		t,
+		newInvalidDatabaseError(
+			"the MaxMind DB file's data section contains bad data (invalid UTF-8 in the string at offset 2)",
+		),
+		reader.Lookup(ip, &generic),
+	)
+}
+
+type testCircle struct {
+	Radius uint `maxminddb:"radius"`
+}
+
+type testSquare struct {
+	Side uint `maxminddb:"side"`
+}
+
+func TestWithTypeResolver(t *testing.T) {
+	// The key a shape is stored under tells its type.
+	db := testDatabase(
+		[][2]uint{{1 + DataSectionSeparatorSize, 1}},
+		encodeTestValue(map[string]interface{}{
+			"name": "shapes",
+			"shapes": map[string]interface{}{
+				"circle": map[string]interface{}{"radius": uint(2)},
+				"square": map[string]interface{}{"side": uint(3)},
+				"other":  map[string]interface{}{"sides": uint(5)},
+			},
+		}),
+		nil,
+	)
+	ip := net.ParseIP("1.1.1.1")
+
+	var keyPaths [][]string
+	resolve := func(keyPath []string) reflect.Type {
+		keyPaths = append(keyPaths, append([]string(nil), keyPath...))
+		if len(keyPath) != 2 || keyPath[0] != "shapes" {
+			return nil
+		}
+		switch keyPath[1] {
+		case "circle":
+			return reflect.TypeOf(testCircle{})
+		case "square":
+			return reflect.TypeOf(&testSquare{})
+		}
+		return nil
+	}
+	reader, err := FromBytes(db, WithTypeResolver(resolve))
+	require.Nil(t, err)
+
+	var record struct {
+		Name   interface{}            `maxminddb:"name"`
+		Shapes map[string]interface{} `maxminddb:"shapes"`
+	}
+	require.Nil(t, reader.Lookup(ip, &record))
+	assert.Equal(t, "shapes", record.Name)
+	assert.Equal(t, map[string]interface{}{
+		"circle": testCircle{Radius: 2},
+		"square": &testSquare{Side: 3},
+		"other":  map[string]interface{}{"sides": uint32(5)},
+	}, record.Shapes)
+	assert.Equal(t, [][]string{
+		{"name"},
+		{"shapes", "circle"},
+		{"shapes", "other"},
+		{"shapes", "other", "sides"},
+		{"shapes", "square"},
+	}, keyPaths)
+
+	// Without a resolver, the shapes are decoded as maps.
+	reader, err = FromBytes(db)
+	require.Nil(t, err)
+	var generic map[string]interface{}
+	require.Nil(t, reader.Lookup(ip, &generic))
+	assert.Equal(t, map[string]interface{}{"radius": uint32(2)}, generic["shapes"].(map[string]interface{})["circle"])
+}
+
+func TestLookupMany(t *testing.T) {
+	reader, err := Open("test-data/test-data/MaxMind-DB-test-ipv4-24.mmdb")
+	require.Nil(t, err)
+
+	type record struct {
+		IP string `maxminddb:"ip"`
+	}
+	ips := []net.IP{
+		net.ParseIP("1.1.1.1"),
+		net.ParseIP("1.1.1.33"),
+		net.ParseIP("1.1.1.3"),
+	}
+
+	results := []record{{"a"}, {"b"}, {"c"}, {"d"}}
+	require.Nil(t, reader.LookupMany(ips, &results))
+	assert.Equal(t, []record{{"1.1.1.1"}, {}, {"1.1.1.2"}}, results)
+
+	var maps []map[string]interface{}
+	require.Nil(t, reader.LookupMany(ips, &maps))
+	assert.Equal(
+		t,
+		[]map[string]interface{}{{"ip": "1.1.1.1"}, nil, {"ip": "1.1.1.2"}},
+		maps,
+	)
+
+	err = reader.LookupMany([]net.IP{ips[0], nil}, &results)
+	assert.Equal(
+		t,
+		LookupManyError{
+			Index: 1,
+			Err:   errors.New("ipAddress passed to Lookup cannot be nil"),
+		},
+		err,
+	)
+	assert.EqualError(t, err, "maxminddb: error looking up <nil> at index 1: ipAddress passed to Lookup cannot be nil")
+
+	var ints []int
+	err = reader.LookupMany(ips, &ints)
+	require.IsType(t, LookupManyError{}, err)
+	assert.Equal(t, 0, err.(LookupManyError).Index)
+	assert.IsType(t, UnmarshalTypeError{}, err.(LookupManyError).Err)
+
+	err = reader.LookupMany(ips, results)
+	assert.EqualError(t, err, "results param must be a pointer to a slice")
+
+	assert.Nil(t, reader.Close())
+	err = reader.LookupMany(ips, &results)
+	assert.Equal(t, ErrClosed, err)
+}
+
+func TestLookupUint32(t *testing.T) {
+	for _, fileName := range []string{
+		"test-data/test-data/MaxMind-DB-test-ipv4-24.mmdb",
+		"test-data/test-data/MaxMind-DB-test-mixed-24.mmdb",
+	} {
+		reader, err := Open(fileName, WithNotFoundError())
+		require.Nil(t, err)
+
+		for _, ip := range []uint32{0x01010101, 0x01010102, 0x01010111, 0x01010120, 0x01010121, 0} {
+			ipBytes := net.IPv4(byte(ip>>24), byte(ip>>16), byte(ip>>8), byte(ip))
+			var expected, result interface{}
+			expectedErr := reader.Lookup(ipBytes, &expected)
+			err := reader.LookupUint32(ip, &result)
+			assert.Equal(t, expectedErr, err, ipBytes.String())
+			assert.Equal(t, expected, result, ipBytes.String())
+		}
+		var result interface{}
+		assert.Equal(t, ErrNotFound, reader.LookupUint32(0x01010121, &result))
+
+		assert.Nil(t, reader.Close())
+		assert.Equal(t, ErrClosed, reader.LookupUint32(0x01010101, &result))
+	}
+}
+
+func TestLookupAll(t *testing.T) {
+	reader, err := Open("test-data/test-data/GeoIP2-City-Test.mmdb")
+	require.Nil(t, err)
+	newRecord := func() interface{} { return new(interface{}) }
+
+	count := 0
+	n := reader.NetworksWithin(
+		&net.IPNet{IP: net.IPv4zero.To4(), Mask: net.CIDRMask(0, 32)},
+		SkipAliasedNetworks,
+	)
+	for n.Next() {
+		var expected interface{}
+		network, err := n.Network(&expected)
+		require.Nil(t, err)
+		// 0.0.0.0 and 0.0.0.1 are returned as :: and ::1.
+		ip := network.IP[len(network.IP)-net.IPv4len:]
+
+		// The IPv4 subtree, and the IPv4-mapped, Teredo, and 6to4 aliases.
+		records, err := reader.LookupAll(ip, newRecord)
+		require.Nil(t, err)
+		require.Len(t, records, 4, network.String())
+		for _, record := range records {
+			assert.Equal(t, expected, *record.(*interface{}), network.String())
+		}
+
+		teredo := net.IP{0x20, 0x01, 0, 0, ip[0], ip[1], ip[2], ip[3], 15: 1}
+		fromAlias, err := reader.LookupAll(teredo, newRecord)
+		require.Nil(t, err)
+		assert.Equal(t, records, fromAlias, teredo.String())
+		count++
+	}
+	require.Nil(t, n.Err())
+	assert.True(t, count > 0)
+
+	records, err := reader.LookupAll(net.ParseIP("2001:218::"), newRecord)
+	require.Nil(t, err)
+	assert.Len(t, records, 1)
+
+	assert.Nil(t, reader.Close())
+	_, err = reader.LookupAll(net.ParseIP("1.1.1.1"), newRecord)
+	assert.Equal(t, ErrClosed, err)
+}
+
+func TestLookupAllIPv4(t *testing.T) {
+	reader, err := Open(
+		"test-data/test-data/MaxMind-DB-test-ipv4-24.mmdb",
+		WithNotFoundError(),
+	)
+	require.Nil(t, err)
+	newRecord := func() interface{} { return new(map[string]string) }
+
+	records, err := reader.LookupAll(net.ParseIP("1.1.1.1"), newRecord)
+	require.Nil(t, err)
+	assert.Equal(t, []interface{}{&map[string]string{"ip": "1.1.1.1"}}, records)
+
+	_, err = reader.LookupAll(net.ParseIP("1.1.1.33"), newRecord)
+	assert.Equal(t, ErrNotFound, err)
+
+	_, err = reader.LookupAll(net.ParseIP("2002:101:101::"), newRecord)
+	assert.EqualError(t, err, "error looking up '2002:101:101::': you attempted to look up an IPv6 address in an IPv4-only database")
+	assert.Nil(t, reader.Close())
+}
+
+func TestLookupPrefix(t *testing.T) {
+	for _, test := range lookupNetworkTests {
+		t.Run(fmt.Sprintf("%s - %s", test.DBFile, test.IP), func(t *testing.T) {
+			reader, err := Open("test-data/test-data/" + test.DBFile)
+			require.Nil(t, err)
+
+			prefixLen, ok, err := reader.LookupPrefix(test.IP)
+			require.Nil(t, err)
+			assert.Equal(t, test.ExpectedOK, ok)
+
+			network, _, err := reader.LookupNetwork(test.IP, new(interface{}))
+			require.Nil(t, err)
+			ones, _ := network.Mask.Size()
+			assert.Equal(t, ones, prefixLen)
+
+			assert.Nil(t, reader.Close())
+			_, _, err = reader.LookupPrefix(test.IP)
+			assert.Equal(t, ErrClosed, err)
+		})
+	}
+}
+
+func TestLookupPrefixAtRoot(t *testing.T) {
+	// A search tree in which the root's records are the data record and the
+	// empty record.
+	db := testDatabase([][2]uint{{17, 1}}, encodeTestValue("x"), nil)
+	reader, err := FromBytes(db)
+	require.Nil(t, err)
+
+	prefixLen, ok, err := reader.LookupPrefix(net.ParseIP("1.2.3.4"))
+	require.Nil(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, 1, prefixLen)
+
+	prefixLen, ok, err = reader.LookupPrefix(net.ParseIP("200.2.3.4"))
+	require.Nil(t, err)
+	assert.False(t, ok)
+	assert.Equal(t, 1, prefixLen)
+
+	// A database whose root only has empty records terminates right
+	// below it.
+	db = testDatabase([][2]uint{{1, 1}}, nil, nil)
+	reader, err = FromBytes(db)
+	require.Nil(t, err)
+
+	prefixLen, ok, err = reader.LookupPrefix(net.ParseIP("1.2.3.4"))
+	require.Nil(t, err)
+	assert.False(t, ok)
+	assert.Equal(t, 1, prefixLen)
+}
+
+func TestContains(t *testing.T) {
+	for _, fileName := range []string{
+		"test-data/test-data/MaxMind-DB-test-ipv4-24.mmdb",
+		"test-data/test-data/MaxMind-DB-test-mixed-24.mmdb",
+	} {
+		reader, err := Open(fileName)
+		require.Nil(t, err)
+
+		for ip, expected := range map[string]bool{
+			"1.1.1.1":  true,
+			"1.1.1.3":  true,
+			"1.1.1.32": true,
+			"1.1.1.33": false,
+			"0.0.0.1":  false,
+		} {
+			contains, err := reader.Contains(net.ParseIP(ip))
+			require.Nil(t, err)
+			assert.Equal(t, expected, contains, "%s in %s", ip, fileName)
+		}
+
+		_, err = reader.Contains(nil)
+		assert.EqualError(t, err, "ipAddress passed to Lookup cannot be nil")
+
+		assert.Nil(t, reader.Close())
+		_, err = reader.Contains(net.ParseIP("1.1.1.1"))
+		assert.Equal(t, ErrClosed, err)
+	}
+
+	// The empty records surfaced by WithEmptyNodes have no data.
+	db := testDatabase([][2]uint{{1 + DataSectionSeparatorSize, 1}}, encodeTestValue("x"), nil)
+	reader, err := FromBytes(db, WithEmptyNodes())
+	require.Nil(t, err)
+	contains, err := reader.Contains(net.ParseIP("1.2.3.4"))
+	require.Nil(t, err)
+	assert.True(t, contains)
+	contains, err = reader.Contains(net.ParseIP("200.2.3.4"))
+	require.Nil(t, err)
+	assert.False(t, contains)
+}
+
+func TestLookupRange(t *testing.T) {
+	tests := []struct {
+		DBFile     string
+		IP         string
+		Start      string
+		End        string
+		ExpectedOK bool
+	}{
+		{"MaxMind-DB-test-ipv4-24.mmdb", "1.1.1.1", "1.1.1.1", "1.1.1.1", true},
+		{"MaxMind-DB-test-ipv4-24.mmdb", "1.1.1.3", "1.1.1.2", "1.1.1.3", true},
+		{"MaxMind-DB-test-ipv4-24.mmdb", "1.1.1.5", "1.1.1.4", "1.1.1.7", true},
+		{"MaxMind-DB-test-ipv4-24.mmdb", "1.1.1.20", "1.1.1.16", "1.1.1.31", true},
+		{"MaxMind-DB-test-ipv4-24.mmdb", "1.1.1.33", "1.1.1.33", "1.1.1.33", false},
+		{"MaxMind-DB-test-mixed-24.mmdb", "1.1.1.5", "1.1.1.4", "1.1.1.7", true},
+		{"MaxMind-DB-test-mixed-24.mmdb", "::2:0:42", "::2:0:40", "::2:0:4f", true},
+		{"MaxMind-DB-test-ipv6-24.mmdb", "::2:0:52", "::2:0:50", "::2:0:57", true},
+	}
+	for _, test := range tests {
+		t.Run(fmt.Sprintf("%s - %s", test.DBFile, test.IP), func(t *testing.T) {
+			reader, err := Open("test-data/test-data/" + test.DBFile)
+			require.Nil(t, err)
+
+			var result map[string]interface{}
+			start, end, err := reader.LookupRange(net.ParseIP(test.IP), &result)
+			require.Nil(t, err)
+			assert.Equal(t, test.Start, start.String())
+			assert.Equal(t, test.End, end.String())
+			assert.Equal(t, len(start), len(end))
+			if start.To4() != nil {
+				assert.Equal(t, net.IPv4len, len(start))
+			}
+			assert.Equal(t, test.ExpectedOK, result != nil)
+
+			assert.Nil(t, reader.Close())
+			_, _, err = reader.LookupRange(net.ParseIP(test.IP), &result)
+			assert.Equal(t, ErrClosed, err)
+		})
+	}
+}
+
+func TestLookupRangeDefaultRoute(t *testing.T) {
+	// The root of the search tree only has empty records, so 1.2.3.4 is in
+	// an empty /1 network.
+	reader, err := FromBytes(testDatabase([][2]uint{{1, 1}}, nil, nil), WithNotFoundError())
+	require.Nil(t, err)
+
+	var result interface{}
+	start, end, err := reader.LookupRange(net.ParseIP("1.2.3.4"), &result)
+	assert.Equal(t, ErrNotFound, err)
+	assert.Equal(t, net.IP{0, 0, 0, 0}, start)
+	assert.Equal(t, net.IP{127, 255, 255, 255}, end)
+	assert.Nil(t, result)
+
+	_, network, err := net.ParseCIDR("::/0")
+	require.Nil(t, err)
+	start, end = networkRange(network)
+	assert.Equal(t, "::", start.String())
+	assert.Equal(t, "ffff:ffff:ffff:ffff:ffff:ffff:ffff:ffff", end.String())
+}
+
 func TestDecodingUint16IntoInt(t *testing.T) {
 	reader, err := Open("test-data/test-data/MaxMind-DB-test-decoder.mmdb")
 	require.Nil(t, err, "unexpected error while opening database: %v", err)
@@ -347,6 +1399,56 @@ func TestIpv6inIpv4(t *testing.T) {
 	assert.Nil(t, reader.Close(), "error on close")
 }
 
+func TestIPVersion(t *testing.T) {
+	for _, ipVersion := range []int{4, 6} {
+		fileName := fmt.Sprintf("test-data/test-data/MaxMind-DB-test-ipv%d-24.mmdb", ipVersion)
+		reader, err := Open(fileName)
+		require.Nil(t, err, "unexpected error while opening database: %v", err)
+		assert.Equal(t, ipVersion, reader.IPVersion())
+
+		// IPv4 addresses may be looked up in both kinds of databases.
+		var result map[string]string
+		_, ok, err := reader.LookupNetwork(net.ParseIP("1.1.1.1"), &result)
+		require.Nil(t, err)
+		assert.Equal(t, ipVersion == 4, ok)
+
+		_, _, err = reader.LookupNetwork(net.ParseIP("::1:ffff:ffff"), &result)
+		if ipVersion == 4 {
+			assert.EqualError(t, err, "error looking up '::1:ffff:ffff': you attempted to look up an IPv6 address in an IPv4-only database")
+		} else {
+			assert.Nil(t, err)
+		}
+
+		err = reader.Lookup(net.IP{1, 2, 3}, &result)
+		assert.EqualError(t, err, "error looking up [1 2 3]: an IP address must be 4 or 16 bytes, not 3")
+
+		assert.Nil(t, reader.Close())
+	}
+}
+
+func TestDescribe(t *testing.T) {
+	reader, err := Open("test-data/test-data/GeoIP2-City-Test.mmdb")
+	require.Nil(t, err)
+	count, err := reader.NetworkCount(SkipAliasedNetworks)
+	require.Nil(t, err)
+
+	description := reader.Describe()
+	for _, expected := range []string{
+		"Database type: GeoIP2-City\n",
+		"Build time: " + reader.Metadata.BuildTime().Format(time.RFC3339) + "\n",
+		"IP version: 6\n",
+		fmt.Sprintf("Node count: %d\n", reader.Metadata.NodeCount),
+		"Record size: 28 bits\n",
+		"Languages: en, zh\n",
+		fmt.Sprintf("Networks: %d\n", count),
+	} {
+		assert.Contains(t, description, expected)
+	}
+
+	require.Nil(t, reader.Close())
+	assert.Contains(t, reader.Describe(), "Networks: unknown (maxminddb: cannot use a closed database)\n")
+}
+
 func TestBrokenDoubleDatabase(t *testing.T) {
 	reader, err := Open("test-data/test-data/GeoIP2-City-Test-Broken-Double-Format.mmdb")
 	require.Nil(t, err, "unexpected error while opening database: %v", err)
@@ -362,8 +1464,311 @@ func TestBrokenDoubleDatabase(t *testing.T) {
 func TestInvalidNodeCountDatabase(t *testing.T) {
 	_, err := Open("test-data/test-data/GeoIP2-City-Test-Invalid-Node-Count.mmdb")
 
-	expected := newInvalidDatabaseError("the MaxMind DB contains invalid metadata")
-	assert.Equal(t, err, expected)
+	assert.IsType(t, InvalidDatabaseError{}, err)
+	assert.Contains(t, err.Error(), "the MaxMind DB contains invalid metadata: a search tree of")
+}
+
+func TestUnsupportedRecordSize(t *testing.T) {
+	db := testDatabase([][2]uint{{1, 1}}, nil, map[string]interface{}{
+		"record_size": uint(30),
+	})
+	reader, err := FromBytes(db)
+	assert.Nil(t, reader)
+	assert.Equal(
+		t,
+		newInvalidDatabaseError("the MaxMind DB contains invalid metadata: unsupported record size of 30"),
+		err,
+	)
+}
+
+func TestUnsupportedIPVersion(t *testing.T) {
+	for _, ipVersion := range []uint{0, 5, 16} {
+		db := testDatabase([][2]uint{{1, 1}}, nil, map[string]interface{}{
+			"ip_version": ipVersion,
+		})
+		reader, err := FromBytes(db)
+		assert.Nil(t, reader)
+		assert.Equal(
+			t,
+			newInvalidDatabaseError("the MaxMind DB contains invalid metadata: unsupported IP version of %d", ipVersion),
+			err,
+		)
+	}
+
+	for _, ipVersion := range []uint{IPv4, IPv6} {
+		reader, err := FromBytes(testDatabase([][2]uint{{1, 1}}, nil, map[string]interface{}{
+			"ip_version": ipVersion,
+		}))
+		require.Nil(t, err)
+		assert.Equal(t, ipVersion == IPv6, reader.Metadata.IsIPv6())
+	}
+}
+
+func TestSearchTreeLargerThanDatabase(t *testing.T) {
+	// The search tree of one node and the separator take 22 bytes.
+	db := testDatabase([][2]uint{{1, 1}}, nil, map[string]interface{}{
+		"node_count": uint(2),
+	})
+	reader, err := FromBytes(db)
+	assert.Nil(t, reader)
+	assert.Equal(
+		t,
+		newInvalidDatabaseError("the MaxMind DB contains invalid metadata: a search tree of 2 nodes does not fit in the 22 bytes before the metadata"),
+		err,
+	)
+
+	// The size of this search tree overflows a 32-bit uint.
+	db = testDatabase([][2]uint{{1, 1}}, nil, map[string]interface{}{
+		"node_count":  uint(1 << 31),
+		"record_size": uint(32),
+	})
+	reader, err = FromBytes(db)
+	assert.Nil(t, reader)
+	assert.Equal(
+		t,
+		newInvalidDatabaseError("the MaxMind DB contains invalid metadata: a search tree of 2147483648 nodes does not fit in the 22 bytes before the metadata"),
+		err,
+	)
+}
+
+func TestNodeCountZeroOrOne(t *testing.T) {
+	db := testDatabase(nil, nil, nil)
+	reader, err := FromBytes(db)
+	assert.Nil(t, reader)
+	assert.Equal(
+		t,
+		newInvalidDatabaseError("the MaxMind DB contains invalid metadata: the search tree has no nodes"),
+		err,
+	)
+
+	// A single node is enough for a valid database.
+	dataStart := uint(1 + DataSectionSeparatorSize)
+	db = testDatabase([][2]uint{{dataStart, 1}}, encodeTestValue("a"), nil)
+	reader, err = FromBytes(db)
+	require.Nil(t, err)
+	var record string
+	require.Nil(t, reader.Lookup(net.ParseIP("1.1.1.1"), &record))
+	assert.Equal(t, "a", record)
+	offset, err := reader.LookupOffset(net.ParseIP("128.0.0.1"))
+	require.Nil(t, err)
+	assert.Equal(t, NotFound, offset)
+}
+
+func TestNodeCountLargerThanRecord(t *testing.T) {
+	for _, test := range []struct {
+		nodeCount  uint
+		recordSize uint
+	}{
+		{1 << 24, 24},
+		{1 << 28, 28},
+		{^uint(0), 24},
+	} {
+		db := testDatabase([][2]uint{{1, 1}}, nil, map[string]interface{}{
+			"node_count":  test.nodeCount,
+			"record_size": test.recordSize,
+		})
+		reader, err := FromBytes(db)
+		assert.Nil(t, reader)
+		assert.Equal(
+			t,
+			newInvalidDatabaseError(
+				"the MaxMind DB contains invalid metadata: node count of %d does not fit in a %d bit record",
+				test.nodeCount,
+				test.recordSize,
+			),
+			err,
+		)
+	}
+}
+
+func TestUnsupportedBinaryFormatMajorVersion(t *testing.T) {
+	for _, version := range []uint{0, 1, 3} {
+		db := testDatabase([][2]uint{{1, 1}}, nil, map[string]interface{}{
+			"binary_format_major_version": version,
+		})
+		reader, err := FromBytes(db)
+		assert.Nil(t, reader)
+		assert.Equal(
+			t,
+			newInvalidDatabaseError("the MaxMind DB contains invalid metadata: unsupported binary format major version of %d", version),
+			err,
+		)
+	}
+}
+
+func TestEmptyDatabaseType(t *testing.T) {
+	for _, databaseType := range []interface{}{"", nil} {
+		db := testDatabase([][2]uint{{1, 1}}, nil, map[string]interface{}{
+			"database_type": databaseType,
+		})
+		reader, err := FromBytes(db)
+		assert.Nil(t, reader)
+		assert.Equal(
+			t,
+			newInvalidDatabaseError("the MaxMind DB contains invalid metadata: the database type is empty"),
+			err,
+		)
+	}
+}
+
+func TestTruncatedDatabase(t *testing.T) {
+	buffer, err := ioutil.ReadFile("test-data/test-data/GeoIP2-City-Test.mmdb")
+	require.Nil(t, err)
+	metadataStart := bytes.LastIndex(buffer, metadataStartMarker)
+	require.NotEqual(t, -1, metadataStart)
+
+	checkError := func(err error, length int) {
+		if err != nil {
+			assert.IsType(t, InvalidDatabaseError{}, err, "truncated at %d bytes", length)
+		}
+	}
+	for length := 0; length < len(buffer); length++ {
+		truncated := [][]byte{buffer[:length]}
+		// Truncating the data section but keeping the metadata gets past
+		// FromBytes and exercises the decoder.
+		if length < metadataStart {
+			truncated = append(
+				truncated,
+				append(append([]byte{}, buffer[:length]...), buffer[metadataStart:]...),
+			)
+		}
+		for _, db := range truncated {
+			assert.NotPanics(t, func() {
+				reader, err := FromBytes(db)
+				checkError(err, length)
+				if err != nil {
+					return
+				}
+				checkError(reader.Verify(), length)
+				networks := reader.Networks()
+				for networks.Next() {
+					var record interface{}
+					_, err := networks.Network(&record)
+					checkError(err, length)
+				}
+				checkError(networks.Err(), length)
+			}, "truncated at %d bytes", length)
+		}
+	}
+}
+
+func TestReadNode(t *testing.T) {
+	reader, err := Open("test-data/test-data/MaxMind-DB-test-ipv4-24.mmdb")
+	require.Nil(t, err)
+	require.Equal(t, uint(37), reader.Metadata.NodeCount)
+
+	left, err := reader.ReadNode(0, 0)
+	require.Nil(t, err)
+	assert.Equal(t, uint(1), left)
+	right, err := reader.ReadNode(0, 1)
+	require.Nil(t, err)
+	assert.Equal(t, reader.Metadata.NodeCount, right, "nothing in 128.0.0.0/1")
+
+	// Walking the tree by hand along the bits of 1.1.1.1 ends at the same
+	// data as LookupOffset.
+	ip := net.IP{1, 1, 1, 1}
+	node := uint(0)
+	for i := 0; node < reader.Metadata.NodeCount; i++ {
+		bit := int(ip[i>>3]>>uint(7-i%8)) & 1
+		node, err = reader.ReadNode(node, bit)
+		require.Nil(t, err)
+	}
+	offset, err := reader.LookupOffset(ip)
+	require.Nil(t, err)
+	assert.Equal(t, offset, uintptr(node-reader.Metadata.NodeCount-DataSectionSeparatorSize))
+
+	_, err = reader.ReadNode(0, 2)
+	assert.EqualError(t, err, "index passed to ReadNode must be 0 or 1, got 2")
+	_, err = reader.ReadNode(37, 0)
+	assert.EqualError(t, err, "node number 37 passed to ReadNode is not less than the node count of 37")
+
+	require.Nil(t, reader.Close())
+	_, err = reader.ReadNode(0, 0)
+	assert.Equal(t, ErrClosed, err)
+}
+
+func TestReadNodePastSearchTree(t *testing.T) {
+	reader, err := FromBytes(testDatabase([][2]uint{{1, 1}}, nil, nil))
+	require.Nil(t, err)
+
+	_, err = reader.readNode(1, 0)
+	assert.Equal(
+		t,
+		newInvalidDatabaseError(
+			"the MaxMind DB file's search tree is corrupt: node 1 at offset 6 is past the end of the 6 byte search tree",
+		),
+		err,
+	)
+}
+
+func TestDataPointerPastDataSection(t *testing.T) {
+	data := encodeTestValue("a")
+	// The right record points to the first byte after the data section,
+	// i.e., into the metadata section.
+	past := 1 + DataSectionSeparatorSize + uint(len(data))
+	db := testDatabase([][2]uint{{1 + DataSectionSeparatorSize, past}}, data, nil)
+	fromBytes, err := FromBytes(db)
+	require.Nil(t, err)
+	fromReaderAt, err := FromReaderAt(bytes.NewReader(db), int64(len(db)))
+	require.Nil(t, err)
+	for name, reader := range map[string]*Reader{"FromBytes": fromBytes, "FromReaderAt": fromReaderAt} {
+
+		var record string
+		require.Nil(t, reader.Lookup(net.ParseIP("1.1.1.1"), &record), name)
+		assert.Equal(t, "a", record, name)
+		err = reader.Lookup(net.ParseIP("128.1.1.1"), &record)
+		assert.Equal(t, newInvalidDatabaseError("the MaxMind DB file's search tree is corrupt"), err, name)
+		_, err = reader.LookupOffset(net.ParseIP("128.1.1.1"))
+		assert.Equal(t, newInvalidDatabaseError("the MaxMind DB file's search tree is corrupt"), err, name)
+	}
+}
+
+func TestOpenBytes(t *testing.T) {
+	fileName := "test-data/test-data/MaxMind-DB-test-ipv4-24.mmdb"
+	expected, err := ioutil.ReadFile(fileName)
+	require.Nil(t, err)
+
+	reader, buffer, err := OpenBytes(fileName)
+	require.Nil(t, err)
+	assert.Equal(t, expected, buffer)
+	assert.True(t, &buffer[0] == &reader.buffer[0], "the buffer is not shared with the Reader")
+	checkIpv4(t, reader)
+	assert.Nil(t, reader.Close())
+
+	reader, buffer, err = OpenBytes("file-does-not-exist.mmdb")
+	assert.Nil(t, reader)
+	assert.Nil(t, buffer)
+	assert.Regexp(t, "open file-does-not-exist.mmdb.*", err)
+}
+
+func TestBuffer(t *testing.T) {
+	fileName := "test-data/test-data/GeoIP2-City-Test.mmdb"
+	info, err := os.Stat(fileName)
+	require.Nil(t, err)
+
+	reader, err := Open(fileName)
+	require.Nil(t, err)
+	buffer := reader.Buffer()
+	assert.Equal(t, int(info.Size()), len(buffer))
+
+	// The record of an offset starts at DataSectionStart() + offset.
+	offset, err := reader.LookupOffset(net.ParseIP("81.2.69.160"))
+	require.Nil(t, err)
+	d := decoder{buffer: buffer[reader.DataSectionStart():]}
+	var record map[string]interface{}
+	_, err = d.decode(uint(offset), reflect.ValueOf(&record), 0)
+	require.Nil(t, err)
+	assert.Contains(t, record, "city")
+
+	require.Nil(t, reader.Close())
+	assert.Nil(t, reader.Buffer())
+
+	f, err := os.Open(fileName)
+	require.Nil(t, err)
+	defer f.Close()
+	reader, err = FromReaderAt(f, info.Size())
+	require.Nil(t, err)
+	assert.Nil(t, reader.Buffer())
 }
 
 func TestMissingDatabase(t *testing.T) {
@@ -403,13 +1808,95 @@ func TestUsingClosedDatabase(t *testing.T) {
 	var recordInterface interface{}
 
 	err := reader.Lookup(nil, recordInterface)
-	assert.Equal(t, err.Error(), "cannot call Lookup on a closed database")
+	assert.Equal(t, ErrClosed, err)
 
 	_, err = reader.LookupOffset(nil)
-	assert.Equal(t, err.Error(), "cannot call LookupOffset on a closed database")
+	assert.Equal(t, ErrClosed, err)
 
 	err = reader.Decode(0, recordInterface)
-	assert.Equal(t, err.Error(), "cannot call Decode on a closed database")
+	assert.Equal(t, ErrClosed, err)
+
+	networks := reader.Networks()
+	assert.False(t, networks.Next())
+	assert.Equal(t, ErrClosed, networks.Err())
+
+	_, network, _ := net.ParseCIDR("1.1.1.0/24")
+	networks = reader.NetworksWithin(network)
+	assert.False(t, networks.Next())
+	assert.Equal(t, ErrClosed, networks.Err())
+}
+
+func TestCloseTwice(t *testing.T) {
+	reader, err := Open("test-data/test-data/MaxMind-DB-test-decoder.mmdb")
+	require.Nil(t, err)
+	assert.Nil(t, reader.Close())
+	assert.Nil(t, reader.Close())
+	var result interface{}
+	assert.Equal(t, ErrClosed, reader.Lookup(net.ParseIP("::1.1.1.0"), &result))
+
+	buffer, err := ioutil.ReadFile("test-data/test-data/MaxMind-DB-test-decoder.mmdb")
+	require.Nil(t, err)
+	reader, err = FromBytes(buffer)
+	require.Nil(t, err)
+	assert.Nil(t, reader.Close())
+	assert.Nil(t, reader.Close())
+	assert.Equal(t, ErrClosed, reader.Lookup(net.ParseIP("::1.1.1.0"), &result))
+}
+
+func TestIteratingAfterClose(t *testing.T) {
+	reader, err := Open("test-data/test-data/MaxMind-DB-test-ipv4-24.mmdb")
+	require.Nil(t, err)
+
+	n := reader.Networks()
+	require.True(t, n.Next())
+	assert.Nil(t, reader.Close())
+
+	// The data of the current network is no longer mapped.
+	var record interface{}
+	_, err = n.Network(&record)
+	assert.Equal(t, ErrClosed, err)
+	assert.False(t, n.Next())
+	assert.Equal(t, ErrClosed, n.Err())
+}
+
+func TestDecodedValuesOutliveClose(t *testing.T) {
+	fileName := "test-data/test-data/MaxMind-DB-test-decoder.mmdb"
+	ip := net.ParseIP("::1.1.1.0")
+	type record struct {
+		Bytes  []byte                 `maxminddb:"bytes"`
+		String string                 `maxminddb:"utf8_string"`
+		Map    map[string]interface{} `maxminddb:"map"`
+	}
+	buffer, err := ioutil.ReadFile(fileName)
+	require.Nil(t, err)
+	// expected is decoded from a copy of the database that is not closed.
+	expectedReader, err := FromBytes(append([]byte(nil), buffer...))
+	require.Nil(t, err)
+	var expected record
+	require.Nil(t, expectedReader.Lookup(ip, &expected))
+	require.NotEmpty(t, expected.Bytes)
+	require.NotEmpty(t, expected.String)
+	require.NotEmpty(t, expected.Map)
+
+	// Reading values that refer to the file after it has been unmapped
+	// would fault.
+	reader, err := Open(fileName)
+	require.Nil(t, err)
+	var mapped record
+	require.Nil(t, reader.Lookup(ip, &mapped))
+	require.Nil(t, reader.Close())
+	assert.Equal(t, expected, mapped)
+
+	// Values that refer to the buffer would change when it is overwritten.
+	reader, err = FromBytes(buffer)
+	require.Nil(t, err)
+	var fromBytes record
+	require.Nil(t, reader.Lookup(ip, &fromBytes))
+	require.Nil(t, reader.Close())
+	for i := range buffer {
+		buffer[i] = 0
+	}
+	assert.Equal(t, expected, fromBytes)
 }
 
 func checkMetadata(t *testing.T, reader *Reader, ipVersion uint, recordSize uint) {
@@ -419,6 +1906,8 @@ func checkMetadata(t *testing.T, reader *Reader, ipVersion uint, recordSize uint
 
 	assert.Equal(t, metadata.BinaryFormatMinorVersion, uint(0))
 	assert.IsType(t, uint(0), metadata.BuildEpoch)
+	assert.Equal(t, int64(metadata.BuildEpoch), metadata.BuildTime().Unix())
+	assert.Equal(t, time.UTC, metadata.BuildTime().Location())
 	assert.Equal(t, metadata.DatabaseType, "Test")
 
 	assert.Equal(t, metadata.Description,
@@ -426,6 +1915,7 @@ func checkMetadata(t *testing.T, reader *Reader, ipVersion uint, recordSize uint
 			"en": "Test Database",
 			"zh": "Test Database Chinese",
 		})
+	assert.Equal(t, "Test Database Chinese", metadata.DescriptionIn("zh"))
 	assert.Equal(t, metadata.IPVersion, ipVersion)
 	assert.Equal(t, metadata.Languages, []string{"en", "zh"})
 
@@ -519,6 +2009,160 @@ func checkIpv6(t *testing.T, reader *Reader) {
 	}
 }
 
+// testDatabase builds an in-memory MaxMind DB with 24-bit records. Each node
+// holds its left and right record values. Entries in metadata override the
+// default metadata; a nil entry removes the corresponding key.
+func testDatabase(nodes [][2]uint, data []byte, metadata map[string]interface{}) []byte {
+	m := map[string]interface{}{
+		"binary_format_major_version": uint(2),
+		"binary_format_minor_version": uint(0),
+		"build_epoch":                 uint(1500000000),
+		"database_type":               "Test",
+		"description":                 map[string]interface{}{"en": "Test Database"},
+		"ip_version":                  uint(4),
+		"languages":                   []interface{}{"en"},
+		"node_count":                  uint(len(nodes)),
+		"record_size":                 uint(24),
+	}
+	for k, v := range metadata {
+		if v == nil {
+			delete(m, k)
+			continue
+		}
+		m[k] = v
+	}
+
+	var buf bytes.Buffer
+	for _, node := range nodes {
+		for _, record := range node {
+			buf.Write([]byte{byte(record >> 16), byte(record >> 8), byte(record)})
+		}
+	}
+	buf.Write(make([]byte, DataSectionSeparatorSize))
+	buf.Write(data)
+	buf.Write(metadataStartMarker)
+	buf.Write(encodeTestValue(m))
+	return buf.Bytes()
+}
+
+type testTrieNode struct {
+	children [2]*testTrieNode
+	data     [2]bool
+}
+
+// testTree returns the nodes of a search tree in which each of the networks
+// points to the first value in the data section. The networks must all be of
+// the same IP version.
+func testTree(networks ...string) [][2]uint {
+	root := &testTrieNode{}
+	for _, cidr := range networks {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(err)
+		}
+		ones, _ := network.Mask.Size()
+		node := root
+		for i := 0; i < ones; i++ {
+			bit := (network.IP[i>>3] >> uint(7-i%8)) & 1
+			if i == ones-1 {
+				node.data[bit] = true
+				break
+			}
+			if node.children[bit] == nil {
+				node.children[bit] = &testTrieNode{}
+			}
+			node = node.children[bit]
+		}
+	}
+
+	var trieNodes []*testTrieNode
+	index := map[*testTrieNode]uint{}
+	var walk func(*testTrieNode)
+	walk = func(node *testTrieNode) {
+		index[node] = uint(len(trieNodes))
+		trieNodes = append(trieNodes, node)
+		for _, child := range node.children {
+			if child != nil {
+				walk(child)
+			}
+		}
+	}
+	walk(root)
+
+	nodeCount := uint(len(trieNodes))
+	nodes := make([][2]uint, nodeCount)
+	for i, node := range trieNodes {
+		for bit := range node.children {
+			switch {
+			case node.data[bit]:
+				nodes[i][bit] = nodeCount + DataSectionSeparatorSize
+			case node.children[bit] != nil:
+				nodes[i][bit] = index[node.children[bit]]
+			default:
+				nodes[i][bit] = nodeCount
+			}
+		}
+	}
+	return nodes
+}
+
+// encodeTestValue encodes value in the MaxMind DB data section format. Only
+// the types and sizes needed by the tests are supported.
+func encodeTestValue(value interface{}) []byte {
+	switch v := value.(type) {
+	case string:
+		return append(testCtrlBytes(_String, uint(len(v))), v...)
+	case uint:
+		var b []byte
+		for n := v; n > 0; n >>= 8 {
+			b = append([]byte{byte(n)}, b...)
+		}
+		if len(b) > 4 {
+			return append(testCtrlBytes(_Uint64, uint(len(b))), b...)
+		}
+		return append(testCtrlBytes(_Uint32, uint(len(b))), b...)
+	case []interface{}:
+		b := testCtrlBytes(_Slice, uint(len(v)))
+		for _, e := range v {
+			b = append(b, encodeTestValue(e)...)
+		}
+		return b
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		b := testCtrlBytes(_Map, uint(len(v)))
+		for _, k := range keys {
+			b = append(b, encodeTestValue(k)...)
+			b = append(b, encodeTestValue(v[k])...)
+		}
+		return b
+	}
+	panic(fmt.Sprintf("unsupported test value type %T", value))
+}
+
+func testCtrlBytes(typeNum dataType, size uint) []byte {
+	var sizeBytes []byte
+	switch {
+	case size < 29:
+	case size < 285:
+		sizeBytes = []byte{byte(size - 29)}
+		size = 29
+	case size < 65821:
+		sizeBytes = []byte{byte((size - 285) >> 8), byte(size - 285)}
+		size = 30
+	default:
+		panic(fmt.Sprintf("unsupported test value size %v", size))
+	}
+	if typeNum > _Map {
+		return append([]byte{byte(size), byte(typeNum - 7)}, sizeBytes...)
+	}
+	return append([]byte{byte(typeNum)<<5 | byte(size)}, sizeBytes...)
+}
+
 func BenchmarkMaxMindDB(b *testing.B) {
 	db, err := Open("GeoLite2-City.mmdb")
 	assert.Nil(b, err)
@@ -535,6 +2179,24 @@ func BenchmarkMaxMindDB(b *testing.B) {
 	assert.Nil(b, db.Close(), "error on close")
 }
 
+// BenchmarkMaxMindDBNewMap is like BenchmarkMaxMindDB, except that every
+// record is decoded into a new map rather than reusing the previous one.
+func BenchmarkMaxMindDBNewMap(b *testing.B) {
+	db, err := Open("GeoLite2-City.mmdb")
+	assert.Nil(b, err)
+
+	r := rand.New(rand.NewSource(time.Now().UnixNano()))
+
+	ip := make(net.IP, 4, 4)
+	for i := 0; i < b.N; i++ {
+		randomIPv4Address(b, r, ip)
+		var result interface{}
+		err = db.Lookup(ip, &result)
+		assert.Nil(b, err)
+	}
+	assert.Nil(b, db.Close(), "error on close")
+}
+
 func BenchmarkCountryCode(b *testing.B) {
 	db, err := Open("GeoLite2-City.mmdb")
 	assert.Nil(b, err)
@@ -557,6 +2219,107 @@ func BenchmarkCountryCode(b *testing.B) {
 	assert.Nil(b, db.Close(), "error on close")
 }
 
+func BenchmarkLookupUint32(b *testing.B) {
+	db, err := Open("GeoLite2-City.mmdb")
+	require.Nil(b, err)
+
+	r := rand.New(rand.NewSource(0))
+	var result interface{}
+
+	for i := 0; i < b.N; i++ {
+		err = db.LookupUint32(r.Uint32(), &result)
+		assert.Nil(b, err)
+	}
+	assert.Nil(b, db.Close(), "error on close")
+}
+
+// BenchmarkLookupIPv4Allocs checks that the search tree walk of an IPv4
+// lookup does not allocate. Decoding the offset of a value into a uintptr
+// does not allocate either, so the lookup as a whole has zero allocations.
+func BenchmarkLookupIPv4Allocs(b *testing.B) {
+	db, err := Open("test-data/test-data/MaxMind-DB-test-ipv4-24.mmdb")
+	require.Nil(b, err)
+
+	for name, ip := range map[string]net.IP{
+		"4-byte":    net.IPv4(1, 1, 1, 1).To4(),
+		"4-in-16":   net.IPv4(1, 1, 1, 1),
+		"not found": net.IPv4(10, 0, 0, 1).To4(),
+	} {
+		b.Run(name, func(b *testing.B) {
+			var record struct {
+				IP uintptr `maxminddb:"ip"`
+			}
+			allocs := testing.AllocsPerRun(100, func() {
+				_ = db.Lookup(ip, &record)
+			})
+			assert.Zero(b, allocs)
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				err = db.Lookup(ip, &record)
+				if err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+	assert.Nil(b, db.Close(), "error on close")
+}
+
+func BenchmarkWithFields(b *testing.B) {
+	for _, benchmark := range []struct {
+		name    string
+		options []ReaderOption
+	}{
+		{"AllFields", nil},
+		{"CountryOnly", []ReaderOption{WithFields("country")}},
+	} {
+		b.Run(benchmark.name, func(b *testing.B) {
+			db, err := Open("test-data/test-data/GeoIP2-City-Test.mmdb", benchmark.options...)
+			require.Nil(b, err)
+			ip := net.ParseIP("81.2.69.160")
+
+			var result citySubset
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				err = db.Lookup(ip, &result)
+				assert.Nil(b, err)
+			}
+			b.StopTimer()
+			assert.Nil(b, db.Close(), "error on close")
+		})
+	}
+}
+
+func BenchmarkLookupMany(b *testing.B) {
+	db, err := Open("GeoLite2-City.mmdb")
+	require.Nil(b, err)
+
+	type MinCountry struct {
+		Country struct {
+			IsoCode string `maxminddb:"iso_code"`
+		} `maxminddb:"country"`
+	}
+
+	r := rand.New(rand.NewSource(0))
+	ips := make([]net.IP, 1000)
+	for i := range ips {
+		ips[i] = make(net.IP, 4)
+		randomIPv4Address(b, r, ips[i])
+	}
+
+	var results []MinCountry
+	b.ResetTimer()
+	for i := 0; i < b.N; i += len(ips) {
+		err = db.LookupMany(ips, &results)
+		assert.Nil(b, err)
+	}
+	b.StopTimer()
+	assert.Nil(b, db.Close(), "error on close")
+}
+
 func randomIPv4Address(b *testing.B, r *rand.Rand, ip []byte) {
 	num := r.Uint32()
 	ip[0] = byte(num >> 24)
@@ -564,3 +2327,39 @@ func randomIPv4Address(b *testing.B, r *rand.Rand, ip []byte) {
 	ip[2] = byte(num >> 8)
 	ip[3] = byte(num)
 }
+
+func BenchmarkReadNode(b *testing.B) {
+	for _, recordSize := range []int{24, 28, 32} {
+		b.Run(fmt.Sprintf("%d-bit", recordSize), func(b *testing.B) {
+			db, err := Open(fmt.Sprintf("test-data/test-data/MaxMind-DB-test-ipv6-%d.mmdb", recordSize))
+			require.Nil(b, err)
+
+			node := uint(0)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, err = db.readNode(node, uint(i)&1); err != nil {
+					b.Fatal(err)
+				}
+				if node++; node == db.Metadata.NodeCount {
+					node = 0
+				}
+			}
+			b.StopTimer()
+			assert.Nil(b, db.Close(), "error on close")
+		})
+	}
+}
+
+func BenchmarkLookupPrefix(b *testing.B) {
+	db, err := Open("GeoLite2-City.mmdb")
+	require.Nil(b, err)
+
+	r := rand.New(rand.NewSource(0))
+	ip := make(net.IP, 4, 4)
+	for i := 0; i < b.N; i++ {
+		randomIPv4Address(b, r, ip)
+		_, _, err = db.LookupPrefix(ip)
+		assert.Nil(b, err)
+	}
+	assert.Nil(b, db.Close(), "error on close")
+}
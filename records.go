@@ -0,0 +1,88 @@
+package maxminddb
+
+// RecordIterator iterates over the distinct data records of a database. It
+// is created by Records.
+type RecordIterator struct {
+	networks *Networks
+	seen     map[uintptr]struct{}
+	pointer  uint
+	offset   uintptr
+	err      error
+	sizeHint int
+}
+
+// RecordsOption is an option for Records.
+type RecordsOption func(*RecordIterator)
+
+// RecordsSizeHint is an option for Records that sizes the set of offsets
+// already visited for n records up front, avoiding the cost of growing it
+// during the iteration when the number of records is roughly known.
+func RecordsSizeHint(n int) RecordsOption {
+	return func(it *RecordIterator) {
+		it.sizeHint = n
+	}
+}
+
+// Records returns an iterator over the data records of the database. Unlike
+// Networks, which visits every network, it visits each record once, however
+// many networks point to it. The order of the records is that in which
+// Networks first reaches them.
+//
+// To do so, the iterator keeps the offset of every record it has visited.
+// Its memory use is thus proportional to the number of distinct records in
+// the database, some 20 bytes per record.
+func (r *Reader) Records(options ...RecordsOption) *RecordIterator {
+	it := &RecordIterator{networks: r.Networks()}
+	for _, option := range options {
+		option(it)
+	}
+	it.seen = make(map[uintptr]struct{}, it.sizeHint)
+	if r.buffer == nil {
+		it.err = ErrClosed
+	}
+	return it
+}
+
+// Next prepares the next record for reading with the Record method. It
+// returns true if there is another record and false if there are no more
+// records or if there is an error.
+func (it *RecordIterator) Next() bool {
+	if it.err != nil {
+		return false
+	}
+	for it.networks.Next() {
+		pointer := it.networks.lastNode.pointer
+		offset, err := it.networks.reader.resolveDataPointer(pointer)
+		if err != nil {
+			it.err = err
+			return false
+		}
+		if _, ok := it.seen[offset]; ok {
+			continue
+		}
+		it.seen[offset] = struct{}{}
+		it.pointer = pointer
+		it.offset = offset
+		return true
+	}
+	return false
+}
+
+// Record decodes the current record into result, which must be a pointer.
+func (it *RecordIterator) Record(result interface{}) error {
+	return it.networks.reader.retrieveData(it.pointer, result)
+}
+
+// Offset returns the offset of the current record in the data section. It
+// may be passed to Decode.
+func (it *RecordIterator) Offset() uintptr {
+	return it.offset
+}
+
+// Err returns an error, if any, that was encountered during iteration.
+func (it *RecordIterator) Err() error {
+	if it.err != nil {
+		return it.err
+	}
+	return it.networks.Err()
+}
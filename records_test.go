@@ -0,0 +1,70 @@
+package maxminddb
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecords(t *testing.T) {
+	// testTree points every network to the first record. Pointing one of
+	// them to the second leaves three networks sharing the first.
+	data := append(encodeTestValue("shared"), encodeTestValue("own")...)
+	nodes := testTree("1.0.0.0/8", "2.0.0.0/8", "3.0.0.0/8", "4.0.0.0/8")
+	sharedPointer := uint(len(nodes)) + DataSectionSeparatorSize
+	ownPointer := sharedPointer + uint(len(encodeTestValue("shared")))
+REWRITE:
+	for i := range nodes {
+		for j, record := range nodes[i] {
+			if record == sharedPointer {
+				nodes[i][j] = ownPointer
+				break REWRITE
+			}
+		}
+	}
+	reader, err := FromBytes(testDatabase(nodes, data, nil))
+	require.Nil(t, err)
+
+	var networks int
+	n := reader.Networks()
+	for n.Next() {
+		networks++
+	}
+	require.Nil(t, n.Err())
+	assert.Equal(t, 4, networks)
+
+	var records []string
+	var offsets []uintptr
+	it := reader.Records(RecordsSizeHint(2))
+	for it.Next() {
+		var record string
+		require.Nil(t, it.Record(&record))
+		records = append(records, record)
+		offsets = append(offsets, it.Offset())
+
+		var decoded string
+		require.Nil(t, reader.Decode(it.Offset(), &decoded))
+		assert.Equal(t, record, decoded)
+	}
+	require.Nil(t, it.Err())
+	assert.ElementsMatch(t, []string{"shared", "own"}, records)
+	assert.Len(t, offsets, 2)
+	assert.NotEqual(t, offsets[0], offsets[1])
+
+	var own int
+	for _, ip := range []string{"1.1.1.1", "2.2.2.2", "3.3.3.3", "4.4.4.4"} {
+		var record string
+		require.Nil(t, reader.Lookup(net.ParseIP(ip), &record))
+		if record == "own" {
+			own++
+		}
+	}
+	assert.Equal(t, 1, own)
+
+	assert.Nil(t, reader.Close())
+	it = reader.Records()
+	assert.False(t, it.Next())
+	assert.Equal(t, ErrClosed, it.Err())
+}
@@ -0,0 +1,168 @@
+package maxminddb
+
+import (
+	"net"
+	"sync"
+	"sync/atomic"
+)
+
+// ReloadableReader wraps a Reader and allows the underlying database to be
+// replaced while lookups are in progress. It is safe for concurrent use.
+//
+// Each lookup uses a single database from start to finish; it never sees a
+// partially loaded database or a mix of the old and the new database. A
+// replaced database is only closed, and its memory map only released, once
+// all lookups using it have returned. Results decoded from the database do
+// not reference its memory and remain valid after it is closed.
+type ReloadableReader struct {
+	options []ReaderOption
+
+	// mu guards current and closed. Lookups hold it for reading while they
+	// take a reference to current, Reload and Close for writing.
+	mu      sync.RWMutex
+	current *refCountedReader
+	closed  bool
+}
+
+// refCountedReader is a Reader along with the number of references to it.
+// The ReloadableReader holds one reference while the Reader is current and
+// each lookup holds one while in progress. The Reader is closed when the
+// count drops to zero, after which it may not be referenced again.
+type refCountedReader struct {
+	refs   int64 // Accessed atomically; first for 64-bit alignment.
+	reader *Reader
+}
+
+// OpenReloadable opens the MaxMind DB file using Open and returns a
+// ReloadableReader for it. The options are used both for the initial
+// database and for any database loaded by Reload.
+func OpenReloadable(file string, options ...ReaderOption) (*ReloadableReader, error) {
+	reader, err := Open(file, options...)
+	if err != nil {
+		return nil, err
+	}
+	return &ReloadableReader{
+		options: options,
+		current: &refCountedReader{reader: reader, refs: 1},
+	}, nil
+}
+
+// Reload opens the MaxMind DB file and, if successful, makes it the database
+// used by subsequent lookups. Lookups that are in progress finish using the
+// previous database, which is closed once they have. If the new database
+// cannot be opened, an error is returned and the current database remains
+// in use. After Close, Reload returns ErrClosed.
+func (r *ReloadableReader) Reload(file string) error {
+	if r.isClosed() {
+		return ErrClosed
+	}
+	// The file is opened without holding mu, so that lookups do not wait
+	// for it.
+	reader, err := Open(file, r.options...)
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	if r.closed {
+		r.mu.Unlock()
+		if err := reader.Close(); err != nil {
+			return err
+		}
+		return ErrClosed
+	}
+	old := r.current
+	r.current = &refCountedReader{reader: reader, refs: 1}
+	r.mu.Unlock()
+	return old.release()
+}
+
+// Close closes the current database once all lookups in progress have
+// returned. Lookups started after Close return ErrClosed. Calling Close more
+// than once is safe.
+func (r *ReloadableReader) Close() error {
+	r.mu.Lock()
+	if r.closed {
+		r.mu.Unlock()
+		return nil
+	}
+	r.closed = true
+	current := r.current
+	r.mu.Unlock()
+	return current.release()
+}
+
+func (r *ReloadableReader) isClosed() bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.closed
+}
+
+// Metadata returns the metadata of the current database.
+func (r *ReloadableReader) Metadata() (Metadata, error) {
+	var metadata Metadata
+	err := r.use(func(reader *Reader) error {
+		metadata = reader.Metadata
+		return nil
+	})
+	return metadata, err
+}
+
+// Lookup calls Lookup on the current database.
+func (r *ReloadableReader) Lookup(ip net.IP, result interface{}) error {
+	return r.use(func(reader *Reader) error {
+		return reader.Lookup(ip, result)
+	})
+}
+
+// LookupNetwork calls LookupNetwork on the current database.
+func (r *ReloadableReader) LookupNetwork(
+	ip net.IP,
+	result interface{},
+) (network *net.IPNet, ok bool, err error) {
+	err = r.use(func(reader *Reader) error {
+		network, ok, err = reader.LookupNetwork(ip, result)
+		return err
+	})
+	return network, ok, err
+}
+
+// Use calls fn with the current database and returns the error returned by
+// fn. The database is guaranteed to remain open until fn returns, but not
+// afterwards. In particular, offsets returned by LookupOffset are only valid
+// for the Reader they were returned by and must not be used with a later
+// call to Use.
+func (r *ReloadableReader) Use(fn func(*Reader) error) error {
+	return r.use(fn)
+}
+
+func (r *ReloadableReader) use(fn func(*Reader) error) error {
+	current, err := r.acquire()
+	if err != nil {
+		return err
+	}
+	err = fn(current.reader)
+	if rerr := current.release(); err == nil {
+		err = rerr
+	}
+	return err
+}
+
+func (r *ReloadableReader) acquire() (*refCountedReader, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if r.closed {
+		return nil, ErrClosed
+	}
+	// The ReloadableReader's own reference keeps the count above zero
+	// while mu is held.
+	atomic.AddInt64(&r.current.refs, 1)
+	return r.current, nil
+}
+
+func (c *refCountedReader) release() error {
+	if atomic.AddInt64(&c.refs, -1) == 0 {
+		return c.reader.Close()
+	}
+	return nil
+}
@@ -0,0 +1,144 @@
+package maxminddb
+
+import (
+	"net"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReloadableReader(t *testing.T) {
+	reader, err := OpenReloadable("test-data/test-data/MaxMind-DB-test-ipv4-24.mmdb")
+	require.Nil(t, err)
+
+	metadata, err := reader.Metadata()
+	require.Nil(t, err)
+	assert.Equal(t, uint(24), metadata.RecordSize)
+
+	var record map[string]string
+	require.Nil(t, reader.Lookup(net.ParseIP("1.1.1.1"), &record))
+	assert.Equal(t, map[string]string{"ip": "1.1.1.1"}, record)
+
+	var old *Reader
+	require.Nil(t, reader.Use(func(r *Reader) error {
+		old = r
+		return nil
+	}))
+
+	require.Nil(t, reader.Reload("test-data/test-data/MaxMind-DB-test-ipv4-28.mmdb"))
+	metadata, err = reader.Metadata()
+	require.Nil(t, err)
+	assert.Equal(t, uint(28), metadata.RecordSize)
+	assert.Nil(t, old.buffer, "replaced database is closed")
+
+	network, ok, err := reader.LookupNetwork(net.ParseIP("1.1.1.3"), &record)
+	require.Nil(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, "1.1.1.2/31", network.String())
+
+	err = reader.Reload("file-does-not-exist.mmdb")
+	assert.NotNil(t, err)
+	metadata, err = reader.Metadata()
+	require.Nil(t, err)
+	assert.Equal(t, uint(28), metadata.RecordSize, "failed reload keeps the current database")
+
+	assert.Nil(t, reader.Close())
+	assert.Nil(t, reader.Close())
+
+	err = reader.Lookup(net.ParseIP("1.1.1.1"), &record)
+	assert.Equal(t, ErrClosed, err)
+	err = reader.Reload("test-data/test-data/MaxMind-DB-test-ipv4-24.mmdb")
+	assert.Equal(t, ErrClosed, err)
+}
+
+func TestReloadableReaderKeepsDatabaseOpenDuringUse(t *testing.T) {
+	reader, err := OpenReloadable("test-data/test-data/MaxMind-DB-test-ipv4-24.mmdb")
+	require.Nil(t, err)
+
+	require.Nil(t, reader.Use(func(r *Reader) error {
+		require.Nil(t, reader.Reload("test-data/test-data/MaxMind-DB-test-ipv4-28.mmdb"))
+		require.Nil(t, reader.Close())
+
+		var record map[string]string
+		require.Nil(t, r.Lookup(net.ParseIP("1.1.1.1"), &record))
+		assert.Equal(t, map[string]string{"ip": "1.1.1.1"}, record)
+		return nil
+	}))
+}
+
+func TestReloadableReaderConcurrentReload(t *testing.T) {
+	files := []string{
+		"test-data/test-data/MaxMind-DB-test-ipv4-24.mmdb",
+		"test-data/test-data/MaxMind-DB-test-ipv4-28.mmdb",
+		"test-data/test-data/MaxMind-DB-test-ipv4-32.mmdb",
+	}
+	reader, err := OpenReloadable(files[0])
+	require.Nil(t, err)
+
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				var record map[string]string
+				if err := reader.Lookup(net.ParseIP("1.1.1.16"), &record); err != nil {
+					t.Error(err)
+					return
+				}
+				if record["ip"] != "1.1.1.16" {
+					t.Errorf("unexpected record: %v", record)
+					return
+				}
+			}
+		}()
+	}
+
+	for i := 0; i < 100; i++ {
+		require.Nil(t, reader.Reload(files[i%len(files)]))
+	}
+	close(done)
+	wg.Wait()
+	assert.Nil(t, reader.Close())
+}
+
+func TestReloadableReaderCloseDuringLookup(t *testing.T) {
+	reader, err := OpenReloadable("test-data/test-data/MaxMind-DB-test-ipv4-24.mmdb")
+	require.Nil(t, err)
+
+	inUse := make(chan *Reader)
+	unblock := make(chan struct{})
+	done := make(chan error)
+	go func() {
+		done <- reader.Use(func(r *Reader) error {
+			inUse <- r
+			<-unblock
+			var record map[string]string
+			return r.Lookup(net.ParseIP("1.1.1.1"), &record)
+		})
+	}()
+	r := <-inUse
+
+	// The blocked lookup holds a reference, so neither closing twice nor
+	// reloading may release the database under it or revive the
+	// ReloadableReader.
+	assert.Nil(t, reader.Close())
+	assert.Nil(t, reader.Close())
+	assert.Equal(t, ErrClosed, reader.Reload("test-data/test-data/MaxMind-DB-test-ipv4-28.mmdb"))
+	var record map[string]string
+	assert.Equal(t, ErrClosed, reader.Lookup(net.ParseIP("1.1.1.1"), &record))
+	assert.NotNil(t, r.buffer, "database in use is not closed")
+
+	close(unblock)
+	assert.Nil(t, <-done)
+	assert.Nil(t, r.buffer, "database is closed once the lookup returns")
+	assert.Equal(t, ErrClosed, reader.Lookup(net.ParseIP("1.1.1.1"), &record))
+}
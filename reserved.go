@@ -0,0 +1,171 @@
+package maxminddb
+
+import "net"
+
+// reservedIPv4Networks are the IPv4 networks reserved for special use, per
+// the IANA IPv4 Special-Purpose Address Registry.
+var reservedIPv4Networks = []string{
+	"0.0.0.0/8",       // "This network"
+	"10.0.0.0/8",      // Private-Use, RFC 1918
+	"100.64.0.0/10",   // Shared Address Space, RFC 6598
+	"127.0.0.0/8",     // Loopback
+	"169.254.0.0/16",  // Link-Local
+	"172.16.0.0/12",   // Private-Use, RFC 1918
+	"192.0.0.0/24",    // IETF Protocol Assignments
+	"192.0.2.0/24",    // Documentation (TEST-NET-1)
+	"192.88.99.0/24",  // Deprecated 6to4 Relay Anycast
+	"192.168.0.0/16",  // Private-Use, RFC 1918
+	"198.18.0.0/15",   // Benchmarking
+	"198.51.100.0/24", // Documentation (TEST-NET-2)
+	"203.0.113.0/24",  // Documentation (TEST-NET-3)
+	"224.0.0.0/4",     // Multicast
+	"240.0.0.0/4",     // Reserved, including the limited broadcast address
+}
+
+// reservedIPv6Networks are the IPv6 networks reserved for special use, per
+// the IANA IPv6 Special-Purpose Address Registry. The IPv4 reserved networks
+// are added in each of the IPv4 address spaces of an IPv6 database by
+// ipv6ReservedNetworks.
+var reservedIPv6Networks = []string{
+	"::1/128",       // Loopback
+	"::/128",        // Unspecified
+	"100::/64",      // Discard-Only
+	"2001::/23",     // IETF Protocol Assignments
+	"2001:db8::/32", // Documentation
+	"fc00::/7",      // Unique-Local
+	"fe80::/10",     // Link-Local Unicast
+	"ff00::/8",      // Multicast
+}
+
+// ipv4AddressSpaces are the networks of an IPv6 database that may contain
+// the IPv4 address space: the IPv4 subtree, ::/96, followed by the networks
+// writers commonly alias to it, i.e., the IPv4-mapped addresses, Teredo, and
+// 6to4. The IPv4 address starts at bit prefixLen of the addresses of each
+// network. Teredo is aliased at bit 32, where its addresses hold the IPv4
+// address of the Teredo server, as the client address in the last 32 bits is
+// obfuscated. Its reserved networks are all within 2001::/23.
+var ipv4AddressSpaces = []struct {
+	prefix    net.IP
+	prefixLen uint
+}{
+	{net.ParseIP("::"), 96},
+	{net.ParseIP("::ffff:0:0"), 96},
+	{net.ParseIP("2001::"), 32},
+	{net.ParseIP("2002::"), 16},
+}
+
+var (
+	reservedIPv4 = parseNetworks(reservedIPv4Networks)
+	reservedIPv6 = append(
+		parseNetworks(reservedIPv6Networks),
+		ipv6ReservedNetworks()...,
+	)
+
+	reservedIPv4Trie = newReservedTrie(reservedIPv4)
+	reservedIPv6Trie = newReservedTrie(reservedIPv6)
+)
+
+func parseNetworks(cidrs []string) []*net.IPNet {
+	networks := make([]*net.IPNet, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(err)
+		}
+		networks = append(networks, network)
+	}
+	return networks
+}
+
+// ipv6ReservedNetworks returns the IPv4 reserved networks in each of the IPv4
+// address spaces of an IPv6 database.
+func ipv6ReservedNetworks() []*net.IPNet {
+	var networks []*net.IPNet
+	for _, space := range ipv4AddressSpaces {
+		for _, v4 := range reservedIPv4 {
+			ip := make(net.IP, net.IPv6len)
+			copy(ip, space.prefix)
+			setBits(ip, int(space.prefixLen), v4.IP.To4())
+
+			ones, _ := v4.Mask.Size()
+			networks = append(networks, &net.IPNet{
+				IP:   ip,
+				Mask: net.CIDRMask(int(space.prefixLen)+ones, 8*net.IPv6len),
+			})
+		}
+	}
+	return networks
+}
+
+// setBits copies the bits of src into dst, starting at bit offset of dst.
+func setBits(dst net.IP, offset int, src []byte) {
+	for i := 0; i < 8*len(src); i++ {
+		if src[i>>3]&(1<<uint(7-i%8)) == 0 {
+			continue
+		}
+		j := offset + i
+		dst[j>>3] |= 1 << uint(7-j%8)
+	}
+}
+
+// noReservedNetworks is the position in a reservedTrie of the networks that
+// neither are nor contain a reserved network.
+const noReservedNetworks = -1
+
+// reservedTrie is a binary trie over the bits of the reserved networks of
+// one address length. Networks keeps the position in the trie of each node
+// of the search tree it visits, so that whether a node is in a reserved
+// network takes a single step per bit rather than a comparison with every
+// reserved network. The root is at position 0.
+type reservedTrie []reservedTrieNode
+
+type reservedTrieNode struct {
+	// children are the positions following a 0 and a 1 bit, or 0 if no
+	// reserved network starts with the bits leading there.
+	children [2]int32
+	// reserved is set if the bits leading to the node are those of a
+	// reserved network.
+	reserved bool
+}
+
+func newReservedTrie(networks []*net.IPNet) reservedTrie {
+	trie := reservedTrie{{}}
+	for _, network := range networks {
+		ones, _ := network.Mask.Size()
+		var pos int32
+		for i := 0; i < ones; i++ {
+			b := network.IP[i>>3] >> uint(7-i%8) & 1
+			if trie[pos].children[b] == 0 {
+				trie = append(trie, reservedTrieNode{})
+				trie[pos].children[b] = int32(len(trie) - 1)
+			}
+			pos = trie[pos].children[b]
+		}
+		trie[pos].reserved = true
+	}
+	return trie
+}
+
+// child returns the position following pos for the next bit of a network,
+// which is 0 or 1.
+func (t reservedTrie) child(pos int32, b byte) int32 {
+	if pos == noReservedNetworks || t[pos].children[b] == 0 {
+		return noReservedNetworks
+	}
+	return t[pos].children[b]
+}
+
+// isReserved returns true if the network at pos is contained in a reserved
+// network.
+func (t reservedTrie) isReserved(pos int32) bool {
+	return pos != noReservedNetworks && t[pos].reserved
+}
+
+// position returns the position of the network ip/bit.
+func (t reservedTrie) position(ip []byte, bit uint) int32 {
+	var pos int32
+	for i := uint(0); i < bit && !t.isReserved(pos); i++ {
+		pos = t.child(pos, ip[i>>3]>>(7-i%8)&1)
+	}
+	return pos
+}
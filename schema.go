@@ -0,0 +1,70 @@
+package maxminddb
+
+import (
+	"fmt"
+	"net"
+	"reflect"
+	"sync"
+)
+
+var schemas = struct {
+	sync.RWMutex
+	factories map[string]func() interface{}
+}{factories: map[string]func() interface{}{}}
+
+// RegisterSchema registers the type that LookupAuto decodes records of
+// databases of type dbType into, e.g., "GeoIP2-City". The factory must return
+// a new pointer, such as &City{}, each time it is called. Registering a
+// schema for a type that already has one replaces it. RegisterSchema is safe
+// for concurrent use and is typically called from an init function.
+func RegisterSchema(dbType string, factory func() interface{}) {
+	schemas.Lock()
+	defer schemas.Unlock()
+	schemas.factories[dbType] = factory
+}
+
+// DatabaseType returns the type of the database from its metadata, e.g.,
+// "GeoLite2-City" or "GeoIP2-ISP".
+func (r *Reader) DatabaseType() string {
+	return r.Metadata.DatabaseType
+}
+
+// LookupAuto looks up the IP address and decodes its record into a new value
+// from the factory registered with RegisterSchema for the type of the
+// database. It returns the pointer returned by the factory. If the database
+// does not contain a record for the IP address, a nil value is returned along
+// with a nil error, or ErrNotFound if the Reader was created with the
+// WithNotFoundError option. An error is returned if no schema is registered
+// for the database type.
+func (r *Reader) LookupAuto(ipAddress net.IP) (interface{}, error) {
+	if r.buffer == nil {
+		return nil, ErrClosed
+	}
+	schemas.RLock()
+	factory, ok := schemas.factories[r.Metadata.DatabaseType]
+	schemas.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("maxminddb: no schema registered for database type %q", r.Metadata.DatabaseType)
+	}
+
+	pointer, _, _, err := r.lookupPointer(ipAddress)
+	if err != nil {
+		return nil, err
+	}
+	if pointer == 0 {
+		return nil, r.errNotFound()
+	}
+
+	result := factory()
+	if rv := reflect.ValueOf(result); rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return nil, fmt.Errorf(
+			"maxminddb: schema for database type %q returned %T, not a non-nil pointer",
+			r.Metadata.DatabaseType,
+			result,
+		)
+	}
+	if err := r.retrieveData(pointer, result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
@@ -0,0 +1,53 @@
+package maxminddb
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testSchema struct {
+	IP string `maxminddb:"ip"`
+}
+
+func TestLookupAuto(t *testing.T) {
+	data := encodeTestValue(map[string]interface{}{"ip": "1.0.0.0"})
+	db := testDatabase([][2]uint{{17, 1}}, data, map[string]interface{}{
+		"database_type": "Test-Schema",
+	})
+	reader, err := FromBytes(db)
+	require.Nil(t, err)
+	assert.Equal(t, "Test-Schema", reader.DatabaseType())
+
+	_, err = reader.LookupAuto(net.ParseIP("1.1.1.1"))
+	assert.EqualError(t, err, `maxminddb: no schema registered for database type "Test-Schema"`)
+
+	RegisterSchema("Test-Schema", func() interface{} { return &testSchema{} })
+	defer func() {
+		schemas.Lock()
+		delete(schemas.factories, "Test-Schema")
+		schemas.Unlock()
+	}()
+
+	result, err := reader.LookupAuto(net.ParseIP("1.1.1.1"))
+	require.Nil(t, err)
+	assert.Equal(t, &testSchema{IP: "1.0.0.0"}, result)
+
+	result, err = reader.LookupAuto(net.ParseIP("200.1.1.1"))
+	assert.Nil(t, err)
+	assert.Nil(t, result)
+
+	RegisterSchema("Test-Schema", func() interface{} { return testSchema{} })
+	_, err = reader.LookupAuto(net.ParseIP("1.1.1.1"))
+	assert.EqualError(
+		t,
+		err,
+		`maxminddb: schema for database type "Test-Schema" returned maxminddb.testSchema, not a non-nil pointer`,
+	)
+
+	assert.Nil(t, reader.Close())
+	_, err = reader.LookupAuto(net.ParseIP("1.1.1.1"))
+	assert.Equal(t, ErrClosed, err)
+}
@@ -1,61 +1,519 @@
 package maxminddb
 
-import "net"
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+)
 
-// Internal structure used to keep track of nodes we still need to visit.
+// contextCheckInterval is the number of search tree nodes visited between
+// checks of the context passed to NetworksWithContext or
+// NetworksWithinContext.
+const contextCheckInterval = 1024
+
+// Internal structure used to keep track of nodes we still need to visit. The
+// IP is stored in an array rather than a net.IP so that nodes can be pushed
+// onto the stack without allocating. Only the first Networks.ipLen bytes are
+// used.
 type netNode struct {
-	ip      net.IP
+	ip      [net.IPv6len]byte
 	bit     uint
 	pointer uint
+	// reserved is the position of the network in the reservedTrie for the
+	// length of ip.
+	reserved int32
 }
 
-// Networks represents a set of subnets that we are iterating over.
+// Networks represents a set of subnets that we are iterating over. A Networks
+// value must only be used by one goroutine at a time, but any number of
+// Networks created from the same Reader may be used concurrently.
 type Networks struct {
-	reader   *Reader
-	nodes    []netNode // Nodes we still have to visit.
-	lastNode netNode
-	err      error
+	reader              *Reader
+	nodes               []netNode // Nodes we still have to visit.
+	lastNode            netNode
+	ipLen               int // Length of the IPs of the nodes, 4 or 16.
+	err                 error
+	skipAliasedNetworks bool
+	skipReserved        bool
+	keepIPv6Form        bool
+	ctx                 context.Context
+	visited             uint // Nodes visited since ctx was last checked.
+}
+
+// NetworksOption are options for Networks and NetworksWithin.
+type NetworksOption func(*Networks)
+
+// SkipAliasedNetworks is an option for Networks and NetworksWithin that
+// makes them not iterate over aliases of the IPv4 subtree in an IPv6
+// database, e.g., ::ffff:0:0/96. Each IPv4 network is then returned exactly
+// once, in its 4-byte form.
+//
+// This is not the default behavior in order to remain backwards compatible.
+func SkipAliasedNetworks(networks *Networks) {
+	networks.skipAliasedNetworks = true
+}
+
+// SkipReservedNetworks is an option for Networks and NetworksWithin that
+// makes them not iterate over networks reserved for special use, such as the
+// private networks of RFC 1918, loopback, link-local, multicast, and
+// documentation networks. In an IPv6 database, the IPv4 reserved networks are
+// also skipped in the IPv4 subtree and in the IPv4-mapped and 6to4 address
+// spaces.
+//
+// Only networks contained within a reserved network are skipped. A network in
+// the database that contains a reserved network, e.g., 172.0.0.0/8, is still
+// returned.
+func SkipReservedNetworks(networks *Networks) {
+	networks.skipReserved = true
+}
+
+// KeepIPv6Form is an option for Networks and NetworksWithin that makes them
+// return the networks of an IPv6 database in their 16-byte form, with a mask
+// over 128 bits, e.g., ::ffff:1.1.1.0 with a /120 mask rather than
+// 1.1.1.0/24. Without it, networks in ::/96 and ::ffff:0:0/96 are returned as
+// IPv4 networks. Note that the String method of net.IPNet still formats an
+// IPv4-mapped network as an IPv4 one. The option has no effect on an IPv4
+// database.
+func KeepIPv6Form(networks *Networks) {
+	networks.keepIPv6Form = true
 }
 
 // Networks returns an iterator that can be used to traverse all networks in
 // the database.
 //
+// The networks are returned in ascending order of their first address, so
+// iterating over two databases side by side is enough to diff them. In an
+// IPv6 database the order is that of the IPv6 addresses in the search tree,
+// even though networks in ::/96 and ::ffff:0:0/96 are returned in their
+// 4-byte form unless the KeepIPv6Form option is set.
+//
+// A record of the search tree either points to another node or to data, so
+// the traversal never descends past a network with data and the networks
+// returned never overlap. A database does not store a network whose data is
+// overridden for some of its sub-prefixes: writers split it into the largest
+// networks around the overrides instead. Inserting 0.0.0.0/1 and then an
+// override for 64.0.0.0/3, for example, results in 0.0.0.0/2, 64.0.0.0/3, and
+// 96.0.0.0/3, which are the networks returned. AggregatedNetworks merges the
+// parts of such a network back together where they form larger networks.
+//
 // Please note that a MaxMind DB may map IPv4 networks into several locations
 // in in an IPv6 database. This iterator will iterate over all of these
-// locations separately.
-func (r *Reader) Networks() *Networks {
-	s := 4
-	if r.Metadata.IPVersion == 6 {
-		s = 16
+// locations separately. To only iterate over the IPv4 networks once, use the
+// SkipAliasedNetworks option.
+func (r *Reader) Networks(options ...NetworksOption) *Networks {
+	networks := r.newNetworks(options)
+	networks.ipLen = net.IPv4len
+	if r.Metadata.IsIPv6() {
+		networks.ipLen = net.IPv6len
+	}
+	networks.nodes = []netNode{{}}
+	return networks
+}
+
+func (r *Reader) newNetworks(options []NetworksOption) *Networks {
+	networks := &Networks{reader: r}
+	for _, option := range options {
+		option(networks)
+	}
+	if r.buffer == nil {
+		networks.err = ErrClosed
+	}
+	return networks
+}
+
+// NetworksWithContext is like Networks, except that the iteration stops once
+// ctx is done. The context's error is then returned by Err. The context is
+// checked periodically rather than on every node of the search tree, so a
+// small number of networks may still be returned after ctx is done.
+func (r *Reader) NetworksWithContext(ctx context.Context, options ...NetworksOption) *Networks {
+	networks := r.Networks(options...)
+	networks.setContext(ctx)
+	return networks
+}
+
+// NetworksWithin returns an iterator that can be used to traverse all networks
+// in the database which are contained in a given network.
+//
+// If the provided network is contained within a network in the database, the
+// iterator will iterate over exactly one network, the containing network.
+//
+// An IPv4 network passed to an IPv6 database is looked up in the IPv4-mapped
+// IPv6 address space, ::ffff:0:0/96. If the SkipAliasedNetworks option is
+// set, it is instead looked up in the IPv4 subtree, ::/96.
+func (r *Reader) NetworksWithin(network *net.IPNet, options ...NetworksOption) *Networks {
+	networks := r.newNetworks(options)
+	if networks.err != nil {
+		return networks
+	}
+
+	ip := network.IP
+	prefixLength, bits := network.Mask.Size()
+	if bits == 8*net.IPv4len {
+		ip = ip.To4()
+	}
+
+	if ip == nil || (r.Metadata.IPVersion == IPv4 && len(ip) != net.IPv4len) {
+		networks.err = fmt.Errorf(
+			"error getting networks with '%s': you attempted to use an IPv6 network in an IPv4-only database",
+			network.String(),
+		)
+		return networks
+	}
+
+	if r.Metadata.IsIPv6() && len(ip) == net.IPv4len {
+		if networks.skipAliasedNetworks {
+			ip = append(make(net.IP, 12, net.IPv6len), ip...)
+		} else {
+			ip = ip.To16()
+		}
+		prefixLength += 96
+	}
+
+	pointer, bit, err := r.traverseTree(ip, 0, uint(prefixLength))
+	if err != nil {
+		networks.err = err
+		return networks
+	}
+
+	node := netNode{
+		bit:     bit,
+		pointer: pointer,
+	}
+	copy(node.ip[:], ip.Mask(net.CIDRMask(int(bit), len(ip)*8)))
+	networks.ipLen = len(ip)
+	node.reserved = networks.reservedTrie().position(node.ip[:networks.ipLen], bit)
+	networks.nodes = []netNode{node}
+	return networks
+}
+
+// NetworksWithinString is like NetworksWithin, except that the network is
+// given as a string in CIDR notation, e.g., "1.0.0.0/8" or "2001:db8::/32".
+// An error parsing the network, or an error NetworksWithin would return from
+// Err before the first call to Next, such as the one for an IPv6 network in
+// an IPv4 database, is returned directly.
+func (r *Reader) NetworksWithinString(cidr string, options ...NetworksOption) (*Networks, error) {
+	_, network, err := net.ParseCIDR(cidr)
+	if err != nil {
+		return nil, err
+	}
+	networks := r.NetworksWithin(network, options...)
+	if networks.err != nil {
+		return nil, networks.err
+	}
+	return networks, nil
+}
+
+// NetworksFrom returns an iterator over the networks of the database whose
+// first address is greater than or equal to start, in the order of Networks.
+// The network containing start is only included if start is its first
+// address. This allows resuming an iteration, e.g., to export a database in
+// pages: each page starts from the address following the last network of the
+// previous one.
+//
+// Like with NetworksWithin, an IPv4 address passed to an IPv6 database is
+// taken to be in ::ffff:0:0/96, or in ::/96 with the SkipAliasedNetworks
+// option. Use the KeepIPv6Form option to get networks whose addresses can be
+// passed back to NetworksFrom unambiguously.
+func (r *Reader) NetworksFrom(start net.IP, options ...NetworksOption) *Networks {
+	networks := r.newNetworks(options)
+	if networks.err != nil {
+		return networks
+	}
+
+	ip := start.To4()
+	if ip == nil {
+		ip = start.To16()
+	}
+	if ip == nil {
+		networks.err = fmt.Errorf(
+			"error getting networks from %v: an IP address must be 4 or 16 bytes, not %d",
+			[]byte(start),
+			len(start),
+		)
+		return networks
+	}
+	if r.Metadata.IPVersion == IPv4 && len(ip) != net.IPv4len {
+		networks.err = fmt.Errorf(
+			"error getting networks from '%s': you attempted to use an IPv6 address in an IPv4-only database",
+			start.String(),
+		)
+		return networks
+	}
+	if r.Metadata.IsIPv6() && len(ip) == net.IPv4len {
+		if networks.skipAliasedNetworks {
+			ip = append(make(net.IP, 12, net.IPv6len), ip...)
+		} else {
+			ip = ip.To16()
+		}
+	}
+	networks.ipLen = len(ip)
+
+	// Descend towards start, pushing the right children on the way down
+	// as Next does. The left children hold the networks before start.
+	trie := networks.reservedTrie()
+	var node netNode
+	for node.pointer < r.Metadata.NodeCount {
+		if networks.skipAliasedNetworks && networks.isAliasedNetwork(node) {
+			return networks
+		}
+		if networks.skipReserved && trie.isReserved(node.reserved) {
+			return networks
+		}
+		if networks.ipLen <= int(node.bit>>3) {
+			networks.err = newInvalidDatabaseError(
+				"invalid search tree at %v/%v", networks.nodeIP(node), node.bit)
+			return networks
+		}
+
+		mask := byte(1) << (7 - (node.bit % 8))
+		index := uint(0)
+		if ip[node.bit>>3]&mask != 0 {
+			index = 1
+		} else {
+			rightPointer, err := r.readNode(node.pointer, 1)
+			if err != nil {
+				networks.err = err
+				return networks
+			}
+			right := netNode{
+				ip:       node.ip,
+				bit:      node.bit + 1,
+				pointer:  rightPointer,
+				reserved: trie.child(node.reserved, 1),
+			}
+			right.ip[node.bit>>3] |= mask
+			networks.nodes = append(networks.nodes, right)
+		}
+
+		pointer, err := r.readNode(node.pointer, index)
+		if err != nil {
+			networks.err = err
+			return networks
+		}
+		if index == 1 {
+			node.ip[node.bit>>3] |= mask
+		}
+		node.bit++
+		node.pointer = pointer
+		node.reserved = trie.child(node.reserved, byte(index))
+	}
+
+	// node is the network containing start.
+	if bytes.Equal(node.ip[:networks.ipLen], ip) {
+		networks.nodes = append(networks.nodes, node)
 	}
-	return &Networks{
-		reader: r,
-		nodes: []netNode{
-			{
-				ip: make(net.IP, s),
-			},
-		},
+	return networks
+}
+
+// NetworksWithinContext is like NetworksWithin, except that the iteration
+// stops once ctx is done. See NetworksWithContext.
+func (r *Reader) NetworksWithinContext(
+	ctx context.Context,
+	network *net.IPNet,
+	options ...NetworksOption,
+) *Networks {
+	networks := r.NetworksWithin(network, options...)
+	networks.setContext(ctx)
+	return networks
+}
+
+func (n *Networks) setContext(ctx context.Context) {
+	n.ctx = ctx
+	if n.err == nil {
+		n.err = ctx.Err()
 	}
 }
 
+// Traverse calls fn for each network in the database along with the offset of
+// the network's data record, which may be passed to Decode. If fn returns an
+// error, the traversal stops immediately and the error is returned. Traverse
+// accepts the same options as Networks.
+func (r *Reader) Traverse(
+	fn func(network *net.IPNet, offset uintptr) error,
+	options ...NetworksOption,
+) error {
+	if r.buffer == nil {
+		return ErrClosed
+	}
+	n := r.Networks(options...)
+	for n.Next() {
+		offset, err := r.resolveDataPointer(n.lastNode.pointer)
+		if err != nil {
+			return err
+		}
+		if err := fn(n.network(), offset); err != nil {
+			return err
+		}
+	}
+	return n.Err()
+}
+
+// NetworkCount returns the number of networks in the database, i.e., the
+// number of networks Networks would iterate over with the same options. The
+// networks are counted while walking the search tree without building their
+// net.IPNet or decoding their data.
+func (r *Reader) NetworkCount(options ...NetworksOption) (int, error) {
+	if r.buffer == nil {
+		return 0, ErrClosed
+	}
+	count := 0
+	n := r.Networks(options...)
+	for n.Next() {
+		count++
+	}
+	return count, n.Err()
+}
+
+// Record is a network in the database together with the offset of its data
+// record. The offset may be passed to Decode to decode the record.
+type Record struct {
+	Network *net.IPNet
+	Offset  uintptr
+}
+
+// NetworkRecord is a network in the database together with its decoded data
+// record, as sent by NetworksChan. If Err is set, the iteration failed and
+// Network and Data are nil.
+type NetworkRecord struct {
+	Network *net.IPNet
+	Data    interface{}
+	Err     error
+}
+
+// NetworksChan returns a channel on which every network in the database is
+// sent along with its data record, decoded into a value returned by result.
+// result is called once per network and must return a new pointer each time,
+// e.g., func() interface{} { return &City{} }, so that the values received
+// from the channel may be handed off to other goroutines.
+//
+// The networks are found and decoded by a single goroutine, one at a time.
+// The channel is unbuffered: no further network is decoded until the
+// previous one has been received, so a slow receiver slows down the
+// traversal rather than causing records to pile up in memory.
+//
+// The channel is closed once every network has been sent. If an error
+// occurs, a final NetworkRecord holding it is sent before the channel is
+// closed. If ctx is cancelled, the channel is closed without one; ctx.Err
+// reports the cancellation. The receiver must drain the channel or cancel ctx
+// for the goroutine to exit.
+func (r *Reader) NetworksChan(
+	ctx context.Context,
+	result func() interface{},
+	options ...NetworksOption,
+) <-chan NetworkRecord {
+	records := make(chan NetworkRecord)
+	go func() {
+		defer close(records)
+		send := func(record NetworkRecord) bool {
+			select {
+			case records <- record:
+				return true
+			case <-ctx.Done():
+				return false
+			}
+		}
+
+		if r.buffer == nil {
+			send(NetworkRecord{Err: ErrClosed})
+			return
+		}
+		n := r.NetworksWithContext(ctx, options...)
+		for n.Next() {
+			data := result()
+			network, err := n.Network(data)
+			if err != nil {
+				send(NetworkRecord{Err: err})
+				return
+			}
+			if !send(NetworkRecord{Network: network, Data: data}) {
+				return
+			}
+		}
+		if err := n.Err(); err != nil && ctx.Err() == nil {
+			send(NetworkRecord{Err: err})
+		}
+	}()
+	return records
+}
+
+// RecordsWithin returns the networks within network that are in the database
+// along with the offsets of their data records, in the order NetworksWithin
+// would visit them. At most limit records are returned. If network contains
+// more than limit records, the first limit records are returned together
+// with a RecordLimitError whose Next field is the first network that was not
+// returned.
+func (r *Reader) RecordsWithin(
+	network *net.IPNet,
+	limit int,
+	options ...NetworksOption,
+) ([]Record, error) {
+	if r.buffer == nil {
+		return nil, ErrClosed
+	}
+	if limit <= 0 {
+		return nil, fmt.Errorf("limit passed to RecordsWithin must be positive, got %d", limit)
+	}
+	var records []Record
+	n := r.NetworksWithin(network, options...)
+	for n.Next() {
+		if len(records) == limit {
+			return records, RecordLimitError{Limit: limit, Next: n.network()}
+		}
+		offset, err := r.resolveDataPointer(n.lastNode.pointer)
+		if err != nil {
+			return records, err
+		}
+		records = append(records, Record{Network: n.network(), Offset: offset})
+	}
+	return records, n.Err()
+}
+
 // Next prepares the next network for reading with the Network method. It
 // returns true if there is another network to be processed and false if there
 // are no more networks or if there is an error.
 func (n *Networks) Next() bool {
+	if n.err != nil {
+		return false
+	}
+	if n.reader.buffer == nil {
+		n.err = ErrClosed
+		return false
+	}
+	trie := n.reservedTrie()
 	for len(n.nodes) > 0 {
 		node := n.nodes[len(n.nodes)-1]
 		n.nodes = n.nodes[:len(n.nodes)-1]
 
 		for {
+			if n.ctx != nil {
+				n.visited++
+				if n.visited >= contextCheckInterval {
+					n.visited = 0
+					if err := n.ctx.Err(); err != nil {
+						n.err = err
+						return false
+					}
+				}
+			}
+
 			if node.pointer < n.reader.Metadata.NodeCount {
-				ipRight := make(net.IP, len(node.ip))
-				copy(ipRight, node.ip)
-				if len(ipRight) <= int(node.bit>>3) {
+				if n.skipAliasedNetworks && n.isAliasedNetwork(node) {
+					break
+				}
+				if n.skipReserved && trie.isReserved(node.reserved) {
+					break
+				}
+
+				// Stopping at the length of an address also bounds
+				// the stack, which grows by one node per bit, for
+				// corrupt trees with cycles.
+				if n.ipLen <= int(node.bit>>3) {
 					n.err = newInvalidDatabaseError(
-						"invalid search tree at %v/%v", ipRight, node.bit)
+						"invalid search tree at %v/%v", n.nodeIP(node), node.bit)
 					return false
 				}
-				ipRight[node.bit>>3] |= 1 << (7 - (node.bit % 8))
 
 				rightPointer, err := n.reader.readNode(node.pointer, 1)
 				if err != nil {
@@ -63,12 +521,20 @@ func (n *Networks) Next() bool {
 					return false
 				}
 
+				right := netNode{
+					ip:       node.ip,
+					bit:      node.bit + 1,
+					pointer:  rightPointer,
+					reserved: trie.child(node.reserved, 1),
+				}
+				right.ip[node.bit>>3] |= 1 << (7 - (node.bit % 8))
+				// The right child is pushed while the loop goes on
+				// with the left one, so networks come out in
+				// ascending order.
+				n.nodes = append(n.nodes, right)
+
 				node.bit++
-				n.nodes = append(n.nodes, netNode{
-					pointer: rightPointer,
-					ip:      ipRight,
-					bit:     node.bit,
-				})
+				node.reserved = trie.child(node.reserved, 0)
 
 				node.pointer, err = n.reader.readNode(node.pointer, 0)
 				if err != nil {
@@ -76,7 +542,10 @@ func (n *Networks) Next() bool {
 					return false
 				}
 
-			} else if node.pointer > n.reader.Metadata.NodeCount {
+			} else if node.pointer > n.reader.Metadata.NodeCount || n.reader.emptyNodes {
+				if n.skipReserved && trie.isReserved(node.reserved) {
+					break
+				}
 				n.lastNode = node
 				return true
 			} else {
@@ -90,16 +559,57 @@ func (n *Networks) Next() bool {
 
 // Network returns the current network or an error if there is a problem
 // decoding the data for the network. It takes a pointer to a result value to
-// decode the network's data into.
+// decode the network's data into. The returned network does not share memory
+// with the Networks and remains valid after later calls to Next.
 func (n *Networks) Network(result interface{}) (*net.IPNet, error) {
 	if err := n.reader.retrieveData(n.lastNode.pointer, result); err != nil {
 		return nil, err
 	}
 
+	return n.network(), nil
+}
+
+// Offset returns the offset of the data of the current network in the data
+// section without decoding it. The offset may be passed to Decode, and
+// networks sharing a record have the same offset, so it can serve as the key
+// of a cache of decoded records. Offset must only be called after Next has
+// returned true. In a corrupt database, the offset may be past the end of
+// the data section, in which case Decode returns an error. For an empty
+// record, which Networks only returns with the WithEmptyNodes option, the
+// offset is NotFound.
+func (n *Networks) Offset() uintptr {
+	if n.lastNode.pointer == n.reader.Metadata.NodeCount {
+		return NotFound
+	}
+	return uintptr(n.lastNode.pointer - n.reader.Metadata.NodeCount - DataSectionSeparatorSize)
+}
+
+func (n *Networks) network() *net.IPNet {
+	return n.nodeNetwork(n.lastNode)
+}
+
+// nodeNetwork returns the network of node.
+func (n *Networks) nodeNetwork(node netNode) *net.IPNet {
+	ip := n.nodeIP(node)
+	switch {
+	case n.keepIPv6Form:
+	case node.bit >= 96:
+		// Networks in the IPv4 subtree are returned as IPv4 networks.
+		ip = ipv4SubtreeNetworkIP(ip, node.bit)
+	default:
+		ip = SanitizeIPv6(ip)
+	}
 	return &net.IPNet{
-		IP:   SanitizeIPv6(n.lastNode.ip),
-		Mask: net.CIDRMask(int(n.lastNode.bit), len(n.lastNode.ip)*8),
-	}, nil
+		IP:   ip,
+		Mask: net.CIDRMask(int(node.bit), n.ipLen*8),
+	}
+}
+
+// nodeIP returns a copy of the IP of node.
+func (n *Networks) nodeIP(node netNode) net.IP {
+	ip := make(net.IP, n.ipLen)
+	copy(ip, node.ip[:])
+	return ip
 }
 
 // Err returns an error, if any, that was encountered during iteration.
@@ -107,6 +617,24 @@ func (n *Networks) Err() error {
 	return n.err
 }
 
+// isAliasedNetwork returns true if node is the IPv4 start node reached from
+// outside of the IPv4 subtree, ::/96, i.e., if it is an alias of the IPv4
+// subtree.
+func (n *Networks) isAliasedNetwork(node netNode) bool {
+	return n.reader.Metadata.IsIPv6() &&
+		node.pointer == n.reader.ipv4Start &&
+		!isZeros(node.ip[0:12])
+}
+
+// reservedTrie returns the trie of the reserved networks for the length of
+// the IPs of the nodes.
+func (n *Networks) reservedTrie() reservedTrie {
+	if n.ipLen == net.IPv6len {
+		return reservedIPv6Trie
+	}
+	return reservedIPv4Trie
+}
+
 // Is p all zeros?
 func isZeros(p net.IP) bool {
 	for i := 0; i < len(p); i++ {
@@ -117,21 +645,52 @@ func isZeros(p net.IP) bool {
 	return true
 }
 
-// SanitizeIPv6 converts the IPv6 address ip to a 4-byte representation.
-// If ip is not an IPv4 address, SanitizeIPv6 returns the original IP object.
+// SanitizeIPv6 converts the IPv4-mapped IPv6 address ip, i.e., an address in
+// ::ffff:0:0/96, to a 4-byte representation. If ip is not an IPv4-mapped
+// address, SanitizeIPv6 returns the original IP object.
+//
+// Use SanitizeIPv6Compatible to also convert IPv4-compatible addresses.
 func SanitizeIPv6(ip net.IP) net.IP {
-	var v4LeadingPrefix bool
-	if len(ip) == net.IPv6len {
-		if isZeros(ip[0:10]) && ip[10] == 0xff && ip[11] == 0xff {
-			v4LeadingPrefix = true
-		}
-		if isZeros(ip[0:12]) {
-			v4LeadingPrefix = true
-		}
-		if v4LeadingPrefix {
-			return ip[12:16]
-		}
+	if len(ip) == net.IPv6len && isZeros(ip[0:10]) && ip[10] == 0xff && ip[11] == 0xff {
+		return ip[12:16]
 	}
 	return ip
 }
 
+// SanitizeIPv6Compatible is like SanitizeIPv6, except that it also converts
+// the deprecated IPv4-compatible IPv6 addresses, i.e., the addresses in ::/96
+// other than the unspecified address, ::, and the loopback address, ::1. In
+// an IPv6 MaxMind DB, ::/96 holds the IPv4 address space.
+func SanitizeIPv6Compatible(ip net.IP) net.IP {
+	if len(ip) == net.IPv6len && isZeros(ip[0:12]) {
+		if isZeros(ip[12:15]) && ip[15] <= 1 {
+			return ip
+		}
+		return ip[12:16]
+	}
+	return SanitizeIPv6(ip)
+}
+
+// ipv4SubtreeNetworkIP returns, in IPv4 form, the IP of a network of an
+// IPv6 search tree with a prefix length of at least 96 bits, like
+// SanitizeIPv6Compatible. Only the networks of the single addresses :: and
+// ::1 keep their IPv6 form; e.g., ::/104 is returned as 0.0.0.0/8.
+func ipv4SubtreeNetworkIP(ip net.IP, prefixLength uint) net.IP {
+	if prefixLength < 128 && len(ip) == net.IPv6len && isZeros(ip[0:12]) {
+		return ip[12:16]
+	}
+	return SanitizeIPv6Compatible(ip)
+}
+
+// NormalizeIP is like SanitizeIPv6, except that it returns an error if ip is
+// not a valid IP address, i.e., if it is nil or neither 4 nor 16 bytes long,
+// rather than returning it unchanged.
+func NormalizeIP(ip net.IP) (net.IP, error) {
+	if ip == nil {
+		return nil, errors.New("ip passed to NormalizeIP cannot be nil")
+	}
+	if len(ip) != net.IPv4len && len(ip) != net.IPv6len {
+		return nil, fmt.Errorf("error normalizing %v: an IP address must be 4 or 16 bytes, not %d", []byte(ip), len(ip))
+	}
+	return SanitizeIPv6(ip), nil
+}
@@ -0,0 +1,37 @@
+//go:build go1.23
+// +build go1.23
+
+package maxminddb
+
+import "iter"
+
+// NetworksIter returns an iterator over all networks in the database for use
+// with a range statement:
+//
+//	for record, err := range reader.NetworksIter() {
+//		if err != nil {
+//			// handle error
+//		}
+//		// use record.Network and record.Offset
+//	}
+//
+// If an error is encountered during traversal, it is yielded as the final
+// value. Breaking out of the loop stops the traversal.
+func (r *Reader) NetworksIter() iter.Seq2[Record, error] {
+	return func(yield func(Record, error) bool) {
+		n := r.Networks()
+		for n.Next() {
+			offset, err := r.resolveDataPointer(n.lastNode.pointer)
+			if err != nil {
+				yield(Record{}, err)
+				return
+			}
+			if !yield(Record{Network: n.network(), Offset: offset}, nil) {
+				return
+			}
+		}
+		if err := n.Err(); err != nil {
+			yield(Record{}, err)
+		}
+	}
+}
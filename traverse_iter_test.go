@@ -0,0 +1,75 @@
+//go:build go1.23
+// +build go1.23
+
+package maxminddb
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNetworksIter(t *testing.T) {
+	for _, recordSize := range []uint{24, 28, 32} {
+		for _, ipVersion := range []uint{4, 6} {
+			fileName := fmt.Sprintf("test-data/test-data/MaxMind-DB-test-ipv%d-%d.mmdb", ipVersion, recordSize)
+			reader, err := Open(fileName)
+			require.Nil(t, err, "unexpected error while opening database: %v", err)
+
+			var expected []string
+			n := reader.Networks()
+			for n.Next() {
+				var record interface{}
+				network, err := n.Network(&record)
+				require.Nil(t, err)
+				expected = append(expected, network.String())
+			}
+			require.Nil(t, n.Err())
+
+			var actual []string
+			for record, err := range reader.NetworksIter() {
+				require.Nil(t, err)
+
+				var data struct {
+					IP string `maxminddb:"ip"`
+				}
+				require.Nil(t, reader.Decode(record.Offset, &data))
+				assert.Equal(t, data.IP, record.Network.IP.String())
+				actual = append(actual, record.Network.String())
+			}
+			assert.Equal(t, expected, actual)
+
+			assert.Nil(t, reader.Close())
+		}
+	}
+}
+
+func TestNetworksIterBreak(t *testing.T) {
+	reader, err := Open("test-data/test-data/MaxMind-DB-test-ipv4-24.mmdb")
+	require.Nil(t, err, "unexpected error while opening database: %v", err)
+	defer reader.Close()
+
+	count := 0
+	for _, err := range reader.NetworksIter() {
+		require.Nil(t, err)
+		count++
+		if count == 2 {
+			break
+		}
+	}
+	assert.Equal(t, 2, count)
+}
+
+func TestNetworksIterWithInvalidSearchTree(t *testing.T) {
+	reader, err := Open("test-data/test-data/MaxMind-DB-test-broken-search-tree-24.mmdb")
+	require.Nil(t, err, "unexpected error while opening database: %v", err)
+	defer reader.Close()
+
+	var lastErr error
+	for _, err := range reader.NetworksIter() {
+		lastErr = err
+	}
+	assert.EqualError(t, lastErr, "invalid search tree at 128.128.128.128/32")
+}
@@ -1,9 +1,15 @@
 package maxminddb
 
 import (
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
+	"math/rand"
+	"net"
+	"sync"
 	"testing"
-	
+
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -32,6 +38,177 @@ func TestNetworks(t *testing.T) {
 	}
 }
 
+func TestNetworksSkipAliasedNetworks(t *testing.T) {
+	for _, recordSize := range []uint{24, 28, 32} {
+		fileName := fmt.Sprintf("test-data/test-data/MaxMind-DB-test-mixed-%d.mmdb", recordSize)
+		reader, err := Open(fileName)
+		require.Nil(t, err, "unexpected error while opening database: %v", err)
+
+		seen := map[string]bool{}
+		n := reader.Networks(SkipAliasedNetworks)
+		for n.Next() {
+			var record interface{}
+			network, err := n.Network(&record)
+			require.Nil(t, err)
+
+			assert.False(t, seen[network.String()], "network %s seen twice", network)
+			seen[network.String()] = true
+			if network.IP.To4() != nil {
+				assert.Equal(t, net.IPv4len, len(network.IP))
+			}
+		}
+		assert.Nil(t, n.Err())
+		assert.Equal(t, 11, len(seen))
+
+		assert.Nil(t, reader.Close())
+	}
+}
+
+func TestNetworksKeepIPv6Form(t *testing.T) {
+	reader, err := Open("test-data/test-data/MaxMind-DB-test-mixed-24.mmdb")
+	require.Nil(t, err)
+	defer reader.Close()
+
+	var networks []*net.IPNet
+	n := reader.Networks(KeepIPv6Form)
+	for n.Next() {
+		network, err := n.Network(&struct{}{})
+		require.Nil(t, err)
+		assert.Equal(t, net.IPv6len, len(network.IP), network.String())
+		_, bits := network.Mask.Size()
+		assert.Equal(t, 128, bits, network.String())
+		networks = append(networks, network)
+	}
+	require.Nil(t, n.Err())
+	assert.Contains(t, networks, &net.IPNet{
+		IP:   net.ParseIP("::1.1.1.4"),
+		Mask: net.CIDRMask(126, 128),
+	})
+	assert.Contains(t, networks, &net.IPNet{
+		IP:   net.ParseIP("::ffff:1.1.1.4"),
+		Mask: net.CIDRMask(126, 128),
+	})
+
+	// In an IPv4 database, networks are always in their 4-byte form.
+	ipv4Reader, err := Open("test-data/test-data/MaxMind-DB-test-ipv4-24.mmdb")
+	require.Nil(t, err)
+	defer ipv4Reader.Close()
+	n = ipv4Reader.Networks(KeepIPv6Form)
+	require.True(t, n.Next())
+	network, err := n.Network(&struct{}{})
+	require.Nil(t, err)
+	assert.Equal(t, "1.1.1.1/32", network.String())
+	assert.Equal(t, net.IPv4len, len(network.IP))
+}
+
+func TestNetworksWithOverriddenSubPrefix(t *testing.T) {
+	// 0.0.0.0/1 holds "a" except for 64.0.0.0/3, which holds "b". As a
+	// writer does, the search tree splits 0.0.0.0/1 around the override.
+	nodeCount := uint(3)
+	a := nodeCount + DataSectionSeparatorSize
+	b := a + 2
+	reader, err := FromBytes(testDatabase(
+		[][2]uint{
+			{1, nodeCount}, // 0.0.0.0/1, 128.0.0.0/1
+			{a, 2},         // 0.0.0.0/2, 64.0.0.0/2
+			{b, a},         // 64.0.0.0/3, 96.0.0.0/3
+		},
+		append(encodeTestValue("a"), encodeTestValue("b")...),
+		nil,
+	))
+	require.Nil(t, err)
+
+	expected := []string{"0.0.0.0/2 a", "64.0.0.0/3 b", "96.0.0.0/3 a"}
+	var networks []string
+	n := reader.Networks()
+	for n.Next() {
+		var record string
+		network, err := n.Network(&record)
+		require.Nil(t, err)
+		networks = append(networks, network.String()+" "+record)
+	}
+	require.Nil(t, n.Err())
+	assert.Equal(t, expected, networks)
+
+	// The parts of 0.0.0.0/1 are not siblings, so they cannot be merged.
+	networks = nil
+	aggregated := reader.AggregatedNetworks(nil)
+	for aggregated.Next() {
+		var record string
+		network, err := aggregated.Network(&record)
+		require.Nil(t, err)
+		networks = append(networks, network.String()+" "+record)
+	}
+	require.Nil(t, aggregated.Err())
+	assert.Equal(t, expected, networks)
+}
+
+func TestNetworksInAscendingOrder(t *testing.T) {
+	for _, fileName := range []string{
+		"test-data/test-data/MaxMind-DB-test-ipv4-24.mmdb",
+		"test-data/test-data/MaxMind-DB-test-ipv6-24.mmdb",
+		"test-data/test-data/MaxMind-DB-test-mixed-24.mmdb",
+		"test-data/test-data/GeoIP2-City-Test.mmdb",
+	} {
+		reader, err := Open(fileName)
+		require.Nil(t, err)
+
+		for _, options := range [][]NetworksOption{nil, {SkipAliasedNetworks}} {
+			var previous []byte
+			count := 0
+			n := reader.Networks(options...)
+			for n.Next() {
+				current := n.lastNode.ip[:n.ipLen]
+				if previous != nil {
+					assert.True(
+						t,
+						bytes.Compare(previous, current) < 0,
+						"%s: %v returned after %v", fileName, net.IP(current), net.IP(previous),
+					)
+				}
+				previous = append(previous[:0], current...)
+				count++
+			}
+			require.Nil(t, n.Err())
+			assert.NotZero(t, count, fileName)
+		}
+		assert.Nil(t, reader.Close())
+	}
+}
+
+func TestNetworksDoNotAlias(t *testing.T) {
+	reader, err := Open("test-data/test-data/MaxMind-DB-test-mixed-24.mmdb")
+	require.Nil(t, err)
+	defer reader.Close()
+
+	var networks []*net.IPNet
+	var expected []string
+	n := reader.Networks()
+	for n.Next() {
+		var record interface{}
+		network, err := n.Network(&record)
+		require.Nil(t, err)
+		networks = append(networks, network)
+		expected = append(expected, network.String())
+	}
+	require.Nil(t, n.Err())
+	require.NotEmpty(t, networks)
+
+	var actual []string
+	for _, network := range networks {
+		actual = append(actual, network.String())
+	}
+	assert.Equal(t, expected, actual)
+
+	// Modifying one network must not affect any of the others.
+	for i := range networks[0].IP {
+		networks[0].IP[i] = 0xff
+	}
+	for i, network := range networks[1:] {
+		assert.Equal(t, expected[i+1], network.String())
+	}
+}
+
 func TestNetworksWithInvalidSearchTree(t *testing.T) {
 	reader, err := Open("test-data/test-data/MaxMind-DB-test-broken-search-tree-24.mmdb")
 	require.Nil(t, err, "unexpected error while opening database: %v", err)
@@ -46,3 +223,898 @@ func TestNetworksWithInvalidSearchTree(t *testing.T) {
 	assert.NotNil(t, n.Err(), "no error received when traversing an broken search tree")
 	assert.Equal(t, n.Err().Error(), "invalid search tree at 128.128.128.128/32")
 }
+
+func TestNetworksStackIsBoundedOnCyclicSearchTree(t *testing.T) {
+	tests := []struct {
+		ipVersion uint
+		bits      int
+		expected  string
+	}{
+		{4, 32, "invalid search tree at 0.0.0.0/32"},
+		{6, 128, "invalid search tree at ::/128"},
+	}
+	for _, test := range tests {
+		// The only node points to itself with both of its records, so the
+		// tree would never end if the traversal did not stop at the
+		// length of an address.
+		reader, err := FromBytes(testDatabase([][2]uint{{0, 0}}, nil, map[string]interface{}{
+			"ip_version": test.ipVersion,
+		}))
+		require.Nil(t, err)
+
+		n := reader.Networks()
+		assert.False(t, n.Next())
+		assert.EqualError(t, n.Err(), test.expected)
+		// One right child is pushed for each bit descended.
+		assert.Equal(t, test.bits, len(n.nodes))
+	}
+}
+
+type networkTest struct {
+	Network  string
+	Database string
+	Expected []string
+	Options  []NetworksOption
+}
+
+var tests = []networkTest{
+	{
+		Network:  "0.0.0.0/0",
+		Database: "ipv4",
+		Expected: []string{
+			"1.1.1.1/32",
+			"1.1.1.2/31",
+			"1.1.1.4/30",
+			"1.1.1.8/29",
+			"1.1.1.16/28",
+			"1.1.1.32/32",
+		},
+	},
+	{
+		Network:  "1.1.1.1/30",
+		Database: "ipv4",
+		Expected: []string{
+			"1.1.1.1/32",
+			"1.1.1.2/31",
+		},
+	},
+	{
+		Network:  "1.1.1.3/32",
+		Database: "ipv4",
+		Expected: []string{
+			"1.1.1.2/31",
+		},
+	},
+	{
+		Network:  "1.1.1.8/29",
+		Database: "mixed",
+		Expected: []string{
+			"1.1.1.8/29",
+		},
+	},
+	{
+		Network:  "1.1.1.16/28",
+		Database: "mixed",
+		Expected: []string{
+			"1.1.1.16/28",
+		},
+	},
+	{
+		Network:  "1.1.1.16/28",
+		Database: "mixed",
+		Expected: []string{
+			"1.1.1.16/28",
+		},
+		Options: []NetworksOption{SkipAliasedNetworks},
+	},
+	{
+		Network:  "::/0",
+		Database: "mixed",
+		Expected: []string{
+			"1.1.1.1/32",
+			"1.1.1.2/31",
+			"1.1.1.4/30",
+			"1.1.1.8/29",
+			"1.1.1.16/28",
+			"1.1.1.32/32",
+			"::1:ffff:ffff/128",
+			"::2:0:0/122",
+			"::2:0:40/124",
+			"::2:0:50/125",
+			"::2:0:58/127",
+		},
+		Options: []NetworksOption{SkipAliasedNetworks},
+	},
+	{
+		Network:  "::2:0:40/123",
+		Database: "ipv6",
+		Expected: []string{
+			"::2:0:40/124",
+			"::2:0:50/125",
+			"::2:0:58/127",
+		},
+	},
+	{
+		Network:  "::2:0:52/128",
+		Database: "ipv6",
+		Expected: []string{
+			"::2:0:50/125",
+		},
+	},
+}
+
+func TestNetworksWithin(t *testing.T) {
+	for _, v := range tests {
+		for _, recordSize := range []uint{24, 28, 32} {
+			fileName := fmt.Sprintf("test-data/test-data/MaxMind-DB-test-%s-%d.mmdb", v.Database, recordSize)
+			reader, err := Open(fileName)
+			require.Nil(t, err, "unexpected error while opening database: %v", err)
+
+			_, network, err := net.ParseCIDR(v.Network)
+			require.Nil(t, err)
+			n := reader.NetworksWithin(network, v.Options...)
+			var innerIPs []string
+
+			for n.Next() {
+				record := struct {
+					IP string `maxminddb:"ip"`
+				}{}
+				network, err := n.Network(&record)
+				assert.Nil(t, err)
+				innerIPs = append(innerIPs, network.String())
+			}
+
+			assert.Equal(t, v.Expected, innerIPs)
+			assert.Nil(t, n.Err())
+
+			reader.Close()
+		}
+	}
+}
+
+func TestNetworksWithinIPv6InIPv4(t *testing.T) {
+	reader, err := Open("test-data/test-data/MaxMind-DB-test-ipv4-24.mmdb")
+	require.Nil(t, err, "unexpected error while opening database: %v", err)
+	defer reader.Close()
+
+	_, network, err := net.ParseCIDR("::2:0:40/123")
+	require.Nil(t, err)
+
+	n := reader.NetworksWithin(network)
+	assert.False(t, n.Next())
+	assert.EqualError(t, n.Err(), "error getting networks with '::2:0:40/123': you attempted to use an IPv6 network in an IPv4-only database")
+}
+
+func TestNetworksWithinString(t *testing.T) {
+	for _, v := range tests {
+		fileName := fmt.Sprintf("test-data/test-data/MaxMind-DB-test-%s-24.mmdb", v.Database)
+		reader, err := Open(fileName)
+		require.Nil(t, err)
+
+		n, err := reader.NetworksWithinString(v.Network, v.Options...)
+		require.Nil(t, err, v.Network)
+		var innerIPs []string
+		for n.Next() {
+			record := struct {
+				IP string `maxminddb:"ip"`
+			}{}
+			network, err := n.Network(&record)
+			assert.Nil(t, err)
+			innerIPs = append(innerIPs, network.String())
+		}
+		assert.Equal(t, v.Expected, innerIPs, "%s in %s", v.Network, v.Database)
+		assert.Nil(t, n.Err())
+		assert.Nil(t, reader.Close())
+	}
+}
+
+func TestNetworksWithinStringErrors(t *testing.T) {
+	reader, err := Open("test-data/test-data/MaxMind-DB-test-ipv4-24.mmdb")
+	require.Nil(t, err)
+	defer reader.Close()
+
+	for _, cidr := range []string{"", "1.1.1.1", "1.1.1.0/33", "1.1.1/24", "::/129", "not a network"} {
+		n, err := reader.NetworksWithinString(cidr)
+		assert.Nil(t, n)
+		assert.EqualError(t, err, (&net.ParseError{Type: "CIDR address", Text: cidr}).Error())
+	}
+
+	n, err := reader.NetworksWithinString("::2:0:40/123")
+	assert.Nil(t, n)
+	assert.EqualError(
+		t,
+		err,
+		"error getting networks with '::2:0:40/123': you attempted to use an IPv6 network in an IPv4-only database",
+	)
+}
+
+func TestNetworksFrom(t *testing.T) {
+	tests := []struct {
+		database string
+		start    string
+		options  []NetworksOption
+		expected string // The first network, or "" if there is none.
+	}{
+		{"ipv4", "0.0.0.0", nil, "1.1.1.1/32"},
+		{"ipv4", "1.1.1.1", nil, "1.1.1.1/32"},
+		{"ipv4", "1.1.1.2", nil, "1.1.1.2/31"},
+		// 1.1.1.3 is in 1.1.1.2/31, which starts before it.
+		{"ipv4", "1.1.1.3", nil, "1.1.1.4/30"},
+		{"ipv4", "1.1.1.9", nil, "1.1.1.16/28"},
+		{"ipv4", "1.1.1.32", nil, "1.1.1.32/32"},
+		{"ipv4", "1.1.1.33", nil, ""},
+		{"ipv4", "255.255.255.255", nil, ""},
+		{"ipv6", "::", nil, "::1:ffff:ffff/128"},
+		{"ipv6", "::2:0:1", nil, "::2:0:40/124"},
+		{"ipv6", "::2:0:58", nil, "::2:0:58/127"},
+		{"ipv6", "::2:0:59", nil, ""},
+		{"mixed", "::", nil, "1.1.1.1/32"},
+		{"mixed", "::1.1.1.5", nil, "1.1.1.8/29"},
+		{"mixed", "::1:ffff:ffff", nil, "::1:ffff:ffff/128"},
+		{"mixed", "1.1.1.3", nil, "1.1.1.4/30"},
+		{"mixed", "1.1.1.33", nil, "2001:0:101:101::/64"},
+		{"mixed", "1.1.1.33", []NetworksOption{SkipAliasedNetworks}, "::1:ffff:ffff/128"},
+		{"mixed", "2001::", []NetworksOption{SkipAliasedNetworks}, ""},
+		{"mixed", "2002:101:104::", nil, "2002:101:104::/46"},
+	}
+	for _, test := range tests {
+		fileName := fmt.Sprintf("test-data/test-data/MaxMind-DB-test-%s-24.mmdb", test.database)
+		reader, err := Open(fileName)
+		require.Nil(t, err)
+
+		// The networks from start are the networks of Networks from the
+		// first one whose address in the search tree is at least start.
+		start := net.ParseIP(test.start)
+		if start.To4() != nil {
+			start = start.To4()
+			if reader.Metadata.IsIPv6() {
+				start = start.To16()
+				if len(test.options) > 0 {
+					start = append(make(net.IP, 12, 16), start[12:]...)
+				}
+			}
+		}
+		var expected []string
+		n := reader.Networks(test.options...)
+		for n.Next() {
+			if expected != nil || bytes.Compare(n.lastNode.ip[:n.ipLen], start) >= 0 {
+				expected = append(expected, n.network().String())
+			}
+		}
+		require.Nil(t, n.Err())
+		if test.expected == "" {
+			assert.Empty(t, expected, "%s in %s", test.start, test.database)
+		} else {
+			require.NotEmpty(t, expected, "%s in %s", test.start, test.database)
+			assert.Equal(t, test.expected, expected[0], "%s in %s", test.start, test.database)
+		}
+
+		var actual []string
+		n = reader.NetworksFrom(net.ParseIP(test.start), test.options...)
+		for n.Next() {
+			network, err := n.Network(&struct{}{})
+			require.Nil(t, err)
+			actual = append(actual, network.String())
+		}
+		require.Nil(t, n.Err())
+		assert.Equal(t, expected, actual, "%s in %s", test.start, test.database)
+		assert.Nil(t, reader.Close())
+	}
+}
+
+func TestNetworksFromErrors(t *testing.T) {
+	reader, err := Open("test-data/test-data/MaxMind-DB-test-ipv4-24.mmdb")
+	require.Nil(t, err)
+
+	n := reader.NetworksFrom(net.ParseIP("::2:0:40"))
+	assert.False(t, n.Next())
+	assert.EqualError(
+		t,
+		n.Err(),
+		"error getting networks from '::2:0:40': you attempted to use an IPv6 address in an IPv4-only database",
+	)
+
+	n = reader.NetworksFrom(net.IP{1, 2, 3})
+	assert.False(t, n.Next())
+	assert.EqualError(t, n.Err(), "error getting networks from [1 2 3]: an IP address must be 4 or 16 bytes, not 3")
+
+	require.Nil(t, reader.Close())
+	assert.Equal(t, ErrClosed, reader.NetworksFrom(net.ParseIP("1.1.1.1")).Err())
+}
+
+func TestNetworksWithContext(t *testing.T) {
+	for _, recordSize := range []uint{24, 28, 32} {
+		fileName := fmt.Sprintf("test-data/test-data/MaxMind-DB-test-ipv6-%d.mmdb", recordSize)
+		reader, err := Open(fileName)
+		require.Nil(t, err, "unexpected error while opening database: %v", err)
+
+		n := reader.NetworksWithContext(context.Background())
+		var count int
+		for n.Next() {
+			count++
+		}
+		assert.Nil(t, n.Err())
+		assert.NotZero(t, count)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		n = reader.NetworksWithContext(ctx)
+		assert.False(t, n.Next())
+		assert.Equal(t, context.Canceled, n.Err())
+
+		_, network, err := net.ParseCIDR("::1:ffff:ffff/96")
+		require.Nil(t, err)
+		n = reader.NetworksWithinContext(ctx, network)
+		assert.False(t, n.Next())
+		assert.Equal(t, context.Canceled, n.Err())
+
+		assert.Nil(t, reader.Close())
+	}
+}
+
+func TestNetworksWithContextCancelledDuringIteration(t *testing.T) {
+	// A full tree of depth 12 has more nodes than are visited between
+	// context checks.
+	const depth = 12
+	nodeCount := uint(1)<<depth - 1
+	dataPointer := nodeCount + DataSectionSeparatorSize
+	nodes := make([][2]uint, nodeCount)
+	for i := range nodes {
+		left, right := uint(2*i+1), uint(2*i+2)
+		if left >= nodeCount {
+			left, right = dataPointer, dataPointer
+		}
+		nodes[i] = [2]uint{left, right}
+	}
+	db := testDatabase(nodes, encodeTestValue("x"), nil)
+	reader, err := FromBytes(db)
+	require.Nil(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	n := reader.NetworksWithContext(ctx)
+	var count int
+	for n.Next() {
+		count++
+		if count == 1 {
+			cancel()
+		}
+	}
+	assert.Equal(t, context.Canceled, n.Err())
+	assert.True(t, count > 1)
+	assert.True(t, count < 1<<depth, "iteration stopped early")
+	assert.False(t, n.Next())
+}
+
+func TestNetworksSkipReservedNetworks(t *testing.T) {
+	tests := []struct {
+		IPVersion uint
+		Networks  []string
+		Expected  []string
+	}{
+		{
+			IPVersion: 4,
+			Networks: []string{
+				"1.0.0.0/8",
+				"8.8.8.0/24",
+				"10.0.0.0/8",
+				"127.0.0.1/32",
+				"172.0.0.0/8",
+				"192.168.1.0/24",
+				"224.0.0.0/4",
+			},
+			Expected: []string{
+				"1.0.0.0/8",
+				"8.8.8.0/24",
+				"172.0.0.0/8",
+			},
+		},
+		{
+			IPVersion: 6,
+			Networks: []string{
+				"::/128",
+				"::1/128",
+				"::8.8.8.0/120",
+				"::10.0.0.0/104",
+				"::ffff:192.168.0.0/112",
+				"::ffff:8.8.4.0/120",
+				"2001:db8::/32",
+				"2002:c0a8::/32",
+				"2002:808:808::/48",
+				"2600::/16",
+				"fe80::/10",
+			},
+			Expected: []string{
+				"8.8.8.0/24",
+				"8.8.4.0/24",
+				"2002:808:808::/48",
+				"2600::/16",
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(fmt.Sprintf("IPv%d", test.IPVersion), func(t *testing.T) {
+			db := testDatabase(
+				testTree(test.Networks...),
+				encodeTestValue("x"),
+				map[string]interface{}{"ip_version": test.IPVersion},
+			)
+			reader, err := FromBytes(db)
+			require.Nil(t, err)
+
+			var all []string
+			n := reader.Networks()
+			for n.Next() {
+				network, err := n.Network(new(interface{}))
+				require.Nil(t, err)
+				all = append(all, network.String())
+			}
+			require.Nil(t, n.Err())
+			assert.Len(t, all, len(test.Networks))
+
+			var unreserved []string
+			n = reader.Networks(SkipReservedNetworks)
+			for n.Next() {
+				network, err := n.Network(new(interface{}))
+				require.Nil(t, err)
+				unreserved = append(unreserved, network.String())
+			}
+			require.Nil(t, n.Err())
+			assert.Equal(t, test.Expected, unreserved)
+		})
+	}
+}
+
+func TestNetworksWithinSkipReservedNetworks(t *testing.T) {
+	db := testDatabase(
+		testTree("10.1.0.0/16", "10.2.0.0/16", "11.0.0.0/8"),
+		encodeTestValue("x"),
+		nil,
+	)
+	reader, err := FromBytes(db)
+	require.Nil(t, err)
+
+	_, network, err := net.ParseCIDR("10.1.2.0/24")
+	require.Nil(t, err)
+	n := reader.NetworksWithin(network, SkipReservedNetworks)
+	assert.False(t, n.Next())
+	assert.Nil(t, n.Err())
+
+	_, network, err = net.ParseCIDR("8.0.0.0/5")
+	require.Nil(t, err)
+	n = reader.NetworksWithin(network, SkipReservedNetworks)
+	require.True(t, n.Next())
+	found, err := n.Network(new(interface{}))
+	require.Nil(t, err)
+	assert.Equal(t, "11.0.0.0/8", found.String())
+	assert.False(t, n.Next())
+}
+
+func TestReservedTrie(t *testing.T) {
+	isReserved := func(reserved []*net.IPNet, ip net.IP, bit uint) bool {
+		for _, network := range reserved {
+			ones, _ := network.Mask.Size()
+			if bit >= uint(ones) && network.Contains(ip) {
+				return true
+			}
+		}
+		return false
+	}
+
+	r := rand.New(rand.NewSource(1))
+	for _, test := range []struct {
+		trie     reservedTrie
+		reserved []*net.IPNet
+	}{
+		{reservedIPv4Trie, reservedIPv4},
+		{reservedIPv6Trie, reservedIPv6},
+	} {
+		ipLen := len(test.reserved[0].IP)
+		// Random networks rarely hit a reserved network, so start from
+		// the reserved networks and their neighbors as well.
+		var ips []net.IP
+		for _, network := range test.reserved {
+			ips = append(ips, network.IP)
+			ones, _ := network.Mask.Size()
+			neighbor := append(net.IP(nil), network.IP...)
+			neighbor[(ones-1)>>3] ^= 1 << uint(7-(ones-1)%8)
+			ips = append(ips, neighbor)
+		}
+		for i := 0; i < 200; i++ {
+			ip := make(net.IP, ipLen)
+			r.Read(ip)
+			ips = append(ips, ip)
+		}
+
+		for _, ip := range ips {
+			for bit := uint(0); bit <= uint(8*ipLen); bit++ {
+				network := ip.Mask(net.CIDRMask(int(bit), 8*ipLen))
+				assert.Equal(
+					t,
+					isReserved(test.reserved, network, bit),
+					test.trie.isReserved(test.trie.position(network, bit)),
+					"%v/%v", network, bit,
+				)
+			}
+		}
+	}
+}
+
+func TestTraverse(t *testing.T) {
+	reader, err := Open("test-data/test-data/MaxMind-DB-test-ipv4-24.mmdb")
+	require.Nil(t, err)
+
+	var networks []string
+	err = reader.Traverse(func(network *net.IPNet, offset uintptr) error {
+		var record map[string]string
+		if err := reader.Decode(offset, &record); err != nil {
+			return err
+		}
+		assert.Equal(t, network.IP.String(), record["ip"])
+		networks = append(networks, network.String())
+		return nil
+	})
+	require.Nil(t, err)
+	assert.Equal(
+		t,
+		[]string{
+			"1.1.1.1/32",
+			"1.1.1.2/31",
+			"1.1.1.4/30",
+			"1.1.1.8/29",
+			"1.1.1.16/28",
+			"1.1.1.32/32",
+		},
+		networks,
+	)
+
+	stop := errors.New("stop")
+	var calls int
+	err = reader.Traverse(func(*net.IPNet, uintptr) error {
+		calls++
+		return stop
+	})
+	assert.Equal(t, stop, err)
+	assert.Equal(t, 1, calls)
+
+	assert.Nil(t, reader.Close())
+	err = reader.Traverse(func(*net.IPNet, uintptr) error { return nil })
+	assert.Equal(t, ErrClosed, err)
+}
+
+func TestNetworksOffset(t *testing.T) {
+	reader, err := Open("test-data/test-data/GeoIP2-City-Test.mmdb")
+	require.Nil(t, err)
+	defer reader.Close()
+
+	offsets := map[uintptr]bool{}
+	count := 0
+	n := reader.Networks(SkipAliasedNetworks)
+	for n.Next() {
+		var fromNetwork, fromOffset interface{}
+		network, err := n.Network(&fromNetwork)
+		require.Nil(t, err)
+		require.Nil(t, reader.Decode(n.Offset(), &fromOffset))
+		assert.Equal(t, fromNetwork, fromOffset, network.String())
+
+		offset, err := reader.LookupOffset(network.IP)
+		require.Nil(t, err)
+		assert.Equal(t, offset, n.Offset(), network.String())
+
+		offsets[n.Offset()] = true
+		count++
+	}
+	require.Nil(t, n.Err())
+	// Some of the networks share their records.
+	assert.True(t, len(offsets) < count)
+}
+
+func TestNetworkCount(t *testing.T) {
+	reader, err := Open("test-data/test-data/MaxMind-DB-test-ipv4-24.mmdb")
+	require.Nil(t, err)
+	count, err := reader.NetworkCount()
+	require.Nil(t, err)
+	assert.Equal(t, 6, count)
+	assert.Nil(t, reader.Close())
+	_, err = reader.NetworkCount()
+	assert.Equal(t, ErrClosed, err)
+
+	reader, err = Open("test-data/test-data/MaxMind-DB-test-mixed-24.mmdb")
+	require.Nil(t, err)
+	defer reader.Close()
+	count, err = reader.NetworkCount(SkipAliasedNetworks)
+	require.Nil(t, err)
+	assert.Equal(t, 11, count)
+
+	// Without SkipAliasedNetworks, the aliases of the IPv4 subtree are
+	// counted as well.
+	expected := 0
+	n := reader.Networks()
+	for n.Next() {
+		expected++
+	}
+	require.Nil(t, n.Err())
+	count, err = reader.NetworkCount()
+	require.Nil(t, err)
+	assert.Equal(t, expected, count)
+	assert.True(t, count > 11)
+
+	reader, err = FromBytes(testDatabase(testTree(
+		"1.0.0.0/8",
+		"10.0.0.0/8",
+		"192.168.0.0/16",
+	), encodeTestValue("x"), nil))
+	require.Nil(t, err)
+	count, err = reader.NetworkCount(SkipReservedNetworks)
+	require.Nil(t, err)
+	assert.Equal(t, 1, count)
+}
+
+func TestNetworksChan(t *testing.T) {
+	reader, err := Open("test-data/test-data/MaxMind-DB-test-ipv4-24.mmdb")
+	require.Nil(t, err)
+
+	var networks []string
+	records := reader.NetworksChan(context.Background(), func() interface{} {
+		return &map[string]string{}
+	})
+	for record := range records {
+		require.Nil(t, record.Err)
+		data := *record.Data.(*map[string]string)
+		assert.Equal(t, record.Network.IP.String(), data["ip"])
+		networks = append(networks, record.Network.String())
+	}
+	assert.Equal(
+		t,
+		[]string{
+			"1.1.1.1/32",
+			"1.1.1.2/31",
+			"1.1.1.4/30",
+			"1.1.1.8/29",
+			"1.1.1.16/28",
+			"1.1.1.32/32",
+		},
+		networks,
+	)
+
+	// Decoding into a type that does not match the records fails.
+	records = reader.NetworksChan(context.Background(), func() interface{} { return new(int) })
+	record := <-records
+	assert.Nil(t, record.Network)
+	assert.EqualError(t, record.Err, "maxminddb: cannot unmarshal map into type int")
+	_, ok := <-records
+	assert.False(t, ok)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	records = reader.NetworksChan(ctx, func() interface{} { return new(interface{}) })
+	record = <-records
+	require.Nil(t, record.Err)
+	cancel()
+	// Records already waiting to be sent may still be received, but the
+	// channel must be closed without an error record.
+	for record := range records {
+		require.Nil(t, record.Err)
+	}
+
+	assert.Nil(t, reader.Close())
+	records = reader.NetworksChan(context.Background(), func() interface{} { return new(interface{}) })
+	record = <-records
+	assert.Equal(t, ErrClosed, record.Err)
+	_, ok = <-records
+	assert.False(t, ok)
+}
+
+func TestRecordsWithin(t *testing.T) {
+	reader, err := Open("test-data/test-data/MaxMind-DB-test-ipv4-24.mmdb")
+	require.Nil(t, err)
+
+	_, network, err := net.ParseCIDR("1.1.1.0/27")
+	require.Nil(t, err)
+
+	records, err := reader.RecordsWithin(network, 10)
+	require.Nil(t, err)
+	var networks []string
+	for _, record := range records {
+		var data map[string]string
+		require.Nil(t, reader.Decode(record.Offset, &data))
+		assert.Equal(t, record.Network.IP.String(), data["ip"])
+		networks = append(networks, record.Network.String())
+	}
+	assert.Equal(
+		t,
+		[]string{"1.1.1.1/32", "1.1.1.2/31", "1.1.1.4/30", "1.1.1.8/29", "1.1.1.16/28"},
+		networks,
+	)
+
+	records, err = reader.RecordsWithin(network, 5)
+	require.Nil(t, err)
+	assert.Len(t, records, 5)
+
+	records, err = reader.RecordsWithin(network, 2)
+	require.IsType(t, RecordLimitError{}, err)
+	limitErr := err.(RecordLimitError)
+	assert.Equal(t, 2, limitErr.Limit)
+	assert.Equal(t, "1.1.1.4/30", limitErr.Next.String())
+	assert.EqualError(
+		t,
+		err,
+		"maxminddb: more than 2 records in network, stopped before 1.1.1.4/30",
+	)
+	require.Len(t, records, 2)
+	assert.Equal(t, "1.1.1.1/32", records[0].Network.String())
+	assert.Equal(t, "1.1.1.2/31", records[1].Network.String())
+
+	_, err = reader.RecordsWithin(network, 0)
+	assert.EqualError(t, err, "limit passed to RecordsWithin must be positive, got 0")
+
+	assert.Nil(t, reader.Close())
+	_, err = reader.RecordsWithin(network, 10)
+	assert.Equal(t, ErrClosed, err)
+}
+
+func BenchmarkNetworks(b *testing.B) {
+	reader, err := Open("test-data/test-data/GeoIP2-City-Test.mmdb")
+	require.Nil(b, err)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		n := reader.Networks()
+		for n.Next() {
+		}
+		require.Nil(b, n.Err())
+	}
+	b.StopTimer()
+	assert.Nil(b, reader.Close())
+}
+
+func TestSanitizeIPv6(t *testing.T) {
+	tests := []struct {
+		IP         string
+		Sanitized  net.IP
+		Compatible net.IP
+	}{
+		{"::", net.ParseIP("::"), net.ParseIP("::")},
+		{"::1", net.ParseIP("::1"), net.ParseIP("::1")},
+		{"::ffff:1.2.3.4", net.IPv4(1, 2, 3, 4).To4(), net.IPv4(1, 2, 3, 4).To4()},
+		{"::1.2.3.4", net.ParseIP("::1.2.3.4"), net.IPv4(1, 2, 3, 4).To4()},
+		{"::0.0.1.0", net.ParseIP("::0.0.1.0"), net.IPv4(0, 0, 1, 0).To4()},
+		{"2001:db8::1", net.ParseIP("2001:db8::1"), net.ParseIP("2001:db8::1")},
+	}
+	for _, test := range tests {
+		ip := net.ParseIP(test.IP)
+		assert.Equal(t, test.Sanitized, SanitizeIPv6(ip), "SanitizeIPv6(%s)", test.IP)
+		assert.Equal(t, test.Compatible, SanitizeIPv6Compatible(ip), "SanitizeIPv6Compatible(%s)", test.IP)
+	}
+
+	ip := net.IPv4(1, 2, 3, 4).To4()
+	assert.Equal(t, ip, SanitizeIPv6(ip))
+	assert.Equal(t, ip, SanitizeIPv6Compatible(ip))
+}
+
+func TestNormalizeIP(t *testing.T) {
+	for _, test := range []struct {
+		IP         net.IP
+		Normalized net.IP
+	}{
+		{net.ParseIP("::ffff:1.2.3.4"), net.IP{1, 2, 3, 4}},
+		{net.IP{1, 2, 3, 4}, net.IP{1, 2, 3, 4}},
+		{net.ParseIP("::1.2.3.4"), net.ParseIP("::1.2.3.4")},
+		{net.ParseIP("2001:db8::1"), net.ParseIP("2001:db8::1")},
+	} {
+		ip, err := NormalizeIP(test.IP)
+		require.Nil(t, err, test.IP.String())
+		assert.Equal(t, test.Normalized, ip, test.IP.String())
+	}
+
+	_, err := NormalizeIP(nil)
+	assert.EqualError(t, err, "ip passed to NormalizeIP cannot be nil")
+	_, err = NormalizeIP(net.IP{1, 2, 3})
+	assert.EqualError(t, err, "error normalizing [1 2 3]: an IP address must be 4 or 16 bytes, not 3")
+	_, err = NormalizeIP(net.IP{})
+	assert.EqualError(t, err, "error normalizing []: an IP address must be 4 or 16 bytes, not 0")
+}
+
+func TestNetworksUnspecifiedAddress(t *testing.T) {
+	reader, err := Open("test-data/test-data/MaxMind-DB-test-decoder.mmdb")
+	require.Nil(t, err)
+
+	var networks []string
+	n := reader.Networks(SkipAliasedNetworks)
+	for n.Next() {
+		network, err := n.Network(new(interface{}))
+		require.Nil(t, err)
+		networks = append(networks, network.String())
+	}
+	require.Nil(t, n.Err())
+	assert.Contains(t, networks, "::/128")
+	assert.NotContains(t, networks, "0.0.0.0/32")
+	assert.Contains(t, networks, "1.1.1.0/24")
+
+	assert.Nil(t, reader.Close())
+}
+
+func TestNetworksIPv4SubtreeStartingAtZero(t *testing.T) {
+	reader, err := Open("test-data/test-data/MaxMind-DB-test-mixed-24.mmdb", WithEmptyNodes())
+	require.Nil(t, err)
+
+	// The empty record of ::/104 is the IPv4 network 0.0.0.0/8, unlike the
+	// single addresses :: and ::1.
+	n := reader.Networks(SkipAliasedNetworks)
+	require.True(t, n.Next())
+	network, err := n.Network(new(interface{}))
+	require.Nil(t, err)
+	assert.Equal(t, "0.0.0.0/8", network.String())
+	require.True(t, n.Next())
+	network, err = n.Network(new(interface{}))
+	require.Nil(t, err)
+	assert.Equal(t, "1.0.0.0/16", network.String())
+
+	for _, ip := range []string{"0.0.0.1", "::", "::1"} {
+		network, _, err := reader.LookupNetwork(net.ParseIP(ip), new(interface{}))
+		require.Nil(t, err)
+		assert.Equal(t, "0.0.0.0/8", network.String(), ip)
+	}
+
+	assert.Nil(t, reader.Close())
+}
+
+func TestNetworksWithinConcurrently(t *testing.T) {
+	reader, err := Open(
+		"test-data/test-data/MaxMind-DB-test-mixed-24.mmdb",
+		WithDecodeCache(2),
+	)
+	require.Nil(t, err)
+
+	within := []string{
+		"1.1.1.0/29",
+		"1.1.1.8/29",
+		"1.1.1.16/28",
+		"1.1.1.32/27",
+		"::1:0:0/96",
+		"::2:0:0/96",
+		"::/0",
+		"0.0.0.0/0",
+	}
+	expected := make([][]string, len(within))
+	for i, cidr := range within {
+		expected[i] = networksWithin(t, reader, cidr)
+		require.NotEmpty(t, expected[i], cidr)
+	}
+
+	const iterations = 20
+	var wg sync.WaitGroup
+	for i := range within {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < iterations; j++ {
+				assert.Equal(t, expected[i], networksWithin(t, reader, within[i]))
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	assert.Nil(t, reader.Close())
+}
+
+func networksWithin(t *testing.T, reader *Reader, cidr string) []string {
+	_, network, err := net.ParseCIDR(cidr)
+	require.Nil(t, err)
+
+	var networks []string
+	n := reader.NetworksWithin(network, SkipAliasedNetworks)
+	for n.Next() {
+		var record struct {
+			IP string `maxminddb:"ip"`
+		}
+		network, err := n.Network(&record)
+		if !assert.Nil(t, err) {
+			break
+		}
+		networks = append(networks, network.String()+" "+record.IP)
+	}
+	assert.Nil(t, n.Err())
+	return networks
+}
@@ -0,0 +1,354 @@
+package maxminddb
+
+import (
+	"errors"
+	"math/big"
+	"reflect"
+	"sync"
+)
+
+// Unmarshaler is the interface implemented by types that can decode a
+// MaxMind DB value themselves. When a value being decoded into implements
+// Unmarshaler, UnmarshalMaxMindDB is called with a Decoder positioned at the
+// value instead of using reflection.
+type Unmarshaler interface {
+	UnmarshalMaxMindDB(d *Decoder) error
+}
+
+var unmarshalerType = reflect.TypeOf((*Unmarshaler)(nil)).Elem()
+
+var (
+	unmarshalerMap   = map[reflect.Type]bool{}
+	unmarshalerMapMu sync.RWMutex
+)
+
+// Decoder reads values from a MaxMind DB data section. Each Read method
+// decodes the next value and advances the Decoder past it. Pointers in the
+// data section are followed transparently.
+type Decoder struct {
+	d      *decoder
+	offset uint
+	depth  int
+}
+
+// ReadBool reads a boolean value.
+func (d *Decoder) ReadBool() (bool, error) {
+	size, offset, err := d.next(_Bool, reflect.TypeOf(false))
+	if err != nil {
+		return false, err
+	}
+	if size > 1 {
+		return false, newInvalidDatabaseError("the MaxMind DB file's data section contains bad data (bool size of %v)", size)
+	}
+	value, _, err := d.d.decodeBool(size, offset)
+	return value, err
+}
+
+// ReadBytes reads a bytes value. The returned slice is a copy.
+func (d *Decoder) ReadBytes() ([]byte, error) {
+	size, offset, err := d.next(_Bytes, sliceType)
+	if err != nil {
+		return nil, err
+	}
+	value, _, err := d.d.decodeBytes(size, offset)
+	return value, err
+}
+
+// ReadFloat32 reads a float value.
+func (d *Decoder) ReadFloat32() (float32, error) {
+	size, offset, err := d.next(_Float32, reflect.TypeOf(float32(0)))
+	if err != nil {
+		return 0, err
+	}
+	if size != 4 {
+		return 0, newInvalidDatabaseError("the MaxMind DB file's data section contains bad data (float32 size of %v)", size)
+	}
+	value, _, err := d.d.decodeFloat32(size, offset)
+	return value, err
+}
+
+// ReadFloat64 reads a double value.
+func (d *Decoder) ReadFloat64() (float64, error) {
+	size, offset, err := d.next(_Float64, reflect.TypeOf(float64(0)))
+	if err != nil {
+		return 0, err
+	}
+	if size != 8 {
+		return 0, newInvalidDatabaseError("the MaxMind DB file's data section contains bad data (float 64 size of %v)", size)
+	}
+	value, _, err := d.d.decodeFloat64(size, offset)
+	return value, err
+}
+
+// ReadInt32 reads an int32 value.
+func (d *Decoder) ReadInt32() (int32, error) {
+	size, offset, err := d.next(_Int32, reflect.TypeOf(int32(0)))
+	if err != nil {
+		return 0, err
+	}
+	if size > 4 {
+		return 0, newInvalidDatabaseError("the MaxMind DB file's data section contains bad data (int32 size of %v)", size)
+	}
+	value, _, err := d.d.decodeInt(size, offset)
+	return int32(value), err
+}
+
+// ReadString reads a UTF-8 string value.
+func (d *Decoder) ReadString() (string, error) {
+	size, offset, err := d.next(_String, reflect.TypeOf(""))
+	if err != nil {
+		return "", err
+	}
+	value, _, err := d.d.decodeString(size, offset)
+	return value, err
+}
+
+// ReadUint16 reads a uint16 value.
+func (d *Decoder) ReadUint16() (uint16, error) {
+	value, err := d.readUint(_Uint16, 16, reflect.TypeOf(uint16(0)))
+	return uint16(value), err
+}
+
+// ReadUint32 reads a uint32 value.
+func (d *Decoder) ReadUint32() (uint32, error) {
+	value, err := d.readUint(_Uint32, 32, reflect.TypeOf(uint32(0)))
+	return uint32(value), err
+}
+
+// ReadUint64 reads a uint64 value.
+func (d *Decoder) ReadUint64() (uint64, error) {
+	return d.readUint(_Uint64, 64, reflect.TypeOf(uint64(0)))
+}
+
+// ReadUint128 reads a uint128 value.
+func (d *Decoder) ReadUint128() (*big.Int, error) {
+	size, offset, err := d.next(_Uint128, reflect.TypeOf(&big.Int{}))
+	if err != nil {
+		return nil, err
+	}
+	if size > 16 {
+		return nil, newInvalidDatabaseError("the MaxMind DB file's data section contains bad data (uint128 size of %v)", size)
+	}
+	value, _, err := d.d.decodeUint128(size, offset)
+	return value, err
+}
+
+// ReadMap reads a map value, calling fn for each key and value in the order
+// in which they are stored. The value Decoder is only valid for the duration
+// of the call. Values not read by fn are skipped.
+func (d *Decoder) ReadMap(fn func(key string, value *Decoder) error) error {
+	size, offset, pointerEnd, err := d.ctrlData(_Map, reflect.TypeOf(map[string]interface{}{}))
+	if err != nil {
+		return err
+	}
+
+	value := &Decoder{d: d.d, depth: d.depth + 1}
+	for i := uint(0); i < size; i++ {
+		var key []byte
+		key, value.offset, err = d.d.decodeKey(offset)
+		if err != nil {
+			return err
+		}
+		valueOffset := value.offset
+		if err := fn(string(key), value); err != nil {
+			return err
+		}
+		offset, err = d.d.nextValueOffset(valueOffset, 1)
+		if err != nil {
+			return err
+		}
+	}
+	d.advance(offset, pointerEnd)
+	return nil
+}
+
+// ReadSlice reads an array value, calling fn for each element in order. The
+// value Decoder is only valid for the duration of the call. Elements not read
+// by fn are skipped.
+func (d *Decoder) ReadSlice(fn func(value *Decoder) error) error {
+	size, offset, pointerEnd, err := d.ctrlData(_Slice, reflect.TypeOf([]interface{}{}))
+	if err != nil {
+		return err
+	}
+
+	value := &Decoder{d: d.d, depth: d.depth + 1}
+	for i := uint(0); i < size; i++ {
+		value.offset = offset
+		if err := fn(value); err != nil {
+			return err
+		}
+		offset, err = d.d.nextValueOffset(offset, 1)
+		if err != nil {
+			return err
+		}
+	}
+	d.advance(offset, pointerEnd)
+	return nil
+}
+
+// Decode reads the next value using reflection and stores it in the value
+// pointed to by result. It follows the same rules as Reader.Decode.
+func (d *Decoder) Decode(result interface{}) error {
+	rv := reflect.ValueOf(result)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return errors.New("result param must be a pointer")
+	}
+	newOffset, err := d.d.decode(d.offset, rv, d.depth)
+	if err != nil {
+		return err
+	}
+	d.offset = newOffset
+	return nil
+}
+
+func (d *Decoder) readUint(expected dataType, uintType uint, resultType reflect.Type) (uint64, error) {
+	size, offset, err := d.next(expected, resultType)
+	if err != nil {
+		return 0, err
+	}
+	if size > uintType/8 {
+		return 0, newInvalidDatabaseError("the MaxMind DB file's data section contains bad data (uint%v size of %v)", uintType, size)
+	}
+	value, _, err := d.d.decodeUint(size, offset)
+	return value, err
+}
+
+// next decodes the control data of the next value, which must not be a map
+// or an array, and advances the Decoder past the value. It returns the size
+// and data offset of the value, or an error if the value is not of the
+// expected type.
+func (d *Decoder) next(expected dataType, resultType reflect.Type) (uint, uint, error) {
+	size, offset, pointerEnd, err := d.ctrlData(expected, resultType)
+	if err != nil {
+		return 0, 0, err
+	}
+	end := offset + size
+	if expected == _Bool {
+		// The size of a boolean is its value.
+		end = offset
+	}
+	d.advance(end, pointerEnd)
+	return size, offset, nil
+}
+
+// ctrlData decodes the control data of the next value, following a pointer if
+// there is one. It returns the size and data offset of the value and, if the
+// value was reached through a pointer, the offset following the pointer, or
+// 0 otherwise. It returns an error if the value is not of the expected type.
+// The Decoder is not advanced, as the end of a map or an array is only known
+// once its contents have been walked; see advance.
+func (d *Decoder) ctrlData(expected dataType, resultType reflect.Type) (uint, uint, uint, error) {
+	if d.depth > maximumDataStructureDepth {
+		return 0, 0, 0, newInvalidDatabaseError("exceeded maximum data structure depth; database is likely corrupt")
+	}
+	typeNum, size, offset, err := d.d.decodeCtrlData(d.offset)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+
+	var pointerEnd uint
+	if typeNum == _Pointer {
+		var pointer uint
+		pointer, pointerEnd, err = d.d.followPointer(size, offset)
+		if err != nil {
+			return 0, 0, 0, err
+		}
+		typeNum, size, offset, err = d.d.decodeCtrlData(pointer)
+		if err != nil {
+			return 0, 0, 0, err
+		}
+	}
+
+	if typeNum != expected {
+		return 0, 0, 0, newUnmarshalTypeError(typeNum, resultType)
+	}
+	switch typeNum {
+	case _Bool, _Map, _Slice:
+	default:
+		if offset+size > uint(len(d.d.buffer)) {
+			return 0, 0, 0, newOffsetError(offset+size, uint(len(d.d.buffer)))
+		}
+	}
+	return size, offset, pointerEnd, nil
+}
+
+// advance moves the Decoder past a value whose data ends at end, or, if the
+// value was reached through a pointer, past the pointer, which ends at
+// pointerEnd.
+func (d *Decoder) advance(end uint, pointerEnd uint) {
+	if pointerEnd != 0 {
+		end = pointerEnd
+	}
+	d.offset = end
+}
+
+// unmarshaler returns the Unmarshaler for result, if result or a pointer to
+// it implements Unmarshaler. Nil pointers are allocated as necessary. For a
+// pointer to a pointer, e.g., a **T field where *T implements Unmarshaler,
+// the pointers are followed to the one implementing it.
+func unmarshaler(result reflect.Value) (Unmarshaler, bool) {
+	for result.Kind() == reflect.Ptr && !implementsUnmarshaler(result.Type()) &&
+		pointsToUnmarshaler(result.Type().Elem()) {
+		if result.IsNil() {
+			if !result.CanSet() {
+				return nil, false
+			}
+			result.Set(reflect.New(result.Type().Elem()))
+		}
+		result = result.Elem()
+	}
+	if result.Kind() == reflect.Ptr {
+		if !result.CanInterface() || !implementsUnmarshaler(result.Type()) {
+			return nil, false
+		}
+		if result.IsNil() {
+			if !result.CanSet() {
+				return nil, false
+			}
+			result.Set(reflect.New(result.Type().Elem()))
+		}
+		return result.Interface().(Unmarshaler), true
+	}
+	if result.Kind() != reflect.Interface && result.CanAddr() {
+		pv := result.Addr()
+		if pv.CanInterface() && implementsUnmarshaler(pv.Type()) {
+			return pv.Interface().(Unmarshaler), true
+		}
+	}
+	return nil, false
+}
+
+// pointsToUnmarshaler reports whether t is a pointer implementing Unmarshaler
+// or a pointer to such a pointer.
+func pointsToUnmarshaler(t reflect.Type) bool {
+	for ; t.Kind() == reflect.Ptr; t = t.Elem() {
+		if implementsUnmarshaler(t) {
+			return true
+		}
+	}
+	return false
+}
+
+// implementsUnmarshaler reports whether t implements Unmarshaler. As this is
+// checked for every value decoded, the results are cached per type.
+func implementsUnmarshaler(t reflect.Type) bool {
+	unmarshalerMapMu.RLock()
+	implements, ok := unmarshalerMap[t]
+	unmarshalerMapMu.RUnlock()
+	if ok {
+		return implements
+	}
+
+	implements = t.Implements(unmarshalerType)
+	unmarshalerMapMu.Lock()
+	unmarshalerMap[t] = implements
+	unmarshalerMapMu.Unlock()
+	return implements
+}
+
+func (d *decoder) decodeUnmarshaler(offset uint, u Unmarshaler, depth int) (uint, error) {
+	if err := u.UnmarshalMaxMindDB(&Decoder{d: d, offset: offset, depth: depth}); err != nil {
+		return 0, err
+	}
+	return d.nextValueOffset(offset, 1)
+}
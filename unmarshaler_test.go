@@ -0,0 +1,201 @@
+package maxminddb
+
+import (
+	"encoding/hex"
+	"math/big"
+	"net"
+	"reflect"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type unmarshalerRecord struct {
+	Array      []uint32
+	Boolean    bool
+	Bytes      []byte
+	Double     float64
+	Float      float32
+	Int32      int32
+	Map        map[string]interface{}
+	Uint16     uint16
+	Uint32     uint32
+	Uint64     uint64
+	Uint128    *big.Int
+	Utf8String string
+}
+
+func (u *unmarshalerRecord) UnmarshalMaxMindDB(d *Decoder) error {
+	return d.ReadMap(func(key string, value *Decoder) error {
+		var err error
+		switch key {
+		case "array":
+			err = value.ReadSlice(func(value *Decoder) error {
+				v, err := value.ReadUint32()
+				u.Array = append(u.Array, v)
+				return err
+			})
+		case "boolean":
+			u.Boolean, err = value.ReadBool()
+		case "bytes":
+			u.Bytes, err = value.ReadBytes()
+		case "double":
+			u.Double, err = value.ReadFloat64()
+		case "float":
+			u.Float, err = value.ReadFloat32()
+		case "int32":
+			u.Int32, err = value.ReadInt32()
+		case "map":
+			err = value.Decode(&u.Map)
+		case "uint16":
+			u.Uint16, err = value.ReadUint16()
+		case "uint32":
+			u.Uint32, err = value.ReadUint32()
+		case "uint64":
+			u.Uint64, err = value.ReadUint64()
+		case "uint128":
+			u.Uint128, err = value.ReadUint128()
+		case "utf8_string":
+			u.Utf8String, err = value.ReadString()
+		}
+		return err
+	})
+}
+
+func TestUnmarshaler(t *testing.T) {
+	reader, err := Open("test-data/test-data/MaxMind-DB-test-decoder.mmdb")
+	require.Nil(t, err, "unexpected error while opening database: %v", err)
+
+	var result unmarshalerRecord
+	require.Nil(t, reader.Lookup(net.ParseIP("::1.1.1.0"), &result))
+
+	assert.Equal(t, []uint32{1, 2, 3}, result.Array)
+	assert.True(t, result.Boolean)
+	assert.Equal(t, []byte{0x00, 0x00, 0x00, 0x2a}, result.Bytes)
+	assert.Equal(t, 42.123456, result.Double)
+	assert.Equal(t, float32(1.1), result.Float)
+	assert.Equal(t, int32(-268435456), result.Int32)
+	assert.Equal(t,
+		map[string]interface{}{
+			"mapX": map[string]interface{}{
+				"arrayX":       []interface{}{uint32(7), uint32(8), uint32(9)},
+				"utf8_stringX": "hello",
+			}},
+		result.Map,
+	)
+	assert.Equal(t, uint16(100), result.Uint16)
+	assert.Equal(t, uint32(268435456), result.Uint32)
+	assert.Equal(t, uint64(1152921504606846976), result.Uint64)
+	assert.Equal(t, "unicode! ☯ - ♫", result.Utf8String)
+	bigInt := new(big.Int)
+	bigInt.SetString("1329227995784915872903807060280344576", 10)
+	assert.Equal(t, bigInt, result.Uint128)
+
+	assert.Nil(t, reader.Close())
+}
+
+type isoCode string
+
+func (c *isoCode) UnmarshalMaxMindDB(d *Decoder) error {
+	return d.ReadMap(func(key string, value *Decoder) error {
+		if key != "iso_code" {
+			return nil
+		}
+		s, err := value.ReadString()
+		*c = isoCode(s)
+		return err
+	})
+}
+
+func TestUnmarshalerField(t *testing.T) {
+	reader, err := Open("test-data/test-data/GeoIP2-City-Test.mmdb")
+	require.Nil(t, err, "unexpected error while opening database: %v", err)
+
+	var result struct {
+		Country           isoCode  `maxminddb:"country"`
+		RegisteredCountry *isoCode `maxminddb:"registered_country"`
+		Location          struct {
+			TimeZone string `maxminddb:"time_zone"`
+		} `maxminddb:"location"`
+	}
+	require.Nil(t, reader.Lookup(net.ParseIP("81.2.69.142"), &result))
+
+	assert.Equal(t, isoCode("GB"), result.Country)
+	require.NotNil(t, result.RegisteredCountry)
+	assert.Equal(t, isoCode("GB"), *result.RegisteredCountry)
+	assert.Equal(t, "Europe/London", result.Location.TimeZone)
+
+	var pointers struct {
+		Country   **isoCode `maxminddb:"country"`
+		Continent **isoCode `maxminddb:"does-not-exist"`
+	}
+	require.Nil(t, reader.Lookup(net.ParseIP("81.2.69.142"), &pointers))
+	require.NotNil(t, pointers.Country)
+	require.NotNil(t, *pointers.Country)
+	assert.Equal(t, isoCode("GB"), **pointers.Country)
+	assert.Nil(t, pointers.Continent)
+
+	assert.Nil(t, reader.Close())
+}
+
+func TestDecoderTypeMismatch(t *testing.T) {
+	// {"en": "Foo"}
+	input, err := hex.DecodeString("e142656e43466f6f")
+	require.Nil(t, err)
+	d := decoder{buffer: input}
+
+	var s isoCode
+	_, err = d.decode(0, reflect.ValueOf(&s), 0)
+	assert.Nil(t, err)
+	assert.Equal(t, isoCode(""), s)
+
+	dec := &Decoder{d: &d}
+	_, err = dec.ReadString()
+	assert.EqualError(t, err, "maxminddb: cannot unmarshal map into type string")
+
+	err = dec.ReadMap(func(key string, value *Decoder) error {
+		_, err := value.ReadUint32()
+		return err
+	})
+	assert.EqualError(t, err, "maxminddb: cannot unmarshal utf8_string into type uint32")
+}
+
+func TestDecoderAdvances(t *testing.T) {
+	// {"a": [1, 2]}, a pointer to it, "x", true, "y"
+	input, err := hex.DecodeString(
+		"e1" + "4161" + "0204" + "a101" + "a102" + "2000" + "4178" + "0107" + "4179",
+	)
+	require.Nil(t, err)
+	dec := &Decoder{d: &decoder{buffer: input}}
+
+	// Values not read are skipped.
+	require.Nil(t, dec.ReadMap(func(string, *Decoder) error { return nil }))
+
+	var values []uint16
+	require.Nil(t, dec.ReadMap(func(key string, value *Decoder) error {
+		return value.ReadSlice(func(value *Decoder) error {
+			v, err := value.ReadUint16()
+			values = append(values, v)
+			return err
+		})
+	}))
+	assert.Equal(t, []uint16{1, 2}, values)
+
+	s, err := dec.ReadString()
+	require.Nil(t, err)
+	assert.Equal(t, "x", s)
+	b, err := dec.ReadBool()
+	require.Nil(t, err)
+	assert.True(t, b)
+	s, err = dec.ReadString()
+	require.Nil(t, err)
+	assert.Equal(t, "y", s)
+
+	assert.True(t, implementsUnmarshaler(reflect.TypeOf(&unmarshalerRecord{})))
+	unmarshalerMapMu.RLock()
+	implements, ok := unmarshalerMap[reflect.TypeOf(&unmarshalerRecord{})]
+	unmarshalerMapMu.RUnlock()
+	assert.True(t, ok)
+	assert.True(t, implements)
+}
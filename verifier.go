@@ -1,135 +1,248 @@
 package maxminddb
 
 import (
+	"errors"
+	"fmt"
 	"reflect"
 	"runtime"
 )
 
 type verifier struct {
-	reader *Reader
+	reader    *Reader
+	maxErrors int
+	errs      []error
 }
 
+// maxVerifyAllErrors is the number of errors after which VerifyAll stops.
+const maxVerifyAllErrors = 1000
+
 // Verify checks that the database is valid. It validates the search tree,
 // the data section, and the metadata section. This verifier is stricter than
 // the specification and may return errors on databases that are readable.
 func (r *Reader) Verify() error {
-	v := verifier{r}
-	if err := v.verifyMetadata(); err != nil {
-		return err
+	errs := r.verify(1)
+	if len(errs) == 0 {
+		return nil
 	}
+	return errs[0]
+}
 
-	err := v.verifyDatabase()
+// VerifyAll is like Verify, except that it does not stop at the first
+// problem. It returns every error it finds, in the order Verify would have
+// encountered them, which is useful when debugging the program that wrote
+// the database. Each error identifies the network of the search tree node or
+// the data section offset it applies to. An error that makes the rest of a
+// section unreadable, such as a malformed data section value, ends the
+// verification of that section. At most 1000 errors are returned.
+func (r *Reader) VerifyAll() []error {
+	return r.verify(maxVerifyAllErrors)
+}
+
+// SelfConsistencyCheck checks that Lookup agrees with Networks: for every
+// network Networks returns, looking up the first address of the network must
+// lead to the same data record. It returns an error for the first network
+// where they disagree. Unlike Verify, it only walks the search tree and does
+// not decode any records.
+func (r *Reader) SelfConsistencyCheck() error {
+	if r.buffer == nil {
+		return ErrClosed
+	}
+	n := r.Networks()
+	for n.Next() {
+		network := n.network()
+		offset, err := r.LookupOffset(network.IP)
+		if err != nil {
+			return err
+		}
+		if expected := n.Offset(); offset != expected {
+			return newInvalidDatabaseError(
+				"looking up %v returned %v, but Networks returned %v for %v",
+				network.IP,
+				describeOffset(offset),
+				describeOffset(expected),
+				network,
+			)
+		}
+	}
+	return n.Err()
+}
+
+// describeOffset describes a data section offset returned by LookupOffset or
+// Networks.Offset for an error message.
+func describeOffset(offset uintptr) string {
+	if offset == NotFound {
+		return "no record"
+	}
+	return fmt.Sprintf("the record at offset %d", offset)
+}
+
+func (r *Reader) verify(maxErrors int) []error {
+	if r.buffer == nil {
+		return []error{ErrClosed}
+	}
+	if r.source != nil {
+		return []error{errors.New("maxminddb: Verify is not supported for a Reader created by FromReaderAt")}
+	}
+	v := verifier{reader: r, maxErrors: maxErrors}
+	if v.verifyMetadata() {
+		v.verifyDatabase()
+	}
 	runtime.KeepAlive(v.reader)
-	return err
+	return v.errs
 }
 
-func (v *verifier) verifyMetadata() error {
+// report records err and returns whether verification should continue.
+func (v *verifier) report(err error) bool {
+	v.errs = append(v.errs, err)
+	return len(v.errs) < v.maxErrors
+}
+
+func (v *verifier) verifyMetadata() bool {
 	metadata := v.reader.Metadata
 
 	if metadata.BinaryFormatMajorVersion != 2 {
-		return testError(
+		if !v.report(testError(
 			"binary_format_major_version",
 			2,
 			metadata.BinaryFormatMajorVersion,
-		)
+		)) {
+			return false
+		}
 	}
 
 	if metadata.BinaryFormatMinorVersion != 0 {
-		return testError(
+		if !v.report(testError(
 			"binary_format_minor_version",
 			0,
 			metadata.BinaryFormatMinorVersion,
-		)
+		)) {
+			return false
+		}
 	}
 
 	if metadata.DatabaseType == "" {
-		return testError(
+		if !v.report(testError(
 			"database_type",
 			"non-empty string",
 			metadata.DatabaseType,
-		)
+		)) {
+			return false
+		}
 	}
 
 	if len(metadata.Description) == 0 {
-		return testError(
+		if !v.report(testError(
 			"description",
 			"non-empty slice",
 			metadata.Description,
-		)
+		)) {
+			return false
+		}
 	}
 
-	if metadata.IPVersion != 4 && metadata.IPVersion != 6 {
-		return testError(
+	if metadata.IPVersion != IPv4 && metadata.IPVersion != IPv6 {
+		if !v.report(testError(
 			"ip_version",
 			"4 or 6",
 			metadata.IPVersion,
-		)
+		)) {
+			return false
+		}
 	}
 
 	if metadata.RecordSize != 24 &&
 		metadata.RecordSize != 28 &&
 		metadata.RecordSize != 32 {
-		return testError(
+		if !v.report(testError(
 			"record_size",
 			"24, 28, or 32",
 			metadata.RecordSize,
-		)
-	}
-
-	if metadata.NodeCount == 0 {
-		return testError(
-			"node_count",
-			"positive integer",
-			metadata.NodeCount,
-		)
+		)) {
+			return false
+		}
 	}
-	return nil
+	return true
 }
 
-func (v *verifier) verifyDatabase() error {
-	offsets, err := v.verifySearchTree()
-	if err != nil {
-		return err
+func (v *verifier) verifyDatabase() {
+	offsets, ok := v.verifySearchTree()
+	if !ok {
+		return
 	}
 
-	if err := v.verifyDataSectionSeparator(); err != nil {
-		return err
+	if !v.verifyDataSectionSeparator() {
+		return
 	}
 
-	return v.verifyDataSection(offsets)
+	v.verifyDataSection(offsets)
 }
 
-func (v *verifier) verifySearchTree() (map[uint]bool, error) {
+// verifySearchTree returns the data section offsets the search tree points
+// to and whether verification should continue.
+func (v *verifier) verifySearchTree() (map[uint]bool, bool) {
 	offsets := make(map[uint]bool)
 
+	nodeCount := v.reader.Metadata.NodeCount
+	dataSectionSize := uintptr(len(v.reader.decoder.buffer))
+
 	it := v.reader.Networks()
 	for it.Next() {
-		offset, err := v.reader.resolveDataPointer(it.lastNode.pointer)
-		if err != nil {
-			return nil, err
+		node := it.lastNode
+		if node.pointer == nodeCount {
+			// An empty record, which Networks returns for a Reader
+			// created with WithEmptyNodes.
+			continue
+		}
+		if node.pointer < nodeCount+DataSectionSeparatorSize {
+			if !v.report(newInvalidDatabaseError(
+				"invalid data pointer (%v) in the search tree at %v/%v: pointers must be at least %v",
+				node.pointer,
+				it.nodeIP(node),
+				node.bit,
+				nodeCount+DataSectionSeparatorSize,
+			)) {
+				return nil, false
+			}
+			continue
+		}
+		offset := uintptr(node.pointer - nodeCount - DataSectionSeparatorSize)
+		if offset >= dataSectionSize {
+			if !v.report(newInvalidDatabaseError(
+				"data pointer (%v) in the search tree at %v/%v points to offset %v, past the end of the data section (%v)",
+				node.pointer,
+				it.nodeIP(node),
+				node.bit,
+				offset,
+				dataSectionSize,
+			)) {
+				return nil, false
+			}
+			continue
 		}
 		offsets[uint(offset)] = true
 	}
 	if err := it.Err(); err != nil {
-		return nil, err
+		if !v.report(err) {
+			return nil, false
+		}
 	}
-	return offsets, nil
+	return offsets, true
 }
 
-func (v *verifier) verifyDataSectionSeparator() error {
+func (v *verifier) verifyDataSectionSeparator() bool {
 	separatorStart := v.reader.Metadata.NodeCount * v.reader.Metadata.RecordSize / 4
 
-	separator := v.reader.buffer[separatorStart : separatorStart+dataSectionSeparatorSize]
+	separator := v.reader.buffer[separatorStart : separatorStart+DataSectionSeparatorSize]
 
 	for _, b := range separator {
 		if b != 0 {
-			return newInvalidDatabaseError("unexpected byte in data separator: %v", separator)
+			return v.report(newInvalidDatabaseError("unexpected byte in data separator: %v", separator))
 		}
 	}
-	return nil
+	return true
 }
 
-func (v *verifier) verifyDataSection(offsets map[uint]bool) error {
+func (v *verifier) verifyDataSection(offsets map[uint]bool) {
 	pointerCount := len(offsets)
 
 	decoder := v.reader.decoder
@@ -141,39 +254,51 @@ func (v *verifier) verifyDataSection(offsets map[uint]bool) error {
 		rv := reflect.ValueOf(&data)
 		newOffset, err := decoder.decode(offset, rv, 0)
 		if err != nil {
-			return newInvalidDatabaseError("received decoding error (%v) at offset of %v", err, offset)
+			// The end of the value, and so the start of the next
+			// one, is unknown.
+			v.report(newInvalidDatabaseError("received decoding error (%v) at offset of %v", err, offset))
+			return
 		}
 		if newOffset <= offset {
-			return newInvalidDatabaseError("data section offset unexpectedly went from %v to %v", offset, newOffset)
+			v.report(newInvalidDatabaseError("data section offset unexpectedly went from %v to %v", offset, newOffset))
+			return
 		}
 
 		pointer := offset
 
 		if _, ok := offsets[pointer]; ok {
 			delete(offsets, pointer)
-		} else {
-			return newInvalidDatabaseError("found data (%v) at %v that the search tree does not point to", data, pointer)
+		} else if !v.report(newInvalidDatabaseError("found data (%v) at %v that the search tree does not point to", data, pointer)) {
+			return
 		}
 
 		offset = newOffset
 	}
 
 	if offset != bufferLen {
-		return newInvalidDatabaseError(
+		if !v.report(newInvalidDatabaseError(
 			"unexpected data at the end of the data section (last offset: %v, end: %v)",
 			offset,
 			bufferLen,
-		)
+		)) {
+			return
+		}
 	}
 
 	if len(offsets) != 0 {
-		return newInvalidDatabaseError(
-			"found %v pointers (of %v) in the search tree that we did not see in the data section",
+		first := bufferLen
+		for offset := range offsets {
+			if offset < first {
+				first = offset
+			}
+		}
+		v.report(newInvalidDatabaseError(
+			"found %v pointers (of %v) in the search tree that we did not see in the data section, starting at offset %v",
 			len(offsets),
 			pointerCount,
-		)
+			first,
+		))
 	}
-	return nil
 }
 
 func testError(
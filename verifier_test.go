@@ -56,3 +56,125 @@ func TestVerifyOnBrokenDatabases(t *testing.T) {
 		)
 	}
 }
+
+func TestVerifyOnCraftedDatabases(t *testing.T) {
+	data := encodeTestValue(map[string]interface{}{"ip": "0.0.0.0"})
+	nodeCount := uint(1)
+	dataStart := nodeCount + DataSectionSeparatorSize
+
+	tests := []struct {
+		name     string
+		nodes    [][2]uint
+		expected string
+	}{
+		{
+			name:  "valid",
+			nodes: [][2]uint{{dataStart, nodeCount}},
+		},
+		{
+			name:     "pointer into separator",
+			nodes:    [][2]uint{{nodeCount + 5, nodeCount}},
+			expected: "invalid data pointer (6) in the search tree at 0.0.0.0/1: pointers must be at least 17",
+		},
+		{
+			name:     "pointer past data section",
+			nodes:    [][2]uint{{dataStart, dataStart + 100}},
+			expected: "data pointer (117) in the search tree at 128.0.0.0/1 points to offset 100, past the end of the data section (12)",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			reader, err := FromBytes(testDatabase(test.nodes, data, nil))
+			require.NoError(t, err)
+
+			err = reader.Verify()
+			if test.expected == "" {
+				assert.NoError(t, err)
+				return
+			}
+			assert.IsType(t, InvalidDatabaseError{}, err)
+			assert.EqualError(t, err, test.expected)
+		})
+	}
+}
+
+func TestVerifyAll(t *testing.T) {
+	data := encodeTestValue(map[string]interface{}{"ip": "0.0.0.0"})
+	data = append(data, encodeTestValue("unreferenced")...)
+	nodeCount := uint(1)
+	dataStart := nodeCount + DataSectionSeparatorSize
+
+	reader, err := FromBytes(testDatabase([][2]uint{{nodeCount + 5, dataStart + 100}}, data, map[string]interface{}{
+		"binary_format_minor_version": uint(1),
+	}))
+	require.NoError(t, err)
+
+	errs := reader.VerifyAll()
+	var messages []string
+	for _, err := range errs {
+		assert.IsType(t, InvalidDatabaseError{}, err)
+		messages = append(messages, err.Error())
+	}
+	assert.Equal(
+		t,
+		[]string{
+			"binary_format_minor_version - Expected: 0 Actual: 1",
+			"invalid data pointer (6) in the search tree at 0.0.0.0/1: pointers must be at least 17",
+			"data pointer (117) in the search tree at 128.0.0.0/1 points to offset 100, past the end of the data section (25)",
+			"found data (map[ip:0.0.0.0]) at 0 that the search tree does not point to",
+			"found data (unreferenced) at 12 that the search tree does not point to",
+		},
+		messages,
+	)
+	assert.Equal(t, errs[0], reader.Verify())
+	assert.Equal(t, errs[:2], reader.verify(2))
+
+	reader, err = FromBytes(testDatabase([][2]uint{{dataStart, dataStart + 12}}, data, nil))
+	require.NoError(t, err)
+	assert.Empty(t, reader.VerifyAll())
+	assert.NoError(t, reader.Verify())
+
+	require.NoError(t, reader.Close())
+	assert.Equal(t, []error{ErrClosed}, reader.VerifyAll())
+	assert.Equal(t, ErrClosed, reader.Verify())
+}
+
+func TestSelfConsistencyCheck(t *testing.T) {
+	for _, database := range []string{
+		"test-data/test-data/GeoIP2-City-Test.mmdb",
+		"test-data/test-data/MaxMind-DB-test-decoder.mmdb",
+		"test-data/test-data/MaxMind-DB-test-ipv4-24.mmdb",
+		"test-data/test-data/MaxMind-DB-test-ipv6-28.mmdb",
+		"test-data/test-data/MaxMind-DB-test-mixed-24.mmdb",
+		"test-data/test-data/MaxMind-DB-test-mixed-28.mmdb",
+		"test-data/test-data/MaxMind-DB-test-mixed-32.mmdb",
+	} {
+		t.Run(database, func(t *testing.T) {
+			reader, err := Open(database)
+			require.NoError(t, err)
+			defer reader.Close()
+
+			assert.NoError(t, reader.SelfConsistencyCheck())
+		})
+	}
+
+	// The IPv4-mapped networks are looked up in the IPv4 subtree, which is
+	// empty here rather than an alias of ::ffff:0:0/96.
+	reader, err := FromBytes(testDatabase(
+		testTree("::ffff:0:0/96"),
+		encodeTestValue("mapped"),
+		map[string]interface{}{"ip_version": uint(6)},
+	))
+	require.NoError(t, err)
+	err = reader.SelfConsistencyCheck()
+	assert.IsType(t, InvalidDatabaseError{}, err)
+	assert.EqualError(
+		t,
+		err,
+		"looking up 0.0.0.0 returned no record, but Networks returned the record at offset 0 for 0.0.0.0/0",
+	)
+
+	require.NoError(t, reader.Close())
+	assert.Equal(t, ErrClosed, reader.SelfConsistencyCheck())
+}